@@ -0,0 +1,230 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-multierror"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+)
+
+// AttachMachine builds a Machine around a Firecracker process that is already
+// running, for example one started by a previous incarnation of the calling
+// process. The VMM is identified by the path of its API socket and its PID.
+//
+// The Machine's Cfg is rebuilt from the configuration exported by the VMM, so
+// fields that Firecracker does not know about (such as JailerCfg or CNI
+// configuration) are left empty. The process is tracked through a pidfd, which
+// allows Wait, StopVMM, PauseVM, CreateSnapshot and the other API methods to be
+// used as on a Machine returned by NewMachine. Start returns ErrAlreadyStarted.
+//
+// Once the VMM exits, the API socket and any log or metrics FIFOs are removed.
+// Other host resources, such as a network namespace, are only released if the
+// Machine was attached with MachineStateRecord.Attach, whose record tells which
+// of them the SDK created.
+func AttachMachine(ctx context.Context, socketPath string, pid int, opts ...Opt) (*Machine, error) {
+	pidfd, err := unix.PidfdOpen(pid, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pidfd for firecracker process %d: %w", pid, err)
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		unix.Close(pidfd)
+		return nil, fmt.Errorf("failed to find firecracker process %d: %w", pid, err)
+	}
+
+	m := &Machine{
+		Handlers:     defaultHandlers,
+		Cfg:          Config{SocketPath: socketPath},
+		process:      process,
+		lifecycleCtx: context.Background(),
+		exitCh:       make(chan struct{}),
+		shutdownCh:   make(chan struct{}),
+		cleanupCh:    make(chan struct{}),
+	}
+	// the VMM is already running, so it must never be started again
+	m.startOnce.Do(func() {})
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if m.logger == nil {
+		m.logger = log.NewEntry(log.New())
+	}
+
+	if m.client == nil {
+		m.client = NewClient(socketPath, m.logger, false)
+	}
+
+	m.logger.Debug("Called AttachMachine()")
+
+	state, err := m.restoreConfig(ctx)
+	if err != nil {
+		unix.Close(pidfd)
+		return nil, err
+	}
+
+	m.registerAttachedCleanup()
+	m.setState(state, nil)
+	m.watchAttachedVMM(pidfd)
+	m.stopOnLifecycleDone()
+
+	return m, nil
+}
+
+// restoreConfig rebuilds the Machine's Cfg from the configuration reported by
+// the running VMM and returns the lifecycle state the VMM is in.
+func (m *Machine) restoreConfig(ctx context.Context) (MachineState, error) {
+	info, err := m.client.GetInstanceInfo(ctx)
+	if err != nil {
+		return StateCreated, fmt.Errorf("failed to get instance info: %w", err)
+	}
+
+	exported, err := m.client.GetExportVMConfig(func(params *ops.GetExportVMConfigParams) {
+		params.SetContext(ctx)
+	})
+	if err != nil {
+		return StateCreated, fmt.Errorf("failed to export VM config: %w", err)
+	}
+
+	cfg := ConfigFromFullVMConfiguration(exported.Payload)
+	cfg.SocketPath = m.Cfg.SocketPath
+	cfg.VMID = StringValue(info.Payload.ID)
+	cfg.DisableValidation = true
+
+	// Firecracker does not distinguish between logging to a file and to a FIFO
+	if isFifo(cfg.LogPath) {
+		cfg.LogFifo, cfg.LogPath = cfg.LogPath, ""
+	}
+	if isFifo(cfg.MetricsPath) {
+		cfg.MetricsFifo, cfg.MetricsPath = cfg.MetricsPath, ""
+	}
+
+	if m.recoveredState != nil {
+		cfg.NetNS = m.recoveredState.NetNS
+	}
+
+	m.Cfg = cfg
+	m.machineConfig = cfg.MachineCfg
+
+	switch StringValue(info.Payload.State) {
+	case models.InstanceInfoStateRunning:
+		return StateRunning, nil
+	case models.InstanceInfoStatePaused:
+		return StatePaused, nil
+	default:
+		// the instance was not started, and the SDK will not start it
+		return StateCreated, nil
+	}
+}
+
+// registerAttachedCleanup registers the cleanup of the resources the SDK would
+// have cleaned up had it started the VMM itself. Without a state record, only
+// the files Firecracker itself was configured with are removed, as nothing
+// tells whether any other resource belongs to the SDK.
+func (m *Machine) registerAttachedCleanup() {
+	if record := m.recoveredState; record != nil {
+		if record.path != "" {
+			path := record.path
+			m.cleanupFuncs = append(m.cleanupFuncs, func() error {
+				if err := os.Remove(path); !os.IsNotExist(err) {
+					return err
+				}
+				return nil
+			})
+		}
+		m.cleanupFuncs = append(m.cleanupFuncs, record.cleanupFuncs(context.Background())...)
+		return
+	}
+
+	socketPath := m.Cfg.SocketPath
+	m.cleanupFuncs = append(m.cleanupFuncs, func() error {
+		if err := os.Remove(socketPath); !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+
+	for _, fifoPath := range []string{m.Cfg.LogFifo, m.Cfg.MetricsFifo} {
+		if fifoPath == "" {
+			continue
+		}
+
+		fifoPath := fifoPath
+		m.cleanupFuncs = append(m.cleanupFuncs, func() error {
+			if err := os.Remove(fifoPath); !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		})
+	}
+}
+
+// watchAttachedVMM waits for the attached VMM to exit and then runs the
+// cleanup, taking over the role of the cmd.Wait goroutine in startVMM.
+func (m *Machine) watchAttachedVMM(pidfd int) {
+	go func() {
+		waitErr := waitPidfd(pidfd)
+		unix.Close(pidfd)
+
+		if waitErr != nil {
+			m.logger.Warnf("failed to wait for firecracker: %v", waitErr)
+		} else {
+			m.logger.Printf("firecracker exited")
+		}
+
+		cleanupErr := m.doCleanup()
+		if cleanupErr != nil {
+			m.logger.Errorf("failed to cleanup after VM exit: %v", cleanupErr)
+		}
+
+		// the exit status of a process that is not our child is unknown
+		m.recordExit(nil, waitErr, cleanupErr)
+		m.setState(StateExited, nil)
+
+		m.fatalErr = multierror.Append(waitErr, cleanupErr).ErrorOrNil()
+		close(m.exitCh)
+		close(m.cleanupCh)
+	}()
+}
+
+// waitPidfd blocks until the process referred to by the pidfd has exited.
+func waitPidfd(pidfd int) error {
+	fds := []unix.PollFd{{Fd: int32(pidfd), Events: unix.POLLIN}}
+	for {
+		_, err := unix.Poll(fds, -1)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		return err
+	}
+}
+
+func isFifo(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode()&os.ModeNamedPipe != 0
+}
@@ -0,0 +1,146 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+func TestAttachMachine(t *testing.T) {
+	socketPath, cleanup := makeSocketPath(t)
+	defer cleanup()
+
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	logFifo := filepath.Join(filepath.Dir(socketPath), "log.fifo")
+	require.NoError(t, syscall.Mkfifo(logFifo, 0700))
+
+	// stands in for a firecracker process started by someone else
+	cmd := exec.Command("sleep", "60")
+	require.NoError(t, cmd.Start())
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	defer cmd.Process.Kill()
+
+	mockClient := fctesting.MockClient{
+		DescribeInstanceFn: func(params *ops.DescribeInstanceParams) (*ops.DescribeInstanceOK, error) {
+			return &ops.DescribeInstanceOK{Payload: &models.InstanceInfo{
+				ID:    String("attached-vm"),
+				State: String(models.InstanceInfoStatePaused),
+			}}, nil
+		},
+		GetExportVMConfigFn: func(params *ops.GetExportVMConfigParams) (*ops.GetExportVMConfigOK, error) {
+			return &ops.GetExportVMConfigOK{Payload: &models.FullVMConfiguration{
+				MachineConfig: &models.MachineConfiguration{VcpuCount: Int64(1), MemSizeMib: Int64(128)},
+				Logger:        &models.Logger{LogPath: String(logFifo)},
+			}}, nil
+		},
+	}
+
+	ctx := context.Background()
+	m, err := AttachMachine(ctx, socketPath, cmd.Process.Pid,
+		WithClient(NewClient(socketPath, nil, false, WithOpsClient(&mockClient))),
+		WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "attached-vm", m.Cfg.VMID)
+	assert.Equal(t, socketPath, m.Cfg.SocketPath)
+	assert.Equal(t, logFifo, m.Cfg.LogFifo)
+	assert.Empty(t, m.Cfg.LogPath)
+	assert.Equal(t, int64(128), Int64Value(m.Cfg.MachineCfg.MemSizeMib))
+	assert.Equal(t, StatePaused, m.State())
+	assert.Equal(t, ErrAlreadyStarted, m.Start(ctx))
+
+	pid, err := m.PID()
+	require.NoError(t, err)
+	assert.Equal(t, cmd.Process.Pid, pid)
+
+	require.NoError(t, m.ResumeVM(ctx))
+	assert.Equal(t, StateRunning, m.State())
+
+	require.NoError(t, m.StopVMM())
+	<-exited
+	require.NoError(t, m.Wait(ctx))
+	assert.Equal(t, StateExited, m.State())
+
+	_, err = m.PID()
+	assert.Error(t, err)
+
+	_, err = os.Stat(socketPath)
+	assert.True(t, os.IsNotExist(err), "expected the socket to be removed, got %v", err)
+	_, err = os.Stat(logFifo)
+	assert.True(t, os.IsNotExist(err), "expected the log fifo to be removed, got %v", err)
+}
+
+func TestAttachMachineNotStarted(t *testing.T) {
+	socketPath, cleanup := makeSocketPath(t)
+	defer cleanup()
+
+	cmd := exec.Command("sleep", "60")
+	require.NoError(t, cmd.Start())
+	defer cmd.Process.Kill()
+
+	mockClient := fctesting.MockClient{
+		DescribeInstanceFn: func(params *ops.DescribeInstanceParams) (*ops.DescribeInstanceOK, error) {
+			return &ops.DescribeInstanceOK{Payload: &models.InstanceInfo{
+				ID:    String("attached-vm"),
+				State: String(models.InstanceInfoStateNotStarted),
+			}}, nil
+		},
+		GetExportVMConfigFn: func(params *ops.GetExportVMConfigParams) (*ops.GetExportVMConfigOK, error) {
+			return &ops.GetExportVMConfigOK{Payload: &models.FullVMConfiguration{}}, nil
+		},
+	}
+
+	ctx := context.Background()
+	m, err := AttachMachine(ctx, socketPath, cmd.Process.Pid,
+		WithClient(NewClient(socketPath, nil, false, WithOpsClient(&mockClient))),
+		WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, StateCreated, m.State())
+
+	events := m.Subscribe(ctx)
+	require.NoError(t, m.StopVMM())
+	require.NoError(t, m.Wait(ctx))
+	assert.Equal(t, []MachineState{StateStopping, StateExited}, receiveStates(t, events, 2))
+}
+
+func TestAttachMachineNoProcess(t *testing.T) {
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Run())
+
+	_, err := AttachMachine(context.Background(), "/path/to/socket", cmd.Process.Pid,
+		WithLogger(fctesting.NewLogEntry(t)))
+	assert.Error(t, err)
+}
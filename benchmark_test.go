@@ -28,7 +28,7 @@ import (
 
 const numberOfVMs = 200
 
-func createMachine(ctx context.Context, name string, forwardSignals []os.Signal) (*Machine, func(), error) {
+func createMachine(ctx context.Context, name string, forwardSignals []os.Signal, configFile bool) (*Machine, func(), error) {
 	dir, err := os.MkdirTemp("", name)
 	if err != nil {
 		return nil, nil, err
@@ -71,7 +71,11 @@ func createMachine(ctx context.Context, name string, forwardSignals []os.Signal)
 
 	log := logrus.New()
 	log.SetLevel(logrus.FatalLevel)
-	machine, err := NewMachine(ctx, config, WithProcessRunner(cmd), WithLogger(logrus.NewEntry(log)))
+	opts := []Opt{WithProcessRunner(cmd), WithLogger(logrus.NewEntry(log))}
+	if configFile {
+		opts = append(opts, WithConfigFile(filepath.Join(dir, "vm.json")))
+	}
+	machine, err := NewMachine(ctx, config, opts...)
 	if err != nil {
 		return nil, cleanup, err
 	}
@@ -122,7 +126,7 @@ func benchmarkForwardSignals(b *testing.B, forwardSignals []os.Signal) {
 				var err error
 				defer func() { errCh <- err }()
 
-				machine, cleanup, err := createMachine(ctx, b.Name(), forwardSignals)
+				machine, cleanup, err := createMachine(ctx, b.Name(), forwardSignals, false)
 				if err != nil {
 					err = fmt.Errorf("failed to create a VM: %v", err)
 					return // anonymous defer func() will deliver the error
@@ -153,3 +157,28 @@ func BenchmarkForwardSignalsDefault(t *testing.B) {
 func BenchmarkForwardSignalsDisable(t *testing.B) {
 	benchmarkForwardSignals(t, []os.Signal{})
 }
+
+func benchmarkBoot(b *testing.B, configFile bool) {
+	ctx := context.Background()
+
+	for i := 0; i < b.N; i++ {
+		machine, cleanup, err := createMachine(ctx, b.Name(), nil, configFile)
+		if err != nil {
+			b.Fatalf("failed to create a VM: %v", err)
+		}
+
+		err = startAndWaitVM(ctx, machine)
+		cleanup()
+		if err != nil && !strings.Contains(err.Error(), "signal: terminated") {
+			b.Fatalf("failed to start the VM: %v", err)
+		}
+	}
+}
+
+func BenchmarkBootAPI(b *testing.B) {
+	benchmarkBoot(b, false)
+}
+
+func BenchmarkBootConfigFile(b *testing.B) {
+	benchmarkBoot(b, true)
+}
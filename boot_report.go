@@ -0,0 +1,175 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// bootTimerLine matches the line logged by Firecracker, when started with
+// --boot-timer, once the guest signaled the end of its boot, such as
+//
+//	2023-10-13T09:12:56.497838811 [vm:fc_vcpu 0] Guest-boot-time =  36283 us 36 ms,  34741 CPU us 34 CPU ms
+var bootTimerLine = regexp.MustCompile(`^(\S+)\s.*Guest-boot-time\s*=\s*(\d+)\s*us`)
+
+// bootTimerTimestamp is the layout of the timestamps of the Firecracker log,
+// which are in local time.
+const bootTimerTimestamp = "2006-01-02T15:04:05.999999999"
+
+// BootStep is a handler run while starting a Machine.
+type BootStep struct {
+	// HandlerName is the name of the handler.
+	HandlerName string
+	// Start is when the handler was called.
+	Start time.Time
+	// Duration is the time spent in the handler.
+	Duration time.Duration
+	// Err is the error returned by the handler, if any.
+	Err error
+}
+
+// BootReport is the timeline of the start of a Machine.
+type BootReport struct {
+	// Steps are the handlers of the Validation and FcInit lists, in the
+	// order they were started.
+	Steps []BootStep
+	// SocketWait is the time between the start of the VMM and the moment its
+	// API socket was ready, or 0 if it was not waited for.
+	SocketWait time.Duration
+	// GuestBootTime is the boot time of the guest measured by Firecracker, or
+	// 0 if it is unknown. It is only available when Config.BootTimer is set
+	// and the log is written to LogPath, or to LogFifo with a FifoLogWriter.
+	GuestBootTime time.Duration
+	// GuestBootCompleted is when the guest signaled the end of its boot, or
+	// the zero time if it is unknown.
+	GuestBootCompleted time.Time
+}
+
+// bootRecorder collects the BootReport of a Machine.
+type bootRecorder struct {
+	mu     sync.Mutex
+	report BootReport
+	// partial is the unterminated line of the log written so far
+	partial []byte
+}
+
+func (r *bootRecorder) addStep(step BootStep) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report.Steps = append(r.report.Steps, step)
+}
+
+func (r *bootRecorder) setSocketWait(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report.SocketWait = d
+}
+
+// Write scans the Firecracker log for the line of the boot timer.
+func (r *bootRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.report.GuestBootCompleted.IsZero() {
+		return len(p), nil
+	}
+
+	data := append(r.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		if r.parseLine(data[:i]) {
+			data = nil
+			break
+		}
+		data = data[i+1:]
+	}
+	r.partial = append([]byte(nil), data...)
+
+	return len(p), nil
+}
+
+// parseLine records the guest boot time if line is the one of the boot
+// timer.
+func (r *bootRecorder) parseLine(line []byte) bool {
+	match := bootTimerLine.FindSubmatch(line)
+	if match == nil {
+		return false
+	}
+
+	us, err := strconv.ParseInt(string(match[2]), 10, 64)
+	if err != nil {
+		return false
+	}
+	completed, err := time.ParseInLocation(bootTimerTimestamp, string(match[1]), time.Local)
+	if err != nil {
+		// the log was configured without timestamps
+		completed = time.Now()
+	}
+
+	r.report.GuestBootTime = time.Duration(us) * time.Microsecond
+	r.report.GuestBootCompleted = completed
+	return true
+}
+
+// scanFile looks for the line of the boot timer in the log file at path.
+func (r *bootRecorder) scanFile(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err != nil || !info.Mode().IsRegular() {
+		return
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if r.parseLine(scanner.Bytes()) {
+			return
+		}
+	}
+}
+
+// BootReport returns the timeline of the start of the machine: the duration
+// of each handler, the time until the API socket of the VMM was ready and,
+// when Firecracker is started with Config.BootTimer, the boot time of the
+// guest. It can be called once Start returned, whether it succeeded or not.
+func (m *Machine) BootReport() BootReport {
+	m.boot.mu.Lock()
+	defer m.boot.mu.Unlock()
+
+	if m.boot.report.GuestBootCompleted.IsZero() && m.Cfg.BootTimer &&
+		len(m.Cfg.LogFifo) == 0 && len(m.Cfg.LogPath) > 0 {
+		m.boot.scanFile(m.Cfg.LogPath)
+	}
+
+	report := m.boot.report
+	report.Steps = append([]BootStep(nil), report.Steps...)
+	// handlers running concurrently complete in any order
+	sort.SliceStable(report.Steps, func(i, j int) bool {
+		return report.Steps[i].Start.Before(report.Steps[j].Start)
+	})
+	return report
+}
@@ -0,0 +1,116 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBootTimerLog = "2023-10-13T09:12:56.461555427 [traced-vm:main] Running Firecracker v1.4.1\n" +
+	"2023-10-13T09:12:56.497838811 [traced-vm:fc_vcpu 0] Guest-boot-time =  36283 us 36 ms,  34741 CPU us 34 CPU ms\n"
+
+func TestBootReport(t *testing.T) {
+	m := newLifecycleTestMachine(t)
+	m.Handlers.Validation = HandlerList{}.Append(Handler{
+		Name: "test.Validate",
+		Fn:   func(ctx context.Context, m *Machine) error { return nil },
+	})
+	m.Cfg.DisableValidation = false
+	m.Handlers.FcInit = m.Handlers.FcInit.Append(Handler{
+		Name: "test.SlowCNI",
+		Fn: func(ctx context.Context, m *Machine) error {
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		},
+	})
+
+	before := time.Now()
+	require.NoError(t, m.Start(context.Background()))
+	defer m.Close()
+
+	report := m.BootReport()
+	require.Len(t, report.Steps, 3)
+	for i, name := range []string{"test.Validate", StartVMMHandlerName, "test.SlowCNI"} {
+		step := report.Steps[i]
+		assert.Equal(t, name, step.HandlerName)
+		assert.False(t, step.Start.Before(before), "steps must be in order")
+		assert.NoError(t, step.Err)
+		before = step.Start.Add(step.Duration)
+	}
+	assert.GreaterOrEqual(t, report.Steps[2].Duration, 10*time.Millisecond)
+	assert.Greater(t, report.SocketWait, time.Duration(0))
+	assert.LessOrEqual(t, report.SocketWait, report.Steps[1].Duration)
+	assert.Zero(t, report.GuestBootTime)
+}
+
+func TestBootReportFailedStep(t *testing.T) {
+	m := newLifecycleTestMachine(t)
+	errCNI := errors.New("CNI timed out")
+	m.Handlers.FcInit = m.Handlers.FcInit.Append(Handler{
+		Name: "test.CNI",
+		Fn:   func(ctx context.Context, m *Machine) error { return errCNI },
+	})
+
+	assert.Equal(t, errCNI, m.Start(context.Background()))
+	report := m.BootReport()
+	require.Len(t, report.Steps, 2)
+	assert.Equal(t, "test.CNI", report.Steps[1].HandlerName)
+	assert.Equal(t, errCNI, report.Steps[1].Err)
+}
+
+func TestBootTimerFromLog(t *testing.T) {
+	completed, err := time.ParseInLocation(bootTimerTimestamp, "2023-10-13T09:12:56.497838811", time.Local)
+	require.NoError(t, err)
+
+	t.Run("fifo", func(t *testing.T) {
+		var r bootRecorder
+		// the log is written in arbitrary chunks
+		for _, chunk := range []string{testBootTimerLog[:70], testBootTimerLog[70:130], testBootTimerLog[130:]} {
+			n, err := r.Write([]byte(chunk))
+			require.NoError(t, err)
+			assert.Equal(t, len(chunk), n)
+		}
+		assert.Equal(t, 36283*time.Microsecond, r.report.GuestBootTime)
+		assert.True(t, completed.Equal(r.report.GuestBootCompleted))
+	})
+
+	t.Run("file", func(t *testing.T) {
+		logPath := filepath.Join(t.TempDir(), "firecracker.log")
+		require.NoError(t, os.WriteFile(logPath, []byte(testBootTimerLog), 0600))
+
+		m := &Machine{Cfg: Config{LogPath: logPath}}
+		assert.Zero(t, m.BootReport().GuestBootTime, "the log is only scanned with BootTimer")
+
+		m.Cfg.BootTimer = true
+		report := m.BootReport()
+		assert.Equal(t, 36283*time.Microsecond, report.GuestBootTime)
+		assert.True(t, completed.Equal(report.GuestBootCompleted))
+	})
+}
+
+func TestBootTimerArgs(t *testing.T) {
+	cmd := configureBuilder(VMCommandBuilder{}, Config{SocketPath: "/tmp/fc.sock", VMID: "vm", BootTimer: true}).Build(context.Background())
+	assert.Contains(t, cmd.Args, "--boot-timer")
+
+	cmd = configureBuilder(VMCommandBuilder{}, Config{SocketPath: "/tmp/fc.sock", VMID: "vm"}).Build(context.Background())
+	assert.NotContains(t, cmd.Args, "--boot-timer")
+}
@@ -0,0 +1,272 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+)
+
+// Capability is a feature of Firecracker that only some of its versions
+// support.
+type Capability string
+
+// Capabilities the SDK knows about.
+const (
+	// CapabilityBalloon is the memory balloon device.
+	CapabilityBalloon Capability = "balloon"
+	// CapabilityDiffSnapshots is the tracking of dirty pages and the creation
+	// of diff snapshots.
+	CapabilityDiffSnapshots Capability = "diff-snapshots"
+	// CapabilityMMDSv2 is version 2 of the microVM metadata service.
+	CapabilityMMDSv2 Capability = "mmds-v2"
+	// CapabilityDriveIoEngine is the io_engine field of drives.
+	CapabilityDriveIoEngine Capability = "drive-io-engine"
+	// CapabilityUffdBackend is loading snapshots through a userfaultfd
+	// memory backend.
+	CapabilityUffdBackend Capability = "uffd-backend"
+)
+
+// capabilityVersions lists the first version of Firecracker supporting each
+// capability.
+var capabilityVersions = map[Capability]FirecrackerVersion{
+	CapabilityBalloon:       {Major: 0, Minor: 24},
+	CapabilityDiffSnapshots: {Major: 0, Minor: 24},
+	CapabilityMMDSv2:        {Major: 1, Minor: 0},
+	CapabilityDriveIoEngine: {Major: 1, Minor: 0},
+	CapabilityUffdBackend:   {Major: 1, Minor: 1},
+}
+
+// FirecrackerVersion is the version of a Firecracker binary.
+type FirecrackerVersion struct {
+	Major, Minor, Patch int
+}
+
+// ParseFirecrackerVersion parses versions such as the "1.4.1" reported by the
+// API, or the "Firecracker v1.4.1" printed by firecracker --version.
+// Pre-release suffixes such as "-dev" are ignored.
+func ParseFirecrackerVersion(s string) (FirecrackerVersion, error) {
+	v := strings.TrimSpace(s)
+	v = strings.TrimPrefix(v, "Firecracker ")
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+ "); i >= 0 {
+		v = v[:i]
+	}
+
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return FirecrackerVersion{}, fmt.Errorf("invalid Firecracker version %q", s)
+	}
+
+	var nums [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return FirecrackerVersion{}, fmt.Errorf("invalid Firecracker version %q", s)
+		}
+		nums[i] = n
+	}
+
+	return FirecrackerVersion{Major: nums[0], Minor: nums[1], Patch: nums[2]}, nil
+}
+
+func (v FirecrackerVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less reports whether v is older than other.
+func (v FirecrackerVersion) Less(other FirecrackerVersion) bool {
+	if v.Major != other.Major {
+		return v.Major < other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor < other.Minor
+	}
+	return v.Patch < other.Patch
+}
+
+// Capabilities is the set of features supported by a Firecracker binary.
+type Capabilities map[Capability]bool
+
+// CapabilitiesForVersion returns the capabilities of the given version of
+// Firecracker.
+func CapabilitiesForVersion(version FirecrackerVersion) Capabilities {
+	caps := Capabilities{}
+	for c, since := range capabilityVersions {
+		if !version.Less(since) {
+			caps[c] = true
+		}
+	}
+	return caps
+}
+
+// Has reports whether the capability is supported. A nil set is treated as
+// unknown and supports everything.
+func (c Capabilities) Has(capability Capability) bool {
+	return c == nil || c[capability]
+}
+
+// UnsupportedCapabilityError is returned when a feature is used that the
+// Firecracker binary does not support.
+type UnsupportedCapabilityError struct {
+	Capability Capability
+}
+
+func (e *UnsupportedCapabilityError) Error() string {
+	if since, ok := capabilityVersions[e.Capability]; ok {
+		return fmt.Sprintf("%s requires Firecracker %s or later", e.Capability, since)
+	}
+	return fmt.Sprintf("%s is not supported by this Firecracker", e.Capability)
+}
+
+// require returns an UnsupportedCapabilityError if the capability is not
+// supported.
+func (c Capabilities) require(capability Capability) error {
+	if c.Has(capability) {
+		return nil
+	}
+	return &UnsupportedCapabilityError{Capability: capability}
+}
+
+// validateCapabilities reports the features of the Config that the
+// Firecracker binary does not support.
+func (cfg *Config) validateCapabilities(v *validator) {
+	caps := cfg.Capabilities
+	if caps == nil {
+		return
+	}
+
+	check := func(field string, capability Capability) {
+		if err := caps.require(capability); err != nil {
+			v.add(field, err)
+		}
+	}
+
+	if cfg.MmdsVersion == MMDSv2 {
+		check("MmdsVersion", CapabilityMMDSv2)
+	}
+	if BoolValue(cfg.MachineCfg.TrackDirtyPages) {
+		check("MachineCfg.TrackDirtyPages", CapabilityDiffSnapshots)
+	}
+	for i, drive := range cfg.Drives {
+		if drive.IoEngine != nil {
+			check(fmt.Sprintf("Drives[%d].IoEngine", i), CapabilityDriveIoEngine)
+		}
+	}
+	if cfg.Balloon != nil {
+		check("Balloon", CapabilityBalloon)
+	}
+	if cfg.Snapshot.EnableDiffSnapshots {
+		check("Snapshot.EnableDiffSnapshots", CapabilityDiffSnapshots)
+	}
+	if backend := cfg.Snapshot.MemBackend; backend != nil && StringValue(backend.BackendType) == models.MemoryBackendBackendTypeUffd {
+		check("Snapshot.MemBackend", CapabilityUffdBackend)
+	}
+}
+
+// DetectFirecrackerVersion runs the firecracker binary with --version and
+// parses its output.
+func DetectFirecrackerVersion(ctx context.Context, binary string) (FirecrackerVersion, error) {
+	out, err := exec.CommandContext(ctx, binary, "--version").Output()
+	if err != nil {
+		return FirecrackerVersion{}, fmt.Errorf("failed to run %s --version: %w", binary, err)
+	}
+
+	// The version is followed by the supported snapshot versions.
+	firstLine, _, _ := strings.Cut(string(out), "\n")
+	return ParseFirecrackerVersion(firstLine)
+}
+
+// VersionSource is where WithCapabilityDetection reads the version of
+// Firecracker from.
+type VersionSource int
+
+const (
+	// VersionFromBinary runs the firecracker binary with --version before the
+	// VMM is launched. This is the only source available to machines started
+	// with WithConfigFile.
+	VersionFromBinary VersionSource = iota
+	// VersionFromAPI queries the API once the VMM is started, before it is
+	// configured.
+	VersionFromAPI
+)
+
+// WithCapabilityDetection detects the version of Firecracker when the machine
+// starts and sets Config.Capabilities accordingly, so that features the
+// binary does not support are refused before any API call is made.
+//
+// VersionFromBinary runs the firecracker binary of the VMCommandBuilder or
+// JailerConfig.ExecFile. It does not work with a process runner launching
+// something else, in which case VersionFromAPI can be used instead.
+func WithCapabilityDetection(source VersionSource) Opt {
+	return func(m *Machine) {
+		if source == VersionFromAPI {
+			m.Handlers.FcInit = m.Handlers.FcInit.AppendAfter(StartVMMHandlerName, QueryCapabilitiesHandler)
+			return
+		}
+		m.Handlers.Validation = m.Handlers.Validation.Prepend(DetectCapabilitiesHandler)
+	}
+}
+
+// DetectCapabilitiesHandler is a named handler that sets Config.Capabilities
+// from the output of firecracker --version. It is the first validation
+// handler, so that the following ones check the capabilities.
+var DetectCapabilitiesHandler = Handler{
+	Name: DetectCapabilitiesHandlerName,
+	Fn: func(ctx context.Context, m *Machine) error {
+		binary := m.cmd.Path
+		if m.Cfg.JailerCfg != nil {
+			binary = m.Cfg.JailerCfg.ExecFile
+		}
+
+		version, err := DetectFirecrackerVersion(ctx, binary)
+		if err != nil {
+			return err
+		}
+
+		m.logger.Debugf("Detected Firecracker %s", version)
+		m.Cfg.Capabilities = CapabilitiesForVersion(version)
+		return nil
+	},
+}
+
+// QueryCapabilitiesHandler is a named handler that sets Config.Capabilities
+// from the version reported by the API, and checks the Config against them
+// since the validation handlers already ran.
+var QueryCapabilitiesHandler = Handler{
+	Name: QueryCapabilitiesHandlerName,
+	Fn: func(ctx context.Context, m *Machine) error {
+		resp, err := m.client.GetFirecrackerVersion(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get the Firecracker version: %w", err)
+		}
+
+		version, err := ParseFirecrackerVersion(StringValue(resp.Payload.FirecrackerVersion))
+		if err != nil {
+			return err
+		}
+
+		m.logger.Debugf("Detected Firecracker %s", version)
+		m.Cfg.Capabilities = CapabilitiesForVersion(version)
+
+		var v validator
+		m.Cfg.validateCapabilities(&v)
+		return v.err()
+	},
+}
@@ -0,0 +1,156 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+func TestParseFirecrackerVersion(t *testing.T) {
+	cases := []struct {
+		in      string
+		version FirecrackerVersion
+		err     bool
+	}{
+		{in: "1.4.1", version: FirecrackerVersion{1, 4, 1}},
+		{in: "Firecracker v1.5.0-dev\n", version: FirecrackerVersion{1, 5, 0}},
+		{in: "v0.25.2", version: FirecrackerVersion{0, 25, 2}},
+		{in: "1.4", err: true},
+		{in: "Firecracker vX.Y.Z", err: true},
+	}
+
+	for _, c := range cases {
+		version, err := ParseFirecrackerVersion(c.in)
+		if c.err {
+			assert.Error(t, err, c.in)
+			continue
+		}
+		assert.NoError(t, err, c.in)
+		assert.Equal(t, c.version, version, c.in)
+	}
+}
+
+func TestCapabilitiesForVersion(t *testing.T) {
+	caps := CapabilitiesForVersion(FirecrackerVersion{1, 0, 0})
+	assert.True(t, caps.Has(CapabilityMMDSv2))
+	assert.True(t, caps.Has(CapabilityDriveIoEngine))
+	assert.False(t, caps.Has(CapabilityUffdBackend))
+
+	assert.Empty(t, CapabilitiesForVersion(FirecrackerVersion{0, 23, 0}))
+
+	var unknown Capabilities
+	assert.True(t, unknown.Has(CapabilityUffdBackend))
+}
+
+func TestValidateCapabilities(t *testing.T) {
+	cfg := validTestConfig(t)
+	cfg.MmdsVersion = MMDSv2
+	cfg.Drives[0].IoEngine = String("Async")
+	balloon := NewBalloonDevice(64, true).Build()
+	cfg.Balloon = &balloon
+	require.NoError(t, cfg.Validate())
+
+	cfg.Capabilities = CapabilitiesForVersion(FirecrackerVersion{0, 25, 0})
+	err := cfg.Validate()
+
+	var errs ValidationErrors
+	require.True(t, errors.As(err, &errs), "unexpected error %v", err)
+	require.Len(t, errs, 2)
+
+	var unsupported *UnsupportedCapabilityError
+	require.True(t, errors.As(errs.Field("MmdsVersion"), &unsupported))
+	assert.Equal(t, CapabilityMMDSv2, unsupported.Capability)
+	assert.NotNil(t, errs.Field("Drives[0].IoEngine"))
+
+	cfg.Snapshot = SnapshotConfig{
+		SnapshotPath: cfg.KernelImagePath,
+		MemBackend:   &models.MemoryBackend{BackendType: String(models.MemoryBackendBackendTypeUffd), BackendPath: &cfg.KernelImagePath},
+	}
+	err = cfg.ValidateLoadSnapshot()
+	require.True(t, errors.As(err, &errs), "unexpected error %v", err)
+	assert.NotNil(t, errs.Field("Snapshot.MemBackend"))
+}
+
+func TestDetectFirecrackerVersion(t *testing.T) {
+	binary := filepath.Join(t.TempDir(), "firecracker")
+	script := "#!/bin/sh\necho 'Firecracker v1.3.2'\necho\necho 'Supported snapshot data format versions: v1.0.0'\n"
+	require.NoError(t, os.WriteFile(binary, []byte(script), 0755))
+
+	version, err := DetectFirecrackerVersion(context.Background(), binary)
+	require.NoError(t, err)
+	assert.Equal(t, FirecrackerVersion{1, 3, 2}, version)
+
+	_, err = DetectFirecrackerVersion(context.Background(), filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestQueryCapabilitiesHandler(t *testing.T) {
+	var putBalloonCalled bool
+	client := &fctesting.MockClient{
+		GetFirecrackerVersionFn: func(params *ops.GetFirecrackerVersionParams) (*ops.GetFirecrackerVersionOK, error) {
+			return &ops.GetFirecrackerVersionOK{
+				Payload: &models.FirecrackerVersion{FirecrackerVersion: String("0.23.4")},
+			}, nil
+		},
+		PutBalloonFn: func(params *ops.PutBalloonParams) (*ops.PutBalloonNoContent, error) {
+			putBalloonCalled = true
+			return &ops.PutBalloonNoContent{}, nil
+		},
+	}
+
+	m, err := NewMachine(context.Background(), Config{
+		DisableValidation: true,
+		MmdsVersion:       MMDSv2,
+	},
+		WithClient(NewClient("/path/to/socket", nil, false, WithOpsClient(client))),
+		WithCapabilityDetection(VersionFromAPI),
+	)
+	require.NoError(t, err)
+	names := handlerNames(m.Handlers.FcInit)
+	for i, name := range names {
+		if name == StartVMMHandlerName {
+			assert.Equal(t, QueryCapabilitiesHandlerName, names[i+1])
+		}
+	}
+
+	err = QueryCapabilitiesHandler.Fn(context.Background(), m)
+	var errs ValidationErrors
+	require.True(t, errors.As(err, &errs), "unexpected error %v", err)
+	assert.NotNil(t, errs.Field("MmdsVersion"))
+
+	var unsupported *UnsupportedCapabilityError
+	err = m.CreateBalloon(context.Background(), 64, true, 0)
+	require.True(t, errors.As(err, &unsupported), "unexpected error %v", err)
+	assert.Equal(t, CapabilityBalloon, unsupported.Capability)
+	assert.False(t, putBalloonCalled)
+}
+
+func TestWithCapabilityDetectionFromBinary(t *testing.T) {
+	m, err := NewMachine(context.Background(), Config{DisableValidation: true},
+		WithCapabilityDetection(VersionFromBinary),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, DetectCapabilitiesHandlerName, handlerNames(m.Handlers.Validation)[0])
+}
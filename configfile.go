@@ -0,0 +1,183 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// configFile describes how a Machine created with WithConfigFile is launched.
+type configFile struct {
+	path  string
+	noAPI bool
+}
+
+// ConfigFileOpt configures how WithConfigFile launches the VMM.
+type ConfigFileOpt func(*configFile)
+
+// WithNoAPI additionally passes --no-api to firecracker, which then does not
+// serve its API socket at all. Starting the VMM no longer waits for the socket,
+// but Machine methods talking to the API, such as PauseVM, SetMetadata or
+// Shutdown, fail. Use StopVMM or a ShutdownPolicy without GraceTimeout to stop
+// such a VM.
+func WithNoAPI() ConfigFileOpt {
+	return func(c *configFile) {
+		c.noAPI = true
+	}
+}
+
+// WithConfigFile boots the VM from a configuration file instead of
+// configuring it through the API. The Config is rendered into a
+// models.FullVMConfiguration, written to path right before the VMM starts and
+// passed to firecracker with --config-file, so that firecracker boots the VM
+// on startup. The FcInit handlers issuing API calls are removed, which saves
+// a dozen round-trips per VM.
+//
+// When the jailer is used, the file is written to the root of the chroot
+// under the base name of path instead.
+//
+// Handlers relying on the API, such as the one returned by
+// NewCreateBalloonHandler, must not be added when WithNoAPI is used.
+// WithConfigFile cannot be combined with WithSnapshot.
+func WithConfigFile(path string, opts ...ConfigFileOpt) Opt {
+	return func(m *Machine) {
+		m.configFile = &configFile{path: path}
+		for _, opt := range opts {
+			opt(m.configFile)
+		}
+
+		m.Handlers.FcInit = modifyHandlersForConfigFile(m.Handlers.FcInit)
+	}
+}
+
+// When the machine boots from a configuration file, these handlers are
+// replaced by the file and must not run.
+var configFileRemoveHandlerList = []Handler{
+	BootstrapLoggingHandler,
+	CreateMachineHandler,
+	CreateBootSourceHandler,
+	AttachDrivesHandler,
+	CreateNetworkInterfacesHandler,
+	AddVsocksHandler,
+	ConfigMmdsHandler,
+	ConfigBalloonHandler,
+}
+
+// modifyHandlersForConfigFile removes the handlers configuring the VM through
+// the API and moves StartVMM to the end of the remaining setup, right after
+// WriteConfigFile: firecracker reads the configuration file and opens the log
+// and metrics files it references on startup.
+func modifyHandlersForConfigFile(l HandlerList) HandlerList {
+	for _, h := range configFileRemoveHandlerList {
+		l = l.Remove(h.Name)
+	}
+
+	startVMM := StartVMMHandler
+	for _, h := range l.list {
+		if h.Name == StartVMMHandlerName {
+			startVMM = h
+		}
+	}
+
+	return l.Remove(StartVMMHandlerName).
+		Remove(WriteConfigFileHandlerName).
+		Append(WriteConfigFileHandler, startVMM)
+}
+
+// WriteConfigFileHandler is a named handler that writes the configuration
+// file of a Machine created with WithConfigFile and passes it to firecracker.
+var WriteConfigFileHandler = Handler{
+	Name: WriteConfigFileHandlerName,
+	Fn: func(ctx context.Context, m *Machine) error {
+		return m.writeConfigFile()
+	},
+}
+
+// writeConfigFile renders the Config into the configuration file and adds the
+// arguments pointing firecracker at it.
+func (m *Machine) writeConfigFile() error {
+	data, err := m.renderConfigFile()
+	if err != nil {
+		return err
+	}
+
+	hostPath, argPath := m.configFilePaths()
+	if err := os.WriteFile(hostPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write the configuration file: %w", err)
+	}
+	m.RegisterCleanup(func() error {
+		if err := os.Remove(hostPath); !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+
+	if m.Cfg.JailerCfg != nil {
+		if err := os.Chown(hostPath, *m.Cfg.JailerCfg.UID, *m.Cfg.JailerCfg.GID); err != nil {
+			return err
+		}
+	}
+
+	m.addConfigFileArgs(argPath)
+
+	m.logger.Debugf("Wrote VM configuration to %s", hostPath)
+	return nil
+}
+
+// renderConfigFile returns the content of the configuration file.
+func (m *Machine) renderConfigFile() ([]byte, error) {
+	if m.configFile == nil {
+		return nil, errors.New("no configuration file was set with WithConfigFile")
+	}
+
+	if m.Cfg.hasSnapshot() {
+		return nil, errors.New("a snapshot cannot be loaded from a configuration file")
+	}
+
+	vmCfg, err := m.Cfg.ToFullVMConfiguration()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(vmCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the VM configuration: %w", err)
+	}
+	return data, nil
+}
+
+// configFilePaths returns where the configuration file is written on the
+// host, and the path firecracker is given to read it.
+func (m *Machine) configFilePaths() (hostPath, argPath string) {
+	hostPath, argPath = m.configFile.path, m.configFile.path
+	if m.Cfg.JailerCfg != nil {
+		// jailed firecracker resolves the path relative to the chroot
+		argPath = filepath.Base(m.configFile.path)
+		hostPath = filepath.Join(jailerRootfs(m.Cfg.JailerCfg), argPath)
+	}
+	return hostPath, argPath
+}
+
+// addConfigFileArgs points firecracker at the configuration file.
+func (m *Machine) addConfigFileArgs(argPath string) {
+	m.cmd.Args = append(m.cmd.Args, "--config-file", argPath)
+	if m.configFile.noAPI {
+		m.cmd.Args = append(m.cmd.Args, "--no-api")
+	}
+}
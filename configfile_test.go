@@ -0,0 +1,95 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+func handlerNames(l HandlerList) []string {
+	var names []string
+	for _, h := range l.list {
+		names = append(names, h.Name)
+	}
+	return names
+}
+
+func TestWithConfigFileHandlers(t *testing.T) {
+	m, err := NewMachine(context.Background(), Config{}, WithConfigFile("/tmp/vm.json"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{
+		SetupNetworkHandlerName,
+		SetupKernelArgsHandlerName,
+		CreateLogFilesHandlerName,
+		WriteConfigFileHandlerName,
+		StartVMMHandlerName,
+	}, handlerNames(m.Handlers.FcInit))
+}
+
+func TestStartWithConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "vm.json")
+
+	client := &fctesting.MockClient{
+		PutMachineConfigurationFn: func(params *ops.PutMachineConfigurationParams) (*ops.PutMachineConfigurationNoContent, error) {
+			t.Error("unexpected API call in config file mode")
+			return &ops.PutMachineConfigurationNoContent{}, nil
+		},
+		CreateSyncActionFn: func(params *ops.CreateSyncActionParams) (*ops.CreateSyncActionNoContent, error) {
+			t.Error("unexpected API call in config file mode")
+			return &ops.CreateSyncActionNoContent{}, nil
+		},
+	}
+
+	// sh ignores the arguments appended to the command
+	m, err := NewMachine(context.Background(),
+		Config{
+			SocketPath:        filepath.Join(dir, "fc.sock"),
+			KernelImagePath:   "/vmlinux",
+			DisableValidation: true,
+		},
+		WithClient(NewClient(filepath.Join(dir, "fc.sock"), nil, false, WithOpsClient(client))),
+		WithProcessRunner(exec.Command("sh", "-c", "sleep 60")),
+		WithLogger(fctesting.NewLogEntry(t)),
+		WithConfigFile(configPath, WithNoAPI()),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, m.Start(context.Background()))
+	assert.Equal(t, StateRunning, m.State())
+	assert.Equal(t, []string{"--config-file", configPath, "--no-api"}, m.cmd.Args[len(m.cmd.Args)-3:])
+
+	data, err := os.ReadFile(configPath)
+	require.NoError(t, err)
+	var vmCfg models.FullVMConfiguration
+	require.NoError(t, json.Unmarshal(data, &vmCfg))
+	assert.Equal(t, "/vmlinux", StringValue(vmCfg.BootSource.KernelImagePath))
+
+	require.NoError(t, m.StopVMM())
+	_, err = os.Stat(configPath)
+	assert.True(t, os.IsNotExist(err), "expected the configuration file to be removed, got %v", err)
+}
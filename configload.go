@@ -0,0 +1,756 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-multierror"
+	"gopkg.in/yaml.v3"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+)
+
+// ConfigSchemaVersion is the version of the configuration file schema
+// understood by LoadConfig and ParseConfig. See docs/config-file.md.
+const ConfigSchemaVersion = 1
+
+// ConfigFileError reports a problem with a field of a configuration file.
+// LoadConfig and ParseConfig return all of them at once, aggregated in a
+// *multierror.Error.
+type ConfigFileError struct {
+	// Field is the path of the field in the file, such as drives[1].path.
+	Field string
+	// Line is the line of the field in the file, or 0 if unknown.
+	Line int
+	Err  error
+}
+
+func (e *ConfigFileError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %v", e.Line, e.Field, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+func (e *ConfigFileError) Unwrap() error {
+	return e.Err
+}
+
+// LoadConfig reads a Config from a YAML or JSON file following the schema
+// documented in docs/config-file.md.
+func LoadConfig(path string) (Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+	defer f.Close()
+
+	cfg, err := ParseConfig(f)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseConfig reads a Config from a YAML or JSON document following the
+// schema documented in docs/config-file.md.
+//
+// References to environment variables in values are replaced before the
+// values are interpreted: ${NAME} is replaced by the value of NAME, which must
+// be set, ${NAME:-default} falls back to default if NAME is unset or empty,
+// and ${NAME:?message} fails with message in that case. $$ stands for a
+// literal dollar sign.
+func ParseConfig(r io.Reader) (Config, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return Config{}, fmt.Errorf("failed to parse the configuration: %w", err)
+	}
+	if len(doc.Content) == 0 {
+		return Config{}, errors.New("the configuration is empty")
+	}
+
+	d := &configDecoder{
+		lookupEnv: os.LookupEnv,
+		lines:     map[string]int{},
+	}
+
+	var file fileConfig
+	d.decode(doc.Content[0], reflect.ValueOf(&file).Elem(), "")
+	if err := d.errs.ErrorOrNil(); err != nil {
+		return Config{}, err
+	}
+
+	cfg := d.config(&file)
+	if err := d.errs.ErrorOrNil(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// The types below define the schema of configuration files. Pointers are used
+// wherever the zero value is valid but differs from the default.
+
+type fileConfig struct {
+	Version           int                    `yaml:"version"`
+	VMID              string                 `yaml:"vmid"`
+	SocketPath        string                 `yaml:"socket_path"`
+	NetNS             string                 `yaml:"netns"`
+	Kernel            fileKernel             `yaml:"kernel"`
+	Machine           fileMachine            `yaml:"machine"`
+	Drives            []fileDrive            `yaml:"drives"`
+	NetworkInterfaces []fileNetworkInterface `yaml:"network_interfaces"`
+	Vsock             []fileVsock            `yaml:"vsock"`
+	MMDS              *fileMMDS              `yaml:"mmds"`
+	Log               fileLog                `yaml:"log"`
+	Metrics           fileMetrics            `yaml:"metrics"`
+	Seccomp           fileSeccomp            `yaml:"seccomp"`
+	Balloon           *fileBalloon           `yaml:"balloon"`
+	Snapshot          *fileSnapshot          `yaml:"snapshot"`
+	Jailer            *fileJailer            `yaml:"jailer"`
+}
+
+type fileKernel struct {
+	ImagePath  string `yaml:"image_path"`
+	InitrdPath string `yaml:"initrd_path"`
+	Args       string `yaml:"args"`
+}
+
+type fileMachine struct {
+	VcpuCount       int64  `yaml:"vcpu_count"`
+	MemSizeMib      int64  `yaml:"mem_size_mib"`
+	Smt             bool   `yaml:"smt"`
+	TrackDirtyPages bool   `yaml:"track_dirty_pages"`
+	CPUTemplate     string `yaml:"cpu_template"`
+}
+
+type fileDrive struct {
+	ID          string           `yaml:"id"`
+	Path        string           `yaml:"path"`
+	Root        bool             `yaml:"root"`
+	ReadOnly    bool             `yaml:"read_only"`
+	Partuuid    string           `yaml:"partuuid"`
+	CacheType   string           `yaml:"cache_type"`
+	IoEngine    string           `yaml:"io_engine"`
+	RateLimiter *fileRateLimiter `yaml:"rate_limiter"`
+}
+
+type fileRateLimiter struct {
+	Bandwidth *fileTokenBucket `yaml:"bandwidth"`
+	Ops       *fileTokenBucket `yaml:"ops"`
+}
+
+type fileTokenBucket struct {
+	Size         int64  `yaml:"size"`
+	OneTimeBurst *int64 `yaml:"one_time_burst"`
+	RefillTimeMs int64  `yaml:"refill_time_ms"`
+}
+
+type fileNetworkInterface struct {
+	Static         *fileStaticNetwork `yaml:"static"`
+	CNI            *fileCNI           `yaml:"cni"`
+	AllowMMDS      bool               `yaml:"allow_mmds"`
+	InRateLimiter  *fileRateLimiter   `yaml:"in_rate_limiter"`
+	OutRateLimiter *fileRateLimiter   `yaml:"out_rate_limiter"`
+}
+
+type fileStaticNetwork struct {
+	HostDevName string  `yaml:"host_dev_name"`
+	MacAddress  string  `yaml:"mac_address"`
+	IP          *fileIP `yaml:"ip"`
+}
+
+type fileIP struct {
+	Address     string   `yaml:"address"`
+	Gateway     string   `yaml:"gateway"`
+	Nameservers []string `yaml:"nameservers"`
+	IfName      string   `yaml:"if_name"`
+}
+
+type fileCNI struct {
+	NetworkName string            `yaml:"network_name"`
+	IfName      string            `yaml:"if_name"`
+	VMIfName    string            `yaml:"vm_if_name"`
+	Args        map[string]string `yaml:"args"`
+	BinPath     []string          `yaml:"bin_path"`
+	ConfDir     string            `yaml:"conf_dir"`
+	CacheDir    string            `yaml:"cache_dir"`
+	Force       bool              `yaml:"force"`
+}
+
+type fileVsock struct {
+	ID   string `yaml:"id"`
+	Path string `yaml:"path"`
+	CID  uint32 `yaml:"cid"`
+}
+
+type fileMMDS struct {
+	Address string `yaml:"address"`
+	Version string `yaml:"version"`
+}
+
+type fileLog struct {
+	Path  string `yaml:"path"`
+	Fifo  string `yaml:"fifo"`
+	Level string `yaml:"level"`
+}
+
+type fileMetrics struct {
+	Path string `yaml:"path"`
+	Fifo string `yaml:"fifo"`
+}
+
+type fileSeccomp struct {
+	Enabled *bool  `yaml:"enabled"`
+	Filter  string `yaml:"filter"`
+}
+
+type fileBalloon struct {
+	AmountMib             int64 `yaml:"amount_mib"`
+	DeflateOnOom          bool  `yaml:"deflate_on_oom"`
+	StatsPollingIntervalS int64 `yaml:"stats_polling_interval_s"`
+}
+
+type fileSnapshot struct {
+	MemFilePath         string             `yaml:"mem_file_path"`
+	SnapshotPath        string             `yaml:"snapshot_path"`
+	MemBackend          *fileMemoryBackend `yaml:"mem_backend"`
+	EnableDiffSnapshots bool               `yaml:"enable_diff_snapshots"`
+	ResumeVM            bool               `yaml:"resume_vm"`
+}
+
+type fileMemoryBackend struct {
+	Type string `yaml:"type"`
+	Path string `yaml:"path"`
+}
+
+type fileJailer struct {
+	ID             string   `yaml:"id"`
+	UID            *int     `yaml:"uid"`
+	GID            *int     `yaml:"gid"`
+	NumaNode       int      `yaml:"numa_node"`
+	ExecFile       string   `yaml:"exec_file"`
+	Binary         string   `yaml:"binary"`
+	ChrootBaseDir  string   `yaml:"chroot_base_dir"`
+	ChrootStrategy string   `yaml:"chroot_strategy"`
+	Daemonize      bool     `yaml:"daemonize"`
+	CgroupVersion  string   `yaml:"cgroup_version"`
+	CgroupArgs     []string `yaml:"cgroup_args"`
+	ParentCgroup   string   `yaml:"parent_cgroup"`
+}
+
+// configDecoder decodes a configuration file, collecting every problem along
+// with the path of the offending field.
+type configDecoder struct {
+	lookupEnv func(string) (string, bool)
+	// lines maps the path of each decoded field to its line in the file
+	lines map[string]int
+	errs  *multierror.Error
+}
+
+func (d *configDecoder) fail(path string, err error) {
+	d.errs = multierror.Append(d.errs, &ConfigFileError{
+		Field: path,
+		Line:  d.line(path),
+		Err:   err,
+	})
+}
+
+// line returns the line of the field or, if the field is missing from the
+// file, the line of its closest ancestor.
+func (d *configDecoder) line(path string) int {
+	for {
+		if line, ok := d.lines[path]; ok || path == "" {
+			return line
+		}
+		path = path[:strings.LastIndexAny(path, ".[")+1]
+		path = strings.TrimRight(path, ".[")
+	}
+}
+
+func (d *configDecoder) failf(path, format string, args ...interface{}) {
+	d.fail(path, fmt.Errorf(format, args...))
+}
+
+func fieldPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// decode decodes the node into v, which must be addressable.
+func (d *configDecoder) decode(n *yaml.Node, v reflect.Value, path string) {
+	if n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	d.lines[path] = n.Line
+
+	if n.Kind == yaml.ScalarNode && n.ShortTag() == "!!null" {
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		d.decode(n, elem.Elem(), path)
+		v.Set(elem)
+
+	case reflect.Struct:
+		if n.Kind != yaml.MappingNode {
+			d.failf(path, "expected a mapping")
+			return
+		}
+
+		fields := map[string]int{}
+		for i := 0; i < v.NumField(); i++ {
+			fields[v.Type().Field(i).Tag.Get("yaml")] = i
+		}
+
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			keyPath := fieldPath(path, key.Value)
+			index, ok := fields[key.Value]
+			if !ok {
+				d.lines[keyPath] = key.Line
+				d.failf(keyPath, "unknown field")
+				continue
+			}
+			d.decode(value, v.Field(index), keyPath)
+		}
+
+	case reflect.Slice:
+		if n.Kind != yaml.SequenceNode {
+			d.failf(path, "expected a list")
+			return
+		}
+
+		slice := reflect.MakeSlice(v.Type(), len(n.Content), len(n.Content))
+		for i, item := range n.Content {
+			d.decode(item, slice.Index(i), fmt.Sprintf("%s[%d]", path, i))
+		}
+		v.Set(slice)
+
+	case reflect.Map:
+		if n.Kind != yaml.MappingNode {
+			d.failf(path, "expected a mapping")
+			return
+		}
+
+		m := reflect.MakeMapWithSize(v.Type(), len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			elem := reflect.New(v.Type().Elem()).Elem()
+			d.decode(value, elem, fieldPath(path, key.Value))
+			m.SetMapIndex(reflect.ValueOf(key.Value), elem)
+		}
+		v.Set(m)
+
+	default:
+		d.decodeScalar(n, v, path)
+	}
+}
+
+func (d *configDecoder) decodeScalar(n *yaml.Node, v reflect.Value, path string) {
+	if n.Kind != yaml.ScalarNode {
+		d.failf(path, "expected a %s", v.Kind())
+		return
+	}
+
+	if strings.Contains(n.Value, "$") {
+		value, err := expandEnv(n.Value, d.lookupEnv)
+		if err != nil {
+			d.fail(path, err)
+			return
+		}
+
+		expanded := *n
+		expanded.Value = value
+		if expanded.Style == 0 {
+			// resolve the type of plain scalars after the expansion, so that
+			// numbers and booleans can be read from the environment
+			expanded.Tag = ""
+		}
+		n = &expanded
+	}
+
+	if err := n.Decode(v.Addr().Interface()); err != nil {
+		d.failf(path, "cannot use %q as a %s", n.Value, v.Kind())
+	}
+}
+
+// expandEnv replaces the references to environment variables in s.
+func expandEnv(s string, lookupEnv func(string) (string, bool)) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) || (s[i+1] != '$' && s[i+1] != '{') {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		if s[i+1] == '$' {
+			b.WriteByte('$')
+			i++
+			continue
+		}
+
+		end := strings.IndexByte(s[i+2:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated reference to an environment variable in %q", s)
+		}
+		expr := s[i+2 : i+2+end]
+		i += 2 + end
+
+		name, op, arg := expr, "", ""
+		if idx := strings.Index(expr, ":"); idx >= 0 && idx+1 < len(expr) {
+			name, op, arg = expr[:idx], expr[idx:idx+2], expr[idx+2:]
+		}
+		if !isEnvName(name) || (op != "" && op != ":-" && op != ":?") {
+			return "", fmt.Errorf("invalid reference to an environment variable ${%s}", expr)
+		}
+
+		value, ok := lookupEnv(name)
+		switch {
+		case op == ":-" && value == "":
+			value = arg
+		case op == ":?" && value == "":
+			if arg == "" {
+				arg = "not set"
+			}
+			return "", fmt.Errorf("environment variable %s: %s", name, arg)
+		case op == "" && !ok:
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		b.WriteString(value)
+	}
+	return b.String(), nil
+}
+
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if c != '_' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && (i == 0 || !('0' <= c && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
+
+// config converts the decoded file into a Config, checking the values the
+// schema constrains.
+func (d *configDecoder) config(file *fileConfig) Config {
+	switch file.Version {
+	case 0:
+		d.failf("version", "required, the current version is %d", ConfigSchemaVersion)
+	case ConfigSchemaVersion:
+	default:
+		d.failf("version", "unsupported version %d, the current version is %d", file.Version, ConfigSchemaVersion)
+	}
+
+	cfg := Config{
+		VMID:            file.VMID,
+		SocketPath:      file.SocketPath,
+		NetNS:           file.NetNS,
+		KernelImagePath: file.Kernel.ImagePath,
+		InitrdPath:      file.Kernel.InitrdPath,
+		KernelArgs:      file.Kernel.Args,
+		LogPath:         file.Log.Path,
+		LogFifo:         file.Log.Fifo,
+		LogLevel:        file.Log.Level,
+		MetricsPath:     file.Metrics.Path,
+		MetricsFifo:     file.Metrics.Fifo,
+		MachineCfg: models.MachineConfiguration{
+			VcpuCount:       Int64(file.Machine.VcpuCount),
+			MemSizeMib:      Int64(file.Machine.MemSizeMib),
+			Smt:             Bool(file.Machine.Smt),
+			TrackDirtyPages: Bool(file.Machine.TrackDirtyPages),
+			CPUTemplate:     models.CPUTemplate(file.Machine.CPUTemplate),
+		},
+		Seccomp: SeccompConfig{
+			Enabled: file.Seccomp.Enabled == nil || *file.Seccomp.Enabled,
+			Filter:  file.Seccomp.Filter,
+		},
+	}
+
+	d.oneOf("log.level", file.Log.Level, "Error", "Warning", "Info", "Debug")
+	d.oneOf("machine.cpu_template", file.Machine.CPUTemplate,
+		string(models.CPUTemplateC3), string(models.CPUTemplateT2), string(models.CPUTemplateT2S),
+		string(models.CPUTemplateT2CL), string(models.CPUTemplateT2A), string(models.CPUTemplateV1N1),
+		string(models.CPUTemplateNone))
+
+	for i, drive := range file.Drives {
+		cfg.Drives = append(cfg.Drives, d.drive(drive, i))
+	}
+
+	for i, iface := range file.NetworkInterfaces {
+		cfg.NetworkInterfaces = append(cfg.NetworkInterfaces, d.networkInterface(iface, fmt.Sprintf("network_interfaces[%d]", i)))
+	}
+
+	for i, vsock := range file.Vsock {
+		path := fmt.Sprintf("vsock[%d]", i)
+		if vsock.Path == "" {
+			d.failf(fieldPath(path, "path"), "required")
+		}
+		cfg.VsockDevices = append(cfg.VsockDevices, VsockDevice{
+			ID:   vsock.ID,
+			Path: vsock.Path,
+			CID:  vsock.CID,
+		})
+	}
+
+	if mmds := file.MMDS; mmds != nil {
+		if mmds.Address != "" {
+			cfg.MmdsAddress = net.ParseIP(mmds.Address)
+			if cfg.MmdsAddress == nil {
+				d.failf("mmds.address", "invalid IP address %q", mmds.Address)
+			}
+		}
+		d.oneOf("mmds.version", mmds.Version, string(MMDSv1), string(MMDSv2))
+		cfg.MmdsVersion = MMDSVersion(mmds.Version)
+	}
+
+	if balloon := file.Balloon; balloon != nil {
+		cfg.Balloon = &models.Balloon{
+			AmountMib:             Int64(balloon.AmountMib),
+			DeflateOnOom:          Bool(balloon.DeflateOnOom),
+			StatsPollingIntervals: balloon.StatsPollingIntervalS,
+		}
+	}
+
+	if snapshot := file.Snapshot; snapshot != nil {
+		cfg.Snapshot = SnapshotConfig{
+			MemFilePath:         snapshot.MemFilePath,
+			SnapshotPath:        snapshot.SnapshotPath,
+			EnableDiffSnapshots: snapshot.EnableDiffSnapshots,
+			ResumeVM:            snapshot.ResumeVM,
+		}
+		if snapshot.SnapshotPath == "" {
+			d.failf("snapshot.snapshot_path", "required")
+		}
+		if backend := snapshot.MemBackend; backend != nil {
+			d.oneOf("snapshot.mem_backend.type", backend.Type, models.MemoryBackendBackendTypeFile, models.MemoryBackendBackendTypeUffd)
+			cfg.Snapshot.MemBackend = &models.MemoryBackend{
+				BackendType: String(backend.Type),
+				BackendPath: String(backend.Path),
+			}
+		}
+	}
+
+	if jailer := file.Jailer; jailer != nil {
+		cfg.JailerCfg = d.jailer(jailer, &cfg)
+	}
+
+	return cfg
+}
+
+func (d *configDecoder) drive(drive fileDrive, i int) models.Drive {
+	path := fmt.Sprintf("drives[%d]", i)
+	if drive.Path == "" {
+		d.failf(fieldPath(path, "path"), "required")
+	}
+
+	// the same IDs as the ones DrivesBuilder assigns
+	id := drive.ID
+	if id == "" && drive.Root {
+		id = rootDriveName
+	} else if id == "" {
+		id = strconv.Itoa(i)
+	}
+
+	d.oneOf(fieldPath(path, "cache_type"), drive.CacheType, models.DriveCacheTypeUnsafe, models.DriveCacheTypeWriteback)
+	d.oneOf(fieldPath(path, "io_engine"), drive.IoEngine, models.DriveIoEngineSync, models.DriveIoEngineAsync)
+
+	result := models.Drive{
+		DriveID:      String(id),
+		PathOnHost:   String(drive.Path),
+		IsRootDevice: Bool(drive.Root),
+		IsReadOnly:   Bool(drive.ReadOnly),
+		Partuuid:     drive.Partuuid,
+		RateLimiter:  rateLimiter(drive.RateLimiter),
+	}
+	if drive.CacheType != "" {
+		result.CacheType = String(drive.CacheType)
+	}
+	if drive.IoEngine != "" {
+		result.IoEngine = String(drive.IoEngine)
+	}
+	return result
+}
+
+func (d *configDecoder) networkInterface(iface fileNetworkInterface, path string) NetworkInterface {
+	result := NetworkInterface{
+		AllowMMDS:      iface.AllowMMDS,
+		InRateLimiter:  rateLimiter(iface.InRateLimiter),
+		OutRateLimiter: rateLimiter(iface.OutRateLimiter),
+	}
+
+	if (iface.Static == nil) == (iface.CNI == nil) {
+		d.failf(path, "exactly one of static and cni must be set")
+		return result
+	}
+
+	if static := iface.Static; static != nil {
+		staticPath := fieldPath(path, "static")
+		if static.HostDevName == "" {
+			d.failf(fieldPath(staticPath, "host_dev_name"), "required")
+		}
+
+		result.StaticConfiguration = &StaticNetworkConfiguration{
+			HostDevName: static.HostDevName,
+			MacAddress:  static.MacAddress,
+		}
+
+		if ip := static.IP; ip != nil {
+			ipPath := fieldPath(staticPath, "ip")
+			ipCfg := &IPConfiguration{
+				Nameservers: ip.Nameservers,
+				IfName:      ip.IfName,
+			}
+
+			addr, ipNet, err := net.ParseCIDR(ip.Address)
+			if err != nil {
+				d.failf(fieldPath(ipPath, "address"), "invalid address %q, expected an IP address with a prefix length", ip.Address)
+			} else {
+				ipCfg.IPAddr = net.IPNet{IP: addr, Mask: ipNet.Mask}
+			}
+
+			if ip.Gateway != "" {
+				ipCfg.Gateway = net.ParseIP(ip.Gateway)
+				if ipCfg.Gateway == nil {
+					d.failf(fieldPath(ipPath, "gateway"), "invalid IP address %q", ip.Gateway)
+				}
+			}
+
+			result.StaticConfiguration.IPConfiguration = ipCfg
+		}
+	}
+
+	if cni := iface.CNI; cni != nil {
+		if cni.NetworkName == "" {
+			d.failf(fieldPath(path, "cni.network_name"), "required")
+		}
+
+		result.CNIConfiguration = &CNIConfiguration{
+			NetworkName: cni.NetworkName,
+			IfName:      cni.IfName,
+			VMIfName:    cni.VMIfName,
+			BinPath:     cni.BinPath,
+			ConfDir:     cni.ConfDir,
+			CacheDir:    cni.CacheDir,
+			Force:       cni.Force,
+		}
+
+		keys := make([]string, 0, len(cni.Args))
+		for k := range cni.Args {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			result.CNIConfiguration.Args = append(result.CNIConfiguration.Args, [2]string{k, cni.Args[k]})
+		}
+	}
+
+	return result
+}
+
+func (d *configDecoder) jailer(jailer *fileJailer, cfg *Config) *JailerConfig {
+	if jailer.ID == "" {
+		d.failf("jailer.id", "required")
+	}
+	if jailer.UID == nil {
+		d.failf("jailer.uid", "required")
+	}
+	if jailer.GID == nil {
+		d.failf("jailer.gid", "required")
+	}
+	if jailer.ExecFile == "" {
+		d.failf("jailer.exec_file", "required")
+	}
+	d.oneOf("jailer.cgroup_version", jailer.CgroupVersion, "1", "2")
+
+	result := &JailerConfig{
+		ID:            jailer.ID,
+		UID:           jailer.UID,
+		GID:           jailer.GID,
+		NumaNode:      Int(jailer.NumaNode),
+		ExecFile:      jailer.ExecFile,
+		JailerBinary:  jailer.Binary,
+		ChrootBaseDir: jailer.ChrootBaseDir,
+		Daemonize:     jailer.Daemonize,
+		CgroupVersion: jailer.CgroupVersion,
+		CgroupArgs:    jailer.CgroupArgs,
+		ParentCgroup:  jailer.ParentCgroup,
+	}
+
+	name := jailer.ChrootStrategy
+	if name == "" {
+		name = NaiveChrootStrategyName
+	}
+	strategy, err := newChrootStrategy(name, *cfg)
+	if err != nil {
+		d.fail("jailer.chroot_strategy", err)
+	}
+	result.ChrootStrategy = strategy
+
+	return result
+}
+
+// oneOf checks that value, unless empty, is one of the allowed values.
+func (d *configDecoder) oneOf(path, value string, allowed ...string) {
+	if value == "" {
+		return
+	}
+	for _, v := range allowed {
+		if v == value {
+			return
+		}
+	}
+	d.failf(path, "invalid value %q, expected one of %s", value, strings.Join(allowed, ", "))
+}
+
+func rateLimiter(limiter *fileRateLimiter) *models.RateLimiter {
+	if limiter == nil {
+		return nil
+	}
+	return &models.RateLimiter{
+		Bandwidth: tokenBucket(limiter.Bandwidth),
+		Ops:       tokenBucket(limiter.Ops),
+	}
+}
+
+func tokenBucket(bucket *fileTokenBucket) *models.TokenBucket {
+	if bucket == nil {
+		return nil
+	}
+	return &models.TokenBucket{
+		Size:         Int64(bucket.Size),
+		OneTimeBurst: bucket.OneTimeBurst,
+		RefillTime:   Int64(bucket.RefillTimeMs),
+	}
+}
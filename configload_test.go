@@ -0,0 +1,319 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+const testConfigYAML = `
+version: 1
+vmid: vm-1
+socket_path: /run/vm-1.sock
+kernel:
+  image_path: ${KERNEL_DIR}/vmlinux
+  args: console=ttyS0 reboot=k
+machine:
+  vcpu_count: ${VCPUS:-2}
+  mem_size_mib: 512
+drives:
+  - path: /images/rootfs.ext4
+    root: true
+  - id: data
+    path: /images/data.ext4
+    read_only: true
+    cache_type: Writeback
+    rate_limiter:
+      bandwidth: {size: 1048576, refill_time_ms: 1000}
+network_interfaces:
+  - static:
+      host_dev_name: tap0
+      mac_address: 02:00:00:00:00:01
+      ip:
+        address: 10.0.0.2/24
+        gateway: 10.0.0.1
+        nameservers: [1.1.1.1]
+    allow_mmds: true
+  - cni:
+      network_name: fcnet
+      if_name: veth0
+      args: {IgnoreUnknown: "true"}
+vsock:
+  - {id: vsock0, path: /run/vm-1.vsock, cid: 3}
+mmds:
+  address: 169.254.169.250
+  version: V2
+log:
+  fifo: /run/vm-1.log
+  level: Debug
+balloon:
+  amount_mib: 64
+  deflate_on_oom: true
+jailer:
+  id: vm-1
+  uid: 123
+  gid: 100
+  exec_file: /usr/bin/firecracker
+`
+
+func TestParseConfig(t *testing.T) {
+	t.Setenv("KERNEL_DIR", "/kernels")
+
+	cfg, err := ParseConfig(strings.NewReader(testConfigYAML))
+	require.NoError(t, err)
+
+	assert.Equal(t, "vm-1", cfg.VMID)
+	assert.Equal(t, "/kernels/vmlinux", cfg.KernelImagePath)
+	assert.Equal(t, "console=ttyS0 reboot=k", cfg.KernelArgs)
+	assert.Equal(t, int64(2), Int64Value(cfg.MachineCfg.VcpuCount))
+	assert.Equal(t, int64(512), Int64Value(cfg.MachineCfg.MemSizeMib))
+	assert.True(t, cfg.Seccomp.Enabled)
+
+	require.Len(t, cfg.Drives, 2)
+	assert.Equal(t, rootDriveName, StringValue(cfg.Drives[0].DriveID))
+	assert.True(t, BoolValue(cfg.Drives[0].IsRootDevice))
+	assert.Equal(t, "data", StringValue(cfg.Drives[1].DriveID))
+	assert.True(t, BoolValue(cfg.Drives[1].IsReadOnly))
+	assert.Equal(t, models.DriveCacheTypeWriteback, StringValue(cfg.Drives[1].CacheType))
+	assert.Equal(t, int64(1048576), Int64Value(cfg.Drives[1].RateLimiter.Bandwidth.Size))
+
+	require.Len(t, cfg.NetworkInterfaces, 2)
+	static := cfg.NetworkInterfaces[0].StaticConfiguration
+	assert.Equal(t, "tap0", static.HostDevName)
+	assert.Equal(t, "10.0.0.2/24", static.IPConfiguration.IPAddr.String())
+	assert.Equal(t, "10.0.0.1", static.IPConfiguration.Gateway.String())
+	assert.True(t, cfg.NetworkInterfaces[0].AllowMMDS)
+	cni := cfg.NetworkInterfaces[1].CNIConfiguration
+	assert.Equal(t, "fcnet", cni.NetworkName)
+	assert.Equal(t, [][2]string{{"IgnoreUnknown", "true"}}, cni.Args)
+
+	assert.Equal(t, []VsockDevice{{ID: "vsock0", Path: "/run/vm-1.vsock", CID: 3}}, cfg.VsockDevices)
+	assert.Equal(t, net.IPv4(169, 254, 169, 250).String(), cfg.MmdsAddress.String())
+	assert.Equal(t, MMDSv2, cfg.MmdsVersion)
+	assert.Equal(t, "/run/vm-1.log", cfg.LogFifo)
+	assert.Equal(t, int64(64), Int64Value(cfg.Balloon.AmountMib))
+
+	require.NotNil(t, cfg.JailerCfg)
+	assert.Equal(t, 123, IntValue(cfg.JailerCfg.UID))
+	assert.Equal(t, 0, IntValue(cfg.JailerCfg.NumaNode))
+	assert.Equal(t, NewNaiveChrootStrategy("/kernels/vmlinux"), cfg.JailerCfg.ChrootStrategy)
+}
+
+func TestLoadConfigJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{
+		"version": 1,
+		"kernel": {"image_path": "/vmlinux"},
+		"machine": {"vcpu_count": 1, "mem_size_mib": 128},
+		"seccomp": {"enabled": false}
+	}`), 0644))
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "/vmlinux", cfg.KernelImagePath)
+	assert.Equal(t, int64(1), Int64Value(cfg.MachineCfg.VcpuCount))
+	assert.False(t, cfg.Seccomp.Enabled)
+
+	_, err = LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.True(t, os.IsNotExist(errors.Unwrap(err)) || os.IsNotExist(err), "unexpected error %v", err)
+}
+
+func TestLoadConfigSnapshotStart(t *testing.T) {
+	dir := t.TempDir()
+	server := fctesting.NewFakeServer(filepath.Join(dir, "fc.sock"))
+	require.NoError(t, server.Start())
+	defer server.Close()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "vm.snap"), []byte(`{}`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "vm.mem"), nil, 0600))
+	path := filepath.Join(dir, "vm.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+version: 1
+socket_path: `+server.SocketPath+`
+snapshot:
+  snapshot_path: `+filepath.Join(dir, "vm.snap")+`
+  mem_file_path: `+filepath.Join(dir, "vm.mem")+`
+  resume_vm: true
+`), 0644))
+
+	cfg, err := LoadConfig(path)
+	require.NoError(t, err)
+	// the socket of the fake server already exists
+	cfg.DisableValidation = true
+
+	m, err := NewMachine(context.Background(), cfg,
+		WithProcessRunner(exec.Command("sleep", "60")),
+		WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+	require.NoError(t, m.Start(context.Background()))
+	defer m.StopVMM()
+
+	assert.Equal(t, models.InstanceInfoStateRunning, server.State())
+	assert.Contains(t, server.Calls(), "LoadSnapshot")
+	assert.NotContains(t, server.Calls(), "PutGuestBootSource")
+	assert.NotContains(t, server.Calls(), "CreateSyncAction")
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		config string
+		fields []string
+	}{
+		{
+			name:   "missing version",
+			config: `kernel: {image_path: /vmlinux}`,
+			fields: []string{"version"},
+		},
+		{
+			name:   "unsupported version",
+			config: `version: 2`,
+			fields: []string{"version"},
+		},
+		{
+			name: "unknown and mistyped fields",
+			config: `
+version: 1
+machine:
+  vcpus: 2
+  mem_size_mib: lots
+drives:
+  - path: /rootfs
+    root: maybe
+`,
+			fields: []string{"machine.vcpus", "machine.mem_size_mib", "drives[0].root"},
+		},
+		{
+			name: "invalid values",
+			config: `
+version: 1
+drives:
+  - {id: root}
+network_interfaces:
+  - static: {host_dev_name: tap0, ip: {address: 10.0.0.2}}
+  - {allow_mmds: true}
+mmds: {version: V3}
+jailer: {id: vm, chroot_strategy: clever, exec_file: /firecracker}
+`,
+			fields: []string{
+				"drives[0].path",
+				"network_interfaces[0].static.ip.address",
+				"network_interfaces[1]",
+				"mmds.version",
+				"jailer.uid",
+				"jailer.gid",
+				"jailer.chroot_strategy",
+			},
+		},
+		{
+			name: "unset environment variable",
+			config: `
+version: 1
+kernel: {image_path: "${FC_TEST_UNSET_KERNEL}"}
+machine: {mem_size_mib: "${FC_TEST_UNSET_MEM:?the memory size is required}"}
+`,
+			fields: []string{"kernel.image_path", "machine.mem_size_mib"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := ParseConfig(strings.NewReader(c.config))
+			require.Error(t, err)
+
+			var merr *multierror.Error
+			require.True(t, errors.As(err, &merr), "unexpected error %v", err)
+
+			var fields []string
+			for _, e := range merr.Errors {
+				var fieldErr *ConfigFileError
+				require.True(t, errors.As(e, &fieldErr), "unexpected error %v", e)
+				assert.NotZero(t, fieldErr.Line, "no line for %s", fieldErr.Field)
+				fields = append(fields, fieldErr.Field)
+			}
+			assert.Equal(t, c.fields, fields)
+		})
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	env := map[string]string{"SET": "value", "EMPTY": ""}
+	lookupEnv := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	cases := []struct {
+		in, out string
+		err     bool
+	}{
+		{in: "${SET}", out: "value"},
+		{in: "a-${SET}-b", out: "a-value-b"},
+		{in: "${EMPTY}", out: ""},
+		{in: "${EMPTY:-default}", out: "default"},
+		{in: "${UNSET:-}", out: ""},
+		{in: "$$SET $5", out: "$SET $5"},
+		{in: "${SET:?}", out: "value"},
+		{in: "${UNSET}", err: true},
+		{in: "${UNSET:?missing}", err: true},
+		{in: "${SET", err: true},
+		{in: "${1SET}", err: true},
+	}
+
+	for _, c := range cases {
+		out, err := expandEnv(c.in, lookupEnv)
+		if c.err {
+			assert.Error(t, err, c.in)
+			continue
+		}
+		assert.NoError(t, err, c.in)
+		assert.Equal(t, c.out, out, c.in)
+	}
+}
+
+func TestRegisterChrootStrategy(t *testing.T) {
+	type customStrategy struct{ NaiveChrootStrategy }
+
+	RegisterChrootStrategy("custom", func(cfg Config) (HandlersAdapter, error) {
+		return customStrategy{NewNaiveChrootStrategy(cfg.KernelImagePath)}, nil
+	})
+	defer func() {
+		chrootStrategiesMu.Lock()
+		delete(chrootStrategies, "custom")
+		chrootStrategiesMu.Unlock()
+	}()
+
+	cfg, err := ParseConfig(strings.NewReader(`
+version: 1
+kernel: {image_path: /vmlinux}
+jailer: {id: vm, uid: 0, gid: 0, exec_file: /firecracker, chroot_strategy: custom}
+`))
+	require.NoError(t, err)
+	assert.IsType(t, customStrategy{}, cfg.JailerCfg.ChrootStrategy)
+}
@@ -0,0 +1,198 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"syscall"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+)
+
+// Classes of APIError, to be matched with errors.Is.
+var (
+	// ErrInvalidState is returned when an operation is not allowed in the
+	// current state of the VM, such as configuring a device after boot.
+	ErrInvalidState = errors.New("firecracker: operation not allowed in the current state of the VM")
+	// ErrInvalidArgument is returned when Firecracker rejects a request.
+	ErrInvalidArgument = errors.New("firecracker: invalid argument")
+	// ErrNotFound is returned when a resource, such as a drive, does not exist.
+	ErrNotFound = errors.New("firecracker: not found")
+	// ErrVMMUnavailable is returned when the API socket cannot be reached or
+	// the VMM closed the connection.
+	ErrVMMUnavailable = errors.New("firecracker: VMM unavailable")
+)
+
+// invalidStateMessages are fragments of the lowercased fault messages
+// Firecracker returns when an operation is not allowed in the current state.
+var invalidStateMessages = []string{
+	"pre-boot",
+	"post-boot",
+	"before starting the microvm",
+	"after starting the microvm",
+	"not allowed",
+	"microvm is not running",
+	"microvm is paused",
+	"microvm is running",
+}
+
+// notFoundMessages are fragments of the lowercased fault messages Firecracker
+// returns for a missing resource.
+var notFoundMessages = []string{
+	"not found",
+	"does not exist",
+	"no such",
+}
+
+// APIError is returned by the Client methods when an API call fails, either
+// because Firecracker returned an error or because the request could not be
+// sent. It wraps the error of the generated client, so that errors.As still
+// works with the error types of the operations package, and one of
+// ErrInvalidState, ErrInvalidArgument, ErrNotFound or ErrVMMUnavailable when
+// the error could be classified.
+type APIError struct {
+	// Operation is the name of the API operation, such as PutGuestDriveByID.
+	Operation string
+	// StatusCode is the HTTP status of the response, or 0 if no response was
+	// received.
+	StatusCode int
+	// FaultMessage is the error message returned by Firecracker.
+	FaultMessage string
+	// Body is the body of the request, if any.
+	Body interface{}
+	// Err is the error returned by the generated client.
+	Err error
+
+	class error
+}
+
+// newAPIError wraps the error returned by the generated client for the given
+// operation in an APIError. It returns nil if err is nil.
+func newAPIError(operation string, body interface{}, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	e := &APIError{
+		Operation: operation,
+		Body:      body,
+		Err:       err,
+	}
+
+	if resp, ok := err.(interface{ GetPayload() *models.Error }); ok {
+		e.StatusCode = responseStatusCode(err)
+		if payload := resp.GetPayload(); payload != nil {
+			e.FaultMessage = payload.FaultMessage
+		}
+	}
+	e.class = e.classify()
+
+	return e
+}
+
+// responseStatusCode returns the HTTP status of a response of the generated
+// client. Only the default responses carry their status, the others are named
+// after it.
+func responseStatusCode(resp interface{}) int {
+	if resp, ok := resp.(interface{ Code() int }); ok {
+		return resp.Code()
+	}
+
+	t := reflect.TypeOf(resp)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch name := t.Name(); {
+	case strings.HasSuffix(name, "BadRequest"):
+		return http.StatusBadRequest
+	case strings.HasSuffix(name, "NotFound"):
+		return http.StatusNotFound
+	case strings.HasSuffix(name, "NoContent"):
+		return http.StatusNoContent
+	case strings.HasSuffix(name, "OK"):
+		return http.StatusOK
+	}
+	return 0
+}
+
+func (e *APIError) classify() error {
+	if e.StatusCode == 0 {
+		if isUnavailable(e.Err) {
+			return ErrVMMUnavailable
+		}
+		return nil
+	}
+
+	msg := strings.ToLower(e.FaultMessage)
+	switch {
+	case e.StatusCode == http.StatusNotFound || containsAny(msg, notFoundMessages):
+		return ErrNotFound
+	case containsAny(msg, invalidStateMessages):
+		return ErrInvalidState
+	case e.StatusCode == http.StatusBadRequest:
+		return ErrInvalidArgument
+	}
+	return nil
+}
+
+// isUnavailable reports whether err means that the API socket could not be
+// reached or that the VMM went away while handling the request.
+func isUnavailable(err error) bool {
+	for _, target := range []error{
+		syscall.ECONNREFUSED,
+		syscall.ECONNRESET,
+		syscall.ENOENT,
+		syscall.EPIPE,
+		io.EOF,
+		io.ErrUnexpectedEOF,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsAny(s string, substrs []string) bool {
+	for _, substr := range substrs {
+		if strings.Contains(s, substr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *APIError) Error() string {
+	switch {
+	case e.FaultMessage != "":
+		return fmt.Sprintf("%s failed with status %d: %s", e.Operation, e.StatusCode, e.FaultMessage)
+	case e.StatusCode != 0:
+		return fmt.Sprintf("%s failed with status %d", e.Operation, e.StatusCode)
+	}
+	return fmt.Sprintf("%s failed: %v", e.Operation, e.Err)
+}
+
+// Unwrap returns the error of the generated client and the class of the
+// error, if any.
+func (e *APIError) Unwrap() []error {
+	if e.class == nil {
+		return []error{e.Err}
+	}
+	return []error{e.Err, e.class}
+}
@@ -0,0 +1,149 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+func putDriveDefault(code int, faultMessage string) error {
+	resp := ops.NewPutGuestDriveByIDDefault(code)
+	resp.Payload = &models.Error{FaultMessage: faultMessage}
+	return resp
+}
+
+func TestAPIError(t *testing.T) {
+	drive := NewDrivesBuilder("/rootfs").Build()[0]
+
+	cases := []struct {
+		name       string
+		err        error
+		class      error
+		statusCode int
+	}{
+		{
+			name: "post-boot",
+			err: &ops.PutGuestDriveByIDBadRequest{Payload: &models.Error{
+				FaultMessage: "The requested operation is not supported after starting the microVM.",
+			}},
+			class:      ErrInvalidState,
+			statusCode: 400,
+		},
+		{
+			name:       "pre-boot",
+			err:        putDriveDefault(400, "Operation not allowed pre-boot."),
+			class:      ErrInvalidState,
+			statusCode: 400,
+		},
+		{
+			name: "invalid argument",
+			err: &ops.PutGuestDriveByIDBadRequest{Payload: &models.Error{
+				FaultMessage: "Unable to create the block device: BackingFile(Os { code: 2 })",
+			}},
+			class:      ErrInvalidArgument,
+			statusCode: 400,
+		},
+		{
+			name:       "not found",
+			err:        putDriveDefault(400, "The drive with ID data does not exist."),
+			class:      ErrNotFound,
+			statusCode: 400,
+		},
+		{
+			name:       "internal error",
+			err:        putDriveDefault(500, ""),
+			statusCode: 500,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := NewClient("/path/to/socket", nil, false, WithOpsClient(&fctesting.MockClient{
+				PutGuestDriveByIDFn: func(params *ops.PutGuestDriveByIDParams) (*ops.PutGuestDriveByIDNoContent, error) {
+					return nil, c.err
+				},
+			}))
+
+			_, err := client.PutGuestDriveByID(context.Background(), "root_drive", &drive)
+
+			var apiErr *APIError
+			require.True(t, errors.As(err, &apiErr), "unexpected error %v", err)
+			assert.Equal(t, "PutGuestDriveByID", apiErr.Operation)
+			assert.Equal(t, c.statusCode, apiErr.StatusCode)
+			assert.Equal(t, &drive, apiErr.Body)
+			assert.True(t, errors.Is(err, c.err), "the client error is not wrapped")
+
+			for _, class := range []error{ErrInvalidState, ErrInvalidArgument, ErrNotFound, ErrVMMUnavailable} {
+				assert.Equal(t, class == c.class, errors.Is(err, class), "errors.Is(%v, %v)", err, class)
+			}
+		})
+	}
+}
+
+func TestAPIErrorNotFoundResponse(t *testing.T) {
+	client := NewClient("/path/to/socket", nil, false, WithOpsClient(&fctesting.MockClient{
+		GetMmdsFn: func(params *ops.GetMmdsParams) (*ops.GetMmdsOK, error) {
+			return nil, ops.NewGetMmdsNotFound()
+		},
+	}))
+
+	_, err := client.GetMmds(context.Background())
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr), "unexpected error %v", err)
+	assert.Equal(t, 404, apiErr.StatusCode)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestAPIErrorVMMUnavailable(t *testing.T) {
+	dir := t.TempDir()
+
+	// nothing listens on the socket
+	client := NewClient(filepath.Join(dir, "missing.sock"), nil, false)
+	_, err := client.GetFirecrackerVersion(context.Background())
+	assert.True(t, errors.Is(err, ErrVMMUnavailable), "unexpected error %v", err)
+
+	// the VMM hangs up without answering
+	socketPath := filepath.Join(dir, "fc.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	client = NewClient(socketPath, nil, false)
+	_, err = client.GetFirecrackerVersion(context.Background())
+	assert.True(t, errors.Is(err, ErrVMMUnavailable), "unexpected error %v", err)
+
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Zero(t, apiErr.StatusCode)
+}
@@ -0,0 +1,220 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	// exitLogTailLines is the number of lines of the Firecracker log kept in
+	// ExitInfo.
+	exitLogTailLines = 20
+	// exitLogTailBytes bounds how much of a log file is read to find its last
+	// lines.
+	exitLogTailBytes = 64 * 1024
+
+	// exitCodeBadSyscall is the exit code of Firecracker when its seccomp
+	// filter caught a syscall that is not allowed.
+	exitCodeBadSyscall = 148
+)
+
+// ExitInfo describes how the VMM of a Machine exited.
+//
+// Firecracker exits with code 0 both when the guest powers off and when it
+// reboots; the LogTail can be used to tell the two apart.
+type ExitInfo struct {
+	// Exited is true once the VMM has exited and its resources were cleaned
+	// up. The other fields, except for SDKInitiated and ShutdownStage, are
+	// only set once Exited is true.
+	Exited bool
+	// ExitCode is the exit code of the VMM, or -1 if it was killed by a
+	// signal or its exit status is unknown, as is the case for Machines
+	// created by AttachMachine.
+	ExitCode int
+	// Signal is the signal that killed the VMM, if any.
+	Signal syscall.Signal
+	// SDKInitiated is true if the stop of the VMM was requested through the
+	// Machine, for example by StopVMM, Shutdown or ShutdownWithPolicy.
+	SDKInitiated bool
+	// ShutdownStage is the last shutdown stage the Machine went through
+	// before the VMM exited, or ShutdownStageNone if the stop was not
+	// initiated by the SDK.
+	ShutdownStage ShutdownStage
+	// LogTail holds the last lines of the Firecracker log, if it was written
+	// to LogPath or to LogFifo with a FifoLogWriter.
+	LogTail []string
+	// CleanupErrors holds the errors that occurred while cleaning up after
+	// the VMM exited.
+	CleanupErrors []error
+	// Err is the error returned when waiting for the VMM process.
+	Err error
+}
+
+// SeccompViolation returns true if the VMM was terminated because it made a
+// syscall not allowed by its seccomp filter.
+func (e ExitInfo) SeccompViolation() bool {
+	return e.Signal == syscall.SIGSYS || e.ExitCode == exitCodeBadSyscall
+}
+
+// ExitStatus returns information about how the VMM exited. Until the VMM has
+// exited, Exited is false.
+func (m *Machine) ExitStatus() ExitInfo {
+	m.stateMu.Lock()
+	info := m.exitInfo
+	m.stateMu.Unlock()
+
+	if !info.Exited {
+		return info
+	}
+
+	if m.logTail != nil {
+		info.LogTail = m.logTail.Lines()
+	} else if m.Cfg.LogPath != "" {
+		info.LogTail = tailFile(m.Cfg.LogPath, exitLogTailLines)
+	}
+	return info
+}
+
+// markShutdownStage records that the SDK is stopping the VMM and the stage it
+// reached.
+func (m *Machine) markShutdownStage(stage ShutdownStage) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	if !m.exitInfo.Exited {
+		m.exitInfo.SDKInitiated = true
+		m.exitInfo.ShutdownStage = stage
+	}
+}
+
+// recordExit records the exit of the VMM process.
+func (m *Machine) recordExit(processState *os.ProcessState, waitErr, cleanupErr error) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	m.exitInfo.Exited = true
+	m.exitInfo.ExitCode = -1
+	m.exitInfo.Err = waitErr
+
+	if processState != nil {
+		m.exitInfo.ExitCode = processState.ExitCode()
+		if status, ok := processState.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			m.exitInfo.Signal = status.Signal()
+		}
+	}
+
+	var merr *multierror.Error
+	if errors.As(cleanupErr, &merr) {
+		m.exitInfo.CleanupErrors = merr.WrappedErrors()
+	} else if cleanupErr != nil {
+		m.exitInfo.CleanupErrors = []error{cleanupErr}
+	}
+}
+
+// lineTail is an io.Writer that keeps the last lines written to it.
+type lineTail struct {
+	mu      sync.Mutex
+	max     int
+	lines   []string
+	partial []byte
+}
+
+func newLineTail(max int) *lineTail {
+	return &lineTail{max: max}
+}
+
+func (t *lineTail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	data := append(t.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		t.add(string(data[:i]))
+		data = data[i+1:]
+	}
+	t.partial = append([]byte(nil), data...)
+
+	return len(p), nil
+}
+
+func (t *lineTail) add(line string) {
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.max {
+		t.lines = t.lines[len(t.lines)-t.max:]
+	}
+}
+
+// Lines returns the last lines written, including an unterminated one.
+func (t *lineTail) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	lines := append([]string(nil), t.lines...)
+	if len(t.partial) > 0 {
+		lines = append(lines, string(t.partial))
+		if len(lines) > t.max {
+			lines = lines[1:]
+		}
+	}
+	return lines
+}
+
+// tailFile returns the last n lines of the file, or nil if it can't be read.
+func tailFile(path string, n int) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil
+	}
+
+	offset := info.Size() - exitLogTailBytes
+	if offset < 0 {
+		offset = 0
+	}
+	data, err := io.ReadAll(io.NewSectionReader(f, offset, info.Size()-offset))
+	if err != nil {
+		return nil
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if offset > 0 {
+		// the first line was most likely cut
+		lines = lines[1:]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	if len(lines) == 1 && lines[0] == "" {
+		return nil
+	}
+	return lines
+}
@@ -0,0 +1,110 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineTail(t *testing.T) {
+	tail := newLineTail(3)
+
+	fmt.Fprint(tail, "one\ntwo\nth")
+	assert.Equal(t, []string{"one", "two", "th"}, tail.Lines())
+
+	fmt.Fprint(tail, "ree\nfour\nfive")
+	assert.Equal(t, []string{"three", "four", "five"}, tail.Lines())
+
+	fmt.Fprint(tail, "\n")
+	assert.Equal(t, []string{"three", "four", "five"}, tail.Lines())
+}
+
+func TestTailFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "fc.log")
+
+	assert.Nil(t, tailFile(path, 2))
+
+	require.NoError(t, os.WriteFile(path, nil, 0600))
+	assert.Nil(t, tailFile(path, 2))
+
+	require.NoError(t, os.WriteFile(path, []byte("one\ntwo\nthree\n"), 0600))
+	assert.Equal(t, []string{"two", "three"}, tailFile(path, 2))
+
+	long := strings.Repeat("x", exitLogTailBytes) + "\nlast\n"
+	require.NoError(t, os.WriteFile(path, []byte(long), 0600))
+	assert.Equal(t, []string{"last"}, tailFile(path, 2))
+}
+
+func TestExitStatusExitCode(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "fc.log")
+	require.NoError(t, os.WriteFile(logPath, []byte("booting\nVmm is stopping.\n"), 0600))
+
+	m := newLifecycleTestMachine(t, WithProcessRunner(exec.Command("sh", "-c", "sleep 0.2; exit 3")))
+	m.Cfg.LogPath = logPath
+
+	assert.False(t, m.ExitStatus().Exited)
+
+	ctx := context.Background()
+	require.NoError(t, m.Start(ctx))
+	assert.Error(t, m.Wait(ctx))
+
+	info := m.ExitStatus()
+	assert.True(t, info.Exited)
+	assert.Equal(t, 3, info.ExitCode)
+	assert.Equal(t, syscall.Signal(0), info.Signal)
+	assert.False(t, info.SDKInitiated)
+	assert.Equal(t, ShutdownStageNone, info.ShutdownStage)
+	assert.False(t, info.SeccompViolation())
+	assert.Equal(t, []string{"booting", "Vmm is stopping."}, info.LogTail)
+	assert.Empty(t, info.CleanupErrors)
+	assert.Error(t, info.Err)
+}
+
+func TestExitStatusStopped(t *testing.T) {
+	m := newLifecycleTestMachine(t)
+
+	ctx := context.Background()
+	require.NoError(t, m.Start(ctx))
+	require.NoError(t, m.StopVMM())
+	m.Wait(ctx)
+
+	info := m.ExitStatus()
+	assert.True(t, info.Exited)
+	assert.Equal(t, -1, info.ExitCode)
+	assert.Equal(t, syscall.SIGTERM, info.Signal)
+	assert.True(t, info.SDKInitiated)
+	assert.Equal(t, ShutdownStageTerm, info.ShutdownStage)
+}
+
+func TestExitStatusCleanupErrors(t *testing.T) {
+	m := newLifecycleTestMachine(t)
+	m.cleanupFuncs = append(m.cleanupFuncs, func() error { return assert.AnError })
+
+	ctx := context.Background()
+	require.NoError(t, m.Start(ctx))
+	require.NoError(t, m.StopVMM())
+	m.Wait(ctx)
+
+	assert.Equal(t, []error{assert.AnError}, m.ExitStatus().CleanupErrors)
+}
@@ -0,0 +1,230 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// fake-firecracker is a stand-in for the firecracker binary in tests. It
+// accepts the command line of firecracker, serves the API with a
+// fctesting.FakeServer and exits once the guest is asked to shut down. What
+// happens to it is recorded, and it can be scripted to crash, hang or exit
+// with a given code, see fctesting.FakeBehavior.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
+	"time"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting/internal/fakeproc"
+)
+
+const (
+	defaultSocketPath = "/run/firecracker.socket"
+	defaultID         = "anonymous-instance"
+
+	// exitCodeBadConfiguration is the exit code of firecracker when it
+	// cannot start with the given arguments.
+	exitCodeBadConfiguration = 1
+	// exitCodeArgParsing is the exit code of firecracker when its arguments
+	// cannot be parsed.
+	exitCodeArgParsing = 153
+)
+
+// handledSignals are the signals recorded by fake-firecracker.
+var handledSignals = []os.Signal{
+	syscall.SIGABRT,
+	syscall.SIGHUP,
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGTERM,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+}
+
+type options struct {
+	apiSock       string
+	id            string
+	seccompFilter string
+	noSeccomp     bool
+	bootTimer     bool
+	configFile    string
+	noAPI         bool
+	version       bool
+}
+
+func parseArgs(args []string) (options, error) {
+	var opts options
+	flags := flag.NewFlagSet("firecracker", flag.ContinueOnError)
+	flags.StringVar(&opts.apiSock, "api-sock", defaultSocketPath, "Path to unix domain socket used by the API.")
+	flags.StringVar(&opts.id, "id", defaultID, "MicroVM unique identifier.")
+	flags.StringVar(&opts.seccompFilter, "seccomp-filter", "", "Optional parameter which allows specifying the path to a custom seccomp filter.")
+	flags.BoolVar(&opts.noSeccomp, "no-seccomp", false, "Optional parameter which allows starting and using a microVM without seccomp filtering.")
+	flags.BoolVar(&opts.bootTimer, "boot-timer", false, "Whether or not to load boot timer device for logging elapsed time since InstanceStart command.")
+	flags.StringVar(&opts.configFile, "config-file", "", "Path to a file that contains the microVM configuration in JSON format.")
+	flags.BoolVar(&opts.noAPI, "no-api", false, "Optional parameter which allows starting and using a microVM without an active API socket.")
+	flags.BoolVar(&opts.version, "version", false, "Print the binary version number.")
+	// accepted for compatibility, and ignored
+	flags.String("level", "", "Set the logger level.")
+	flags.String("log-path", "", "Path to a fifo or a file used for configuring the logger on startup.")
+	flags.Bool("show-level", false, "Whether or not to output the level in the logs.")
+	flags.Bool("show-log-origin", false, "Whether or not to include the file path and line number of the log's origin.")
+	flags.String("metrics-path", "", "Path to a fifo or a file used for configuring the metrics on startup.")
+	flags.String("start-time-us", "", "Process start time (wall clock, microseconds).")
+	flags.String("start-time-cpu-us", "", "Process start CPU time (wall clock, microseconds).")
+	flags.String("parent-cpu-time-us", "", "Parent process CPU time (wall clock, microseconds).")
+	flags.String("http-api-max-payload-size", "", "Http API request payload max size, in bytes.")
+	flags.String("mmds-size-limit", "", "Mmds data store limit, in bytes.")
+
+	if err := flags.Parse(args); err != nil {
+		return opts, err
+	}
+	if flags.NArg() > 0 {
+		return opts, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	switch {
+	case opts.noSeccomp && opts.seccompFilter != "":
+		return opts, fmt.Errorf("--no-seccomp and --seccomp-filter are mutually exclusive")
+	case opts.noAPI && opts.configFile == "":
+		return opts, fmt.Errorf("--no-api requires --config-file")
+	}
+	return opts, nil
+}
+
+func main() {
+	behavior, err := fctesting.LoadFakeBehavior()
+	if err != nil {
+		fatal(exitCodeBadConfiguration, err)
+	}
+
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		fatal(exitCodeArgParsing, err)
+	}
+
+	if opts.version {
+		fmt.Printf("Firecracker v%s\n\nSupported snapshot data format versions: v1.0.0\n", behavior.Version)
+		return
+	}
+
+	record(behavior, fctesting.FakeEvent{Type: fctesting.FakeEventStart, Args: os.Args[1:]})
+
+	signals := make(chan os.Signal, len(handledSignals))
+	signal.Notify(signals, handledSignals...)
+
+	var exitTimer <-chan time.Time
+	if exit := behavior.Firecracker.Exit; exit != nil {
+		exitTimer = time.After(exit.After)
+	}
+
+	var shutdown <-chan struct{}
+	if !behavior.Firecracker.Hang {
+		server, err := serve(behavior, opts)
+		if err != nil {
+			fatal(exitCodeBadConfiguration, err)
+		}
+		defer server.Close()
+		shutdown = server.ShutdownRequested()
+	}
+
+	for {
+		select {
+		case sig := <-signals:
+			record(behavior, fctesting.FakeEvent{Type: fctesting.FakeEventSignal, Signal: sig.(syscall.Signal)})
+			if !slices.Contains(behavior.Firecracker.IgnoreSignals, sig.(syscall.Signal)) {
+				// firecracker does not handle these signals
+				fakeproc.Crash(sig.(syscall.Signal))
+			}
+		case <-exitTimer:
+			exit := behavior.Firecracker.Exit
+			record(behavior, fctesting.FakeEvent{Type: fctesting.FakeEventExit, Code: exit.Code, Signal: exit.Signal})
+			if exit.Signal != 0 {
+				fakeproc.Crash(exit.Signal)
+			}
+			os.Exit(exit.Code)
+		case <-shutdown:
+			// the guest reboots on Ctrl+Alt+Del, after which firecracker
+			// exits
+			record(behavior, fctesting.FakeEvent{Type: fctesting.FakeEventExit})
+			return
+		}
+	}
+}
+
+// serve validates the arguments the way firecracker does and serves the API.
+func serve(behavior fctesting.FakeBehavior, opts options) (*fctesting.FakeServer, error) {
+	root := os.Getenv(fctesting.FakeRootEnv)
+	if opts.seccompFilter != "" {
+		if _, err := os.Stat(resolve(root, opts.seccompFilter)); err != nil {
+			return nil, fmt.Errorf("seccomp filter: %w", err)
+		}
+	}
+
+	server := fctesting.NewFakeServer(resolve(root, opts.apiSock))
+	server.ID = opts.id
+	server.Version = behavior.Version
+	server.BootTimer = opts.bootTimer
+	server.Root = root
+
+	if opts.configFile != "" {
+		data, err := os.ReadFile(resolve(root, opts.configFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the configuration file: %w", err)
+		}
+		var config models.FullVMConfiguration
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("invalid configuration file: %w", err)
+		}
+		if err := server.Boot(config); err != nil {
+			return nil, fmt.Errorf("failed to boot from the configuration file: %w", err)
+		}
+	}
+
+	if opts.noAPI {
+		return server, nil
+	}
+	if err := server.Start(); err != nil {
+		return nil, err
+	}
+	return server, nil
+}
+
+// resolve resolves an absolute path in the root of the chroot of the jailer,
+// if any. Relative paths are resolved in the working directory, which the
+// jailer sets to the root.
+func resolve(root, path string) string {
+	if root != "" && filepath.IsAbs(path) {
+		return filepath.Join(root, path)
+	}
+	return path
+}
+
+// record records event, exiting if it cannot be.
+func record(behavior fctesting.FakeBehavior, event fctesting.FakeEvent) {
+	event.Process = "firecracker"
+	event.PID = os.Getpid()
+	if err := behavior.Record(event); err != nil {
+		fatal(exitCodeBadConfiguration, err)
+	}
+}
+
+func fatal(code int, err error) {
+	fmt.Fprintf(os.Stderr, "firecracker: %v\n", err)
+	os.Exit(code)
+}
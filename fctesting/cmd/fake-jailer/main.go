@@ -0,0 +1,207 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// fake-jailer is a stand-in for the jailer binary in tests. It accepts the
+// command line of the jailer, creates the root directory of the chroot and
+// execs the exec file, usually fake-firecracker, in it. It does not chroot,
+// switch users, join a network namespace or set up cgroups: the exec file is
+// instead told about the root through the fctesting.FakeRootEnv environment
+// variable. It can be scripted to fail or hang before exec-ing, see
+// fctesting.FakeBehavior.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting/internal/fakeproc"
+)
+
+const (
+	defaultChrootBaseDir = "/srv/jailer"
+	rootfsFolderName     = "root"
+	maxIDLength          = 64
+
+	exitCodeFailure = 1
+)
+
+var idPattern = regexp.MustCompile(`^[a-zA-Z0-9-]+$`)
+
+// stringsFlag is a flag which may be given several times.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+type options struct {
+	id              string
+	execFile        string
+	uid             int
+	gid             int
+	chrootBaseDir   string
+	netNS           string
+	daemonize       bool
+	cgroups         stringsFlag
+	cgroupVersion   string
+	parentCgroup    string
+	firecrackerArgs []string
+}
+
+func parseArgs(args []string) (options, error) {
+	var opts options
+	flags := flag.NewFlagSet("jailer", flag.ContinueOnError)
+	flags.StringVar(&opts.id, "id", "", "Jail ID.")
+	flags.StringVar(&opts.execFile, "exec-file", "", "File path to exec into.")
+	flags.IntVar(&opts.uid, "uid", -1, "The user identifier the jailer switches to after exec.")
+	flags.IntVar(&opts.gid, "gid", -1, "The group identifier the jailer switches to after exec.")
+	flags.StringVar(&opts.chrootBaseDir, "chroot-base-dir", defaultChrootBaseDir, "The base folder where chroot jails are located.")
+	flags.StringVar(&opts.netNS, "netns", "", "Path to the network namespace this microVM should join.")
+	flags.BoolVar(&opts.daemonize, "daemonize", false, "Daemonize the jailer before exec, by invoking setsid(), and redirecting the standard I/O file descriptors to /dev/null.")
+	flags.Var(&opts.cgroups, "cgroup", "Cgroup and value to be set by the jailer. It must follow this format: <cgroup_file>=<value>.")
+	flags.StringVar(&opts.cgroupVersion, "cgroup-version", "1", "Select the cgroup version used by the jailer.")
+	flags.StringVar(&opts.parentCgroup, "parent-cgroup", "", "Parent cgroup in which the cgroup of this microvm will be placed.")
+	// accepted for compatibility, and ignored
+	flags.Bool("new-pid-ns", false, "Exec into a new PID namespace.")
+	flags.Var(new(stringsFlag), "resource-limit", "Resource limit values to be set by the jailer.")
+
+	// the arguments of firecracker follow --, which flag.Parse consumes
+	if i := slices.Index(args, "--"); i >= 0 {
+		opts.firecrackerArgs = args[i+1:]
+		args = args[:i]
+	}
+	if err := flags.Parse(args); err != nil {
+		return opts, err
+	}
+	if flags.NArg() > 0 {
+		return opts, fmt.Errorf("unexpected argument %q", flags.Arg(0))
+	}
+
+	switch {
+	case opts.id == "":
+		return opts, fmt.Errorf("missing argument: --id")
+	case len(opts.id) > maxIDLength || !idPattern.MatchString(opts.id):
+		return opts, fmt.Errorf("invalid instance ID: %q", opts.id)
+	case opts.execFile == "":
+		return opts, fmt.Errorf("missing argument: --exec-file")
+	case opts.uid < 0:
+		return opts, fmt.Errorf("missing argument: --uid")
+	case opts.gid < 0:
+		return opts, fmt.Errorf("missing argument: --gid")
+	case opts.cgroupVersion != "1" && opts.cgroupVersion != "2":
+		return opts, fmt.Errorf("invalid cgroup version: %q", opts.cgroupVersion)
+	}
+	for _, cgroup := range opts.cgroups {
+		if !strings.Contains(cgroup, "=") {
+			return opts, fmt.Errorf("invalid cgroup argument: %q", cgroup)
+		}
+	}
+	return opts, nil
+}
+
+func main() {
+	behavior, err := fctesting.LoadFakeBehavior()
+	if err != nil {
+		fatal(err)
+	}
+
+	record(behavior, fctesting.FakeEvent{Type: fctesting.FakeEventStart, Args: os.Args[1:]})
+
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		fatal(err)
+	}
+
+	if exit := behavior.Jailer.Exit; exit != nil {
+		time.Sleep(exit.After)
+		record(behavior, fctesting.FakeEvent{Type: fctesting.FakeEventExit, Code: exit.Code, Signal: exit.Signal})
+		if exit.Signal != 0 {
+			fakeproc.Crash(exit.Signal)
+		}
+		os.Exit(exit.Code)
+	}
+	if behavior.Jailer.Hang {
+		for {
+			time.Sleep(time.Hour)
+		}
+	}
+
+	execFile, err := filepath.Abs(opts.execFile)
+	if err != nil {
+		fatal(err)
+	}
+	if _, err := os.Stat(execFile); err != nil {
+		fatal(fmt.Errorf("invalid exec file: %w", err))
+	}
+
+	root := filepath.Join(opts.chrootBaseDir, filepath.Base(execFile), opts.id, rootfsFolderName)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		fatal(fmt.Errorf("failed to create the chroot: %w", err))
+	}
+	if err := os.Chdir(root); err != nil {
+		fatal(err)
+	}
+
+	now := time.Now().UnixMicro()
+	args := append([]string{
+		execFile,
+		"--id", opts.id,
+		"--start-time-us", strconv.FormatInt(now, 10),
+		"--start-time-cpu-us", "0",
+	}, opts.firecrackerArgs...)
+	env := append(os.Environ(), fctesting.FakeRootEnv+"="+root)
+
+	if opts.daemonize {
+		// the jailer exits once the exec file was started in a new session
+		cmd := exec.Command(execFile, args[1:]...)
+		cmd.Env = env
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+		if err := cmd.Start(); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if err := syscall.Exec(execFile, args, env); err != nil {
+		fatal(fmt.Errorf("failed to exec %s: %w", execFile, err))
+	}
+}
+
+// record records event, exiting if it cannot be.
+func record(behavior fctesting.FakeBehavior, event fctesting.FakeEvent) {
+	event.Process = "jailer"
+	event.PID = os.Getpid()
+	if err := behavior.Record(event); err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "jailer: %v\n", err)
+	os.Exit(exitCodeFailure)
+}
@@ -0,0 +1,204 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fctesting
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const (
+	// FakeBehaviorEnv is the environment variable the fake firecracker and
+	// jailer binaries read their FakeBehavior from, encoded as JSON.
+	FakeBehaviorEnv = "FC_FAKE_BEHAVIOR"
+	// FakeRootEnv is the environment variable the fake jailer passes the
+	// root of its chroot in to the fake firecracker, which resolves its
+	// absolute paths in it since it does not actually chroot.
+	FakeRootEnv = "FC_FAKE_ROOT"
+
+	fakeFirecrackerPackage = "github.com/firecracker-microvm/firecracker-go-sdk/fctesting/cmd/fake-firecracker"
+	fakeJailerPackage      = "github.com/firecracker-microvm/firecracker-go-sdk/fctesting/cmd/fake-jailer"
+)
+
+// Types of FakeEvent.
+const (
+	// FakeEventStart is recorded when a fake binary starts, with its
+	// arguments.
+	FakeEventStart = "start"
+	// FakeEventSignal is recorded when a fake binary receives a signal.
+	FakeEventSignal = "signal"
+	// FakeEventExit is recorded when a fake binary exits on its own, with
+	// its exit code or the signal it crashes with.
+	FakeEventExit = "exit"
+)
+
+// FakeBehavior scripts the fake binaries built by BuildFakeBinaries. It is
+// read from the FakeBehaviorEnv environment variable, see SetFakeBehavior.
+type FakeBehavior struct {
+	// EventsPath is the file the fake binaries append their FakeEvents to, as
+	// JSON lines. Nothing is recorded if it is empty.
+	EventsPath string `json:"events_path,omitempty"`
+	// Version is the version printed by firecracker --version and reported by
+	// its API, DefaultFakeServerVersion by default.
+	Version string `json:"version,omitempty"`
+	// Firecracker scripts the fake firecracker.
+	Firecracker FakeProcessBehavior `json:"firecracker"`
+	// Jailer scripts the fake jailer. Its IgnoreSignals are not used, since
+	// the jailer execs firecracker.
+	Jailer FakeProcessBehavior `json:"jailer"`
+}
+
+// FakeProcessBehavior scripts one of the fake binaries.
+type FakeProcessBehavior struct {
+	// Exit makes the process exit on its own. The jailer then exits before
+	// exec-ing firecracker.
+	Exit *FakeExit `json:"exit,omitempty"`
+	// Hang makes firecracker never create its API socket, and the jailer
+	// never exec firecracker.
+	Hang bool `json:"hang,omitempty"`
+	// IgnoreSignals are the signals firecracker records and otherwise
+	// ignores. The other signals are recorded, and then take their default
+	// action, which usually terminates the process.
+	IgnoreSignals []syscall.Signal `json:"ignore_signals,omitempty"`
+}
+
+// FakeExit is how and when a fake binary exits on its own.
+type FakeExit struct {
+	// After is the time the process runs for before exiting.
+	After time.Duration `json:"after,omitempty"`
+	// Code is the exit code of the process.
+	Code int `json:"code,omitempty"`
+	// Signal, if set, makes the process crash with the given signal instead
+	// of exiting with Code.
+	Signal syscall.Signal `json:"signal,omitempty"`
+}
+
+// FakeEvent is something that happened to a fake binary.
+type FakeEvent struct {
+	// Process is "firecracker" or "jailer".
+	Process string `json:"process"`
+	// PID is the process ID of the binary.
+	PID int `json:"pid"`
+	// Type is one of FakeEventStart, FakeEventSignal or FakeEventExit.
+	Type string `json:"type"`
+	// Args are the arguments of the binary, without its name.
+	Args []string `json:"args,omitempty"`
+	// Signal is the signal received or crashed with.
+	Signal syscall.Signal `json:"signal,omitempty"`
+	// Code is the exit code.
+	Code int `json:"code,omitempty"`
+}
+
+// LoadFakeBehavior reads the FakeBehavior of a fake binary from the
+// environment.
+func LoadFakeBehavior() (FakeBehavior, error) {
+	var behavior FakeBehavior
+	if v := os.Getenv(FakeBehaviorEnv); v != "" {
+		if err := json.Unmarshal([]byte(v), &behavior); err != nil {
+			return behavior, fmt.Errorf("invalid %s: %w", FakeBehaviorEnv, err)
+		}
+	}
+	if behavior.Version == "" {
+		behavior.Version = DefaultFakeServerVersion
+	}
+	return behavior, nil
+}
+
+// Record appends event to the EventsPath of the behavior, if any.
+func (b FakeBehavior) Record(event FakeEvent) error {
+	if b.EventsPath == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(b.EventsPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// A single write keeps the lines of concurrent processes apart.
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// SetFakeBehavior sets the behavior of the fake binaries started by the
+// test, and of their children, for the duration of the test.
+func SetFakeBehavior(t testing.TB, behavior FakeBehavior) {
+	data, err := json.Marshal(behavior)
+	if err != nil {
+		t.Fatalf("failed to marshal the fake behavior: %v", err)
+	}
+	t.Setenv(FakeBehaviorEnv, string(data))
+}
+
+// ReadFakeEvents returns the events recorded in path so far.
+func ReadFakeEvents(path string) ([]FakeEvent, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []FakeEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event FakeEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return nil, fmt.Errorf("invalid event %q: %w", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+// BuildFakeBinaries builds a fake firecracker and a fake jailer into a
+// temporary directory of the test, and returns their paths. The binaries
+// parse the command line of the real ones, serve the API with a FakeServer
+// and record what happens to them, as scripted by SetFakeBehavior.
+//
+// The test is skipped if the go command is not available.
+func BuildFakeBinaries(t testing.TB) (firecracker, jailer string) {
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skipf("building the fake binaries requires the go command: %v", err)
+	}
+
+	dir := t.TempDir()
+	firecracker = filepath.Join(dir, "firecracker")
+	jailer = filepath.Join(dir, "jailer")
+	for pkg, out := range map[string]string{
+		fakeFirecrackerPackage: firecracker,
+		fakeJailerPackage:      jailer,
+	} {
+		cmd := exec.Command(goBin, "build", "-o", out, pkg)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("failed to build %s: %v\n%s", pkg, err, output)
+		}
+	}
+	return firecracker, jailer
+}
@@ -0,0 +1,85 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fctesting
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFakeBinaries(t *testing.T) {
+	firecracker, jailer := BuildFakeBinaries(t)
+
+	out, err := exec.Command(firecracker, "--version").Output()
+	if err != nil {
+		t.Fatalf("failed to run firecracker --version: %v", err)
+	}
+	if !strings.HasPrefix(string(out), "Firecracker v"+DefaultFakeServerVersion+"\n") {
+		t.Errorf("unexpected version %q", out)
+	}
+
+	if err := exec.Command(firecracker, "--no-seccomp", "--seccomp-filter", "/filter").Run(); err == nil {
+		t.Errorf("expected conflicting flags to be refused")
+	}
+
+	dir := t.TempDir()
+	eventsPath := filepath.Join(dir, "events.jsonl")
+	SetFakeBehavior(t, FakeBehavior{
+		EventsPath:  eventsPath,
+		Firecracker: FakeProcessBehavior{Exit: &FakeExit{Code: 3}},
+	})
+
+	jailerArgs := []string{
+		"--id", "vm-1",
+		"--uid", "123",
+		"--gid", "100",
+		"--exec-file", firecracker,
+		"--chroot-base-dir", dir,
+		"--cgroup", "cpu.shares=10",
+		"--",
+		"--api-sock", "/api.sock",
+		"--no-seccomp",
+	}
+	err = exec.Command(jailer, jailerArgs...).Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 3 {
+		t.Errorf("expected the scripted exit code 3, but received %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "firecracker", "vm-1", "root")); err != nil {
+		t.Errorf("expected the chroot to be created: %v", err)
+	}
+
+	events, err := ReadFakeEvents(eventsPath)
+	if err != nil {
+		t.Fatalf("failed to read the events: %v", err)
+	}
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, but received %+v", events)
+	}
+	if e := events[0]; e.Process != "jailer" || e.Type != FakeEventStart || !reflect.DeepEqual(e.Args, jailerArgs) {
+		t.Errorf("unexpected jailer start %+v", e)
+	}
+	if e := events[1]; e.Process != "firecracker" || e.Type != FakeEventStart || e.PID != events[0].PID {
+		t.Errorf("expected firecracker to be exec-ed by the jailer, received %+v", e)
+	}
+	if args := strings.Join(events[1].Args, " "); !strings.HasPrefix(args, "--id vm-1 ") || !strings.HasSuffix(args, " --api-sock /api.sock --no-seccomp") {
+		t.Errorf("unexpected firecracker args %q", args)
+	}
+	if e := events[2]; e.Type != FakeEventExit || e.Code != 3 {
+		t.Errorf("unexpected exit %+v", e)
+	}
+}
@@ -0,0 +1,899 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fctesting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/swag"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+)
+
+const (
+	// DefaultFakeServerVersion is the Firecracker version reported by a
+	// FakeServer, unless set otherwise.
+	DefaultFakeServerVersion = "1.4.1"
+
+	errPreBootOnly  = "The requested operation is not supported after starting the microVM."
+	errPostBootOnly = "The requested operation is not supported before starting the microVM."
+)
+
+// Fault is an error returned by a FakeServer instead of handling a request.
+type Fault struct {
+	// StatusCode is the HTTP status of the response, 400 by default.
+	StatusCode int
+	// FaultMessage is the error message of the response. If both StatusCode
+	// and FaultMessage are empty, the request is handled after Delay.
+	FaultMessage string
+	// Delay is how long the response is delayed.
+	Delay time.Duration
+	// Count is the number of requests which fail, or 0 for all of them.
+	Count int
+}
+
+// FakeServer is an in-process fake of the Firecracker API, served on a unix
+// socket. It keeps the configuration it receives and enforces the rules of
+// Firecracker on the state of the VM: the resources can only be configured
+// before InstanceStart, PatchVM pauses and resumes the VM, which must be
+// paused to create a snapshot, and snapshots can only be loaded by a VMM
+// which has not been configured.
+//
+// It does not run a guest and does not access the files referenced by the
+// configuration, except for the log and metrics files, which are written to,
+// and the snapshot files, which are written by CreateSnapshot and read by
+// LoadSnapshot.
+type FakeServer struct {
+	// SocketPath is the path of the unix socket the API is served on.
+	SocketPath string
+	// ID is the ID of the VM reported by DescribeInstance.
+	ID string
+	// Version is the Firecracker version reported by the API.
+	Version string
+	// BootTimer writes the boot time of the guest to the log on
+	// InstanceStart, like Firecracker started with --boot-timer.
+	BootTimer bool
+	// Root is the directory the absolute paths of the log, metrics and
+	// snapshot files are resolved in, like the chroot of a jailed Firecracker.
+	// By default, they are used as is.
+	Root string
+
+	listener net.Listener
+	server   *http.Server
+	mux      *http.ServeMux
+
+	mu             sync.Mutex
+	state          string
+	config         models.FullVMConfiguration
+	mmds           interface{}
+	calls          []string
+	faults         map[string]*Fault
+	logFile        *os.File
+	metricsFile    *os.File
+	shutdown       chan struct{}
+	shutdownClosed bool
+}
+
+// fakeError is the error of a request handled by a FakeServer.
+type fakeError struct {
+	status  int
+	message string
+}
+
+func (e *fakeError) Error() string {
+	return e.message
+}
+
+func badRequest(format string, args ...interface{}) error {
+	return &fakeError{status: http.StatusBadRequest, message: fmt.Sprintf(format, args...)}
+}
+
+// fakeSnapshot is the content of the snapshot files written by a FakeServer.
+type fakeSnapshot struct {
+	Version string                     `json:"version"`
+	Config  models.FullVMConfiguration `json:"config"`
+	Mmds    interface{}                `json:"mmds,omitempty"`
+}
+
+// NewFakeServer returns a FakeServer serving the API on socketPath once
+// started.
+func NewFakeServer(socketPath string) *FakeServer {
+	s := &FakeServer{
+		SocketPath: socketPath,
+		ID:         "anonymous-instance",
+		Version:    DefaultFakeServerVersion,
+		state:      models.InstanceInfoStateNotStarted,
+		faults:     make(map[string]*Fault),
+		shutdown:   make(chan struct{}),
+		mux:        http.NewServeMux(),
+	}
+	s.config.MachineConfig = &models.MachineConfiguration{
+		VcpuCount:  swag.Int64(1),
+		MemSizeMib: swag.Int64(128),
+		Smt:        swag.Bool(false),
+	}
+	s.routes()
+	return s
+}
+
+// Start listens on SocketPath and serves the API in the background.
+func (s *FakeServer) Start() error {
+	listener, err := net.Listen("unix", s.SocketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.SocketPath, err)
+	}
+
+	s.listener = listener
+	s.server = &http.Server{Handler: s.mux}
+	go s.server.Serve(listener)
+	return nil
+}
+
+// Close stops serving the API and removes the socket.
+func (s *FakeServer) Close() error {
+	var err error
+	if s.server != nil {
+		err = s.server.Close()
+	}
+	if rmErr := os.Remove(s.SocketPath); rmErr != nil && !os.IsNotExist(rmErr) && err == nil {
+		err = rmErr
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, f := range []*os.File{s.logFile, s.metricsFile} {
+		if f != nil {
+			f.Close()
+		}
+	}
+	return err
+}
+
+// InjectFault makes the requests of the given operation, such as
+// PutGuestDriveByID, fail with fault.
+func (s *FakeServer) InjectFault(operation string, fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[operation] = &fault
+}
+
+// ClearFaults removes the faults injected with InjectFault.
+func (s *FakeServer) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = make(map[string]*Fault)
+}
+
+// Calls returns the operations of the requests received so far, in order.
+func (s *FakeServer) Calls() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.calls...)
+}
+
+// State returns the state of the VM, as reported by DescribeInstance.
+func (s *FakeServer) State() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+// Config returns the configuration of the VM.
+func (s *FakeServer) Config() models.FullVMConfiguration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.config
+}
+
+// ShutdownRequested returns a channel which is closed once a SendCtrlAltDel
+// action was received, at which point the guest of a real VMM would shut
+// down.
+func (s *FakeServer) ShutdownRequested() <-chan struct{} {
+	return s.shutdown
+}
+
+// Boot configures the VM and starts it without going through the API, like
+// Firecracker started with --config-file.
+func (s *FakeServer) Boot(config models.FullVMConfiguration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.state != models.InstanceInfoStateNotStarted {
+		return errors.New(errPreBootOnly)
+	}
+
+	if config.Logger != nil {
+		f, err := s.openOutput(swag.StringValue(config.Logger.LogPath))
+		if err != nil {
+			return err
+		}
+		s.logFile = f
+		s.logf("Running Firecracker v%s", s.Version)
+	}
+	if config.Metrics != nil {
+		f, err := s.openOutput(swag.StringValue(config.Metrics.MetricsPath))
+		if err != nil {
+			return err
+		}
+		s.metricsFile = f
+	}
+	if config.MachineConfig == nil {
+		config.MachineConfig = s.config.MachineConfig
+	}
+	s.config = config
+
+	return s.startInstance()
+}
+
+// stateRule returns the error of an operation not allowed in the given state,
+// if any.
+type stateRule func(state string) error
+
+func anyState(string) error {
+	return nil
+}
+
+func preBoot(state string) error {
+	if state != models.InstanceInfoStateNotStarted {
+		return badRequest(errPreBootOnly)
+	}
+	return nil
+}
+
+func postBoot(state string) error {
+	if state == models.InstanceInfoStateNotStarted {
+		return badRequest(errPostBootOnly)
+	}
+	return nil
+}
+
+func (s *FakeServer) routes() {
+	s.handle("GET /{$}", "DescribeInstance", anyState, s.describeInstance)
+	s.handle("PUT /actions", "CreateSyncAction", anyState, s.createSyncAction)
+	s.handle("GET /balloon", "DescribeBalloonConfig", anyState, s.describeBalloonConfig)
+	s.handle("PUT /balloon", "PutBalloon", preBoot, s.putBalloon)
+	s.handle("PATCH /balloon", "PatchBalloon", postBoot, s.patchBalloon)
+	s.handle("GET /balloon/statistics", "DescribeBalloonStats", anyState, s.describeBalloonStats)
+	s.handle("PATCH /balloon/statistics", "PatchBalloonStatsInterval", postBoot, s.patchBalloonStatsInterval)
+	s.handle("PUT /boot-source", "PutGuestBootSource", preBoot, s.putGuestBootSource)
+	s.handle("PUT /cpu-config", "PutCPUConfiguration", preBoot, s.putCPUConfiguration)
+	s.handle("PUT /drives/{drive_id}", "PutGuestDriveByID", preBoot, s.putGuestDriveByID)
+	s.handle("PATCH /drives/{drive_id}", "PatchGuestDriveByID", postBoot, s.patchGuestDriveByID)
+	s.handle("PUT /entropy", "PutEntropyDevice", preBoot, s.putEntropyDevice)
+	s.handle("PUT /logger", "PutLogger", preBoot, s.putLogger)
+	s.handle("GET /machine-config", "GetMachineConfiguration", anyState, s.getMachineConfiguration)
+	s.handle("PUT /machine-config", "PutMachineConfiguration", preBoot, s.putMachineConfiguration)
+	s.handle("PATCH /machine-config", "PatchMachineConfiguration", preBoot, s.patchMachineConfiguration)
+	s.handle("PUT /metrics", "PutMetrics", preBoot, s.putMetrics)
+	s.handle("GET /mmds", "GetMmds", anyState, s.getMmds)
+	s.handle("PUT /mmds", "PutMmds", anyState, s.putMmds)
+	s.handle("PATCH /mmds", "PatchMmds", anyState, s.patchMmds)
+	s.handle("PUT /mmds/config", "PutMmdsConfig", preBoot, s.putMmdsConfig)
+	s.handle("PUT /network-interfaces/{iface_id}", "PutGuestNetworkInterfaceByID", preBoot, s.putGuestNetworkInterfaceByID)
+	s.handle("PATCH /network-interfaces/{iface_id}", "PatchGuestNetworkInterfaceByID", postBoot, s.patchGuestNetworkInterfaceByID)
+	s.handle("PUT /snapshot/create", "CreateSnapshot", postBoot, s.createSnapshot)
+	s.handle("PUT /snapshot/load", "LoadSnapshot", preBoot, s.loadSnapshot)
+	s.handle("GET /version", "GetFirecrackerVersion", anyState, s.getFirecrackerVersion)
+	s.handle("PATCH /vm", "PatchVM", postBoot, s.patchVM)
+	s.handle("GET /vm/config", "GetExportVMConfig", anyState, s.getExportVMConfig)
+	s.handle("PUT /vsock", "PutGuestVsock", preBoot, s.putGuestVsock)
+}
+
+// handle serves the operation on pattern. fn is called with the lock held, and
+// returns the payload of the response, if any.
+func (s *FakeServer) handle(pattern, operation string, rule stateRule, fn func(*http.Request) (interface{}, error)) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.calls = append(s.calls, operation)
+		fault := s.takeFault(operation)
+		s.mu.Unlock()
+
+		if fault != nil {
+			time.Sleep(fault.Delay)
+			if fault.StatusCode != 0 || fault.FaultMessage != "" {
+				status := fault.StatusCode
+				if status == 0 {
+					status = http.StatusBadRequest
+				}
+				writeFault(w, status, fault.FaultMessage)
+				return
+			}
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		err := rule(s.state)
+		var payload interface{}
+		if err == nil {
+			payload, err = fn(r)
+		}
+
+		var fe *fakeError
+		switch {
+		case errors.As(err, &fe):
+			writeFault(w, fe.status, fe.message)
+		case err != nil:
+			writeFault(w, http.StatusInternalServerError, err.Error())
+		case payload == nil:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(payload)
+		}
+	})
+}
+
+// takeFault returns the fault injected for the operation, if any.
+func (s *FakeServer) takeFault(operation string) *Fault {
+	fault, ok := s.faults[operation]
+	if !ok {
+		return nil
+	}
+
+	if fault.Count > 0 {
+		fault.Count--
+		if fault.Count == 0 {
+			delete(s.faults, operation)
+		}
+	}
+	return fault
+}
+
+func writeFault(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&models.Error{FaultMessage: message})
+}
+
+// decode decodes the body of r into v, and validates it against the swagger
+// definition of the API.
+func decode(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+		return badRequest("Invalid request body: %v", err)
+	}
+
+	if validator, ok := v.(interface{ Validate(strfmt.Registry) error }); ok {
+		if err := validator.Validate(strfmt.Default); err != nil {
+			return badRequest("Invalid request body: %v", err)
+		}
+	}
+	return nil
+}
+
+// path resolves a path received by the API in Root.
+func (s *FakeServer) path(path string) string {
+	if s.Root != "" && filepath.IsAbs(path) {
+		return filepath.Join(s.Root, path)
+	}
+	return path
+}
+
+// openOutput opens a log or metrics file the way Firecracker does, which
+// does not block on a named pipe without a reader.
+func (s *FakeServer) openOutput(path string) (*os.File, error) {
+	f, err := os.OpenFile(s.path(path), os.O_RDWR|os.O_APPEND|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, badRequest("Cannot open %s: %v", path, err)
+	}
+	return f, nil
+}
+
+func (s *FakeServer) logf(format string, args ...interface{}) {
+	if s.logFile == nil {
+		return
+	}
+
+	timestamp := time.Now().Format("2006-01-02T15:04:05.000000000")
+	fmt.Fprintf(s.logFile, "%s [%s:main] %s\n", timestamp, s.ID, fmt.Sprintf(format, args...))
+}
+
+func (s *FakeServer) flushMetrics() error {
+	if s.metricsFile == nil {
+		return badRequest("Metrics system not initialized.")
+	}
+
+	counts := make(map[string]int)
+	for _, call := range s.calls {
+		counts[call]++
+	}
+	sample := map[string]interface{}{
+		"utc_timestamp_ms": time.Now().UnixNano() / int64(time.Millisecond),
+		"put_api_requests": map[string]int{
+			"actions_count":     counts["CreateSyncAction"],
+			"boot_source_count": counts["PutGuestBootSource"],
+			"drive_count":       counts["PutGuestDriveByID"],
+			"logger_count":      counts["PutLogger"],
+			"machine_cfg_count": counts["PutMachineConfiguration"],
+			"metrics_count":     counts["PutMetrics"],
+			"network_count":     counts["PutGuestNetworkInterfaceByID"],
+		},
+	}
+	// like Firecracker v1.5 and later, which also write the metrics of every
+	// device
+	for _, drive := range s.config.Drives {
+		sample["block_"+*drive.DriveID] = map[string]int{}
+	}
+	for _, iface := range s.config.NetworkInterfaces {
+		sample["net_"+*iface.IfaceID] = map[string]int{}
+	}
+
+	data, err := json.Marshal(sample)
+	if err != nil {
+		return err
+	}
+	_, err = s.metricsFile.Write(append(data, '\n'))
+	return err
+}
+
+func (s *FakeServer) describeInstance(r *http.Request) (interface{}, error) {
+	return &models.InstanceInfo{
+		AppName:    swag.String("Firecracker"),
+		ID:         swag.String(s.ID),
+		State:      swag.String(s.state),
+		VmmVersion: swag.String(s.Version),
+	}, nil
+}
+
+func (s *FakeServer) createSyncAction(r *http.Request) (interface{}, error) {
+	var info models.InstanceActionInfo
+	if err := decode(r, &info); err != nil {
+		return nil, err
+	}
+
+	switch *info.ActionType {
+	case models.InstanceActionInfoActionTypeInstanceStart:
+		if s.state != models.InstanceInfoStateNotStarted {
+			return nil, badRequest(errPreBootOnly)
+		}
+		if err := s.startInstance(); err != nil {
+			return nil, err
+		}
+	case models.InstanceActionInfoActionTypeSendCtrlAltDel:
+		if s.state == models.InstanceInfoStateNotStarted {
+			return nil, badRequest(errPostBootOnly)
+		}
+		if !s.shutdownClosed {
+			s.shutdownClosed = true
+			close(s.shutdown)
+		}
+	case models.InstanceActionInfoActionTypeFlushMetrics:
+		if err := s.flushMetrics(); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (s *FakeServer) startInstance() error {
+	if s.config.BootSource == nil {
+		return badRequest("Cannot start microvm without kernel configuration.")
+	}
+
+	s.state = models.InstanceInfoStateRunning
+	s.logf("Successfully started microvm that was configured from one single json")
+	if s.BootTimer {
+		s.logf("Guest-boot-time = %6d us %d ms, %6d CPU us %d CPU ms", 1000, 1, 900, 0)
+	}
+	return nil
+}
+
+func (s *FakeServer) describeBalloonConfig(r *http.Request) (interface{}, error) {
+	if s.config.Balloon == nil {
+		return nil, badRequest("The balloon device was not found.")
+	}
+	return s.config.Balloon, nil
+}
+
+func (s *FakeServer) putBalloon(r *http.Request) (interface{}, error) {
+	var balloon models.Balloon
+	if err := decode(r, &balloon); err != nil {
+		return nil, err
+	}
+	s.config.Balloon = &balloon
+	return nil, nil
+}
+
+func (s *FakeServer) patchBalloon(r *http.Request) (interface{}, error) {
+	var update models.BalloonUpdate
+	if err := decode(r, &update); err != nil {
+		return nil, err
+	}
+	if s.config.Balloon == nil {
+		return nil, badRequest("The balloon device was not found.")
+	}
+	s.config.Balloon.AmountMib = update.AmountMib
+	return nil, nil
+}
+
+func (s *FakeServer) describeBalloonStats(r *http.Request) (interface{}, error) {
+	if s.config.Balloon == nil {
+		return nil, badRequest("The balloon device was not found.")
+	}
+	if s.config.Balloon.StatsPollingIntervals == 0 {
+		return nil, badRequest("Statistics for the balloon device are not enabled.")
+	}
+	return &models.BalloonStats{
+		TargetMib:   s.config.Balloon.AmountMib,
+		ActualMib:   s.config.Balloon.AmountMib,
+		TargetPages: swag.Int64(*s.config.Balloon.AmountMib * 256),
+		ActualPages: swag.Int64(*s.config.Balloon.AmountMib * 256),
+	}, nil
+}
+
+func (s *FakeServer) patchBalloonStatsInterval(r *http.Request) (interface{}, error) {
+	var update models.BalloonStatsUpdate
+	if err := decode(r, &update); err != nil {
+		return nil, err
+	}
+	if s.config.Balloon == nil {
+		return nil, badRequest("The balloon device was not found.")
+	}
+	if s.config.Balloon.StatsPollingIntervals == 0 {
+		return nil, badRequest("Statistics for the balloon device are not enabled.")
+	}
+	s.config.Balloon.StatsPollingIntervals = *update.StatsPollingIntervals
+	return nil, nil
+}
+
+func (s *FakeServer) putGuestBootSource(r *http.Request) (interface{}, error) {
+	var source models.BootSource
+	if err := decode(r, &source); err != nil {
+		return nil, err
+	}
+	s.config.BootSource = &source
+	return nil, nil
+}
+
+func (s *FakeServer) putCPUConfiguration(r *http.Request) (interface{}, error) {
+	var cpuConfig models.CPUConfig
+	if err := decode(r, &cpuConfig); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+func (s *FakeServer) putGuestDriveByID(r *http.Request) (interface{}, error) {
+	var drive models.Drive
+	if err := decode(r, &drive); err != nil {
+		return nil, err
+	}
+	if id := r.PathValue("drive_id"); *drive.DriveID != id {
+		return nil, badRequest("The id from the path [%s] does not match the id from the body [%s]!", id, *drive.DriveID)
+	}
+
+	for i, d := range s.config.Drives {
+		if *d.DriveID == *drive.DriveID {
+			s.config.Drives[i] = &drive
+			return nil, nil
+		}
+	}
+	s.config.Drives = append(s.config.Drives, &drive)
+	return nil, nil
+}
+
+func (s *FakeServer) patchGuestDriveByID(r *http.Request) (interface{}, error) {
+	var partial models.PartialDrive
+	if err := decode(r, &partial); err != nil {
+		return nil, err
+	}
+
+	for _, d := range s.config.Drives {
+		if *d.DriveID == r.PathValue("drive_id") {
+			if partial.PathOnHost != "" {
+				d.PathOnHost = swag.String(partial.PathOnHost)
+			}
+			if partial.RateLimiter != nil {
+				d.RateLimiter = partial.RateLimiter
+			}
+			return nil, nil
+		}
+	}
+	return nil, badRequest("The drive %s was not found.", r.PathValue("drive_id"))
+}
+
+func (s *FakeServer) putEntropyDevice(r *http.Request) (interface{}, error) {
+	var device models.EntropyDevice
+	return nil, decode(r, &device)
+}
+
+func (s *FakeServer) putLogger(r *http.Request) (interface{}, error) {
+	var logger models.Logger
+	if err := decode(r, &logger); err != nil {
+		return nil, err
+	}
+	if s.logFile != nil {
+		return nil, badRequest("Reinitialization of logger not allowed.")
+	}
+
+	f, err := s.openOutput(swag.StringValue(logger.LogPath))
+	if err != nil {
+		return nil, err
+	}
+	s.logFile = f
+	s.config.Logger = &logger
+	s.logf("Running Firecracker v%s", s.Version)
+	return nil, nil
+}
+
+func (s *FakeServer) getMachineConfiguration(r *http.Request) (interface{}, error) {
+	return s.config.MachineConfig, nil
+}
+
+func (s *FakeServer) putMachineConfiguration(r *http.Request) (interface{}, error) {
+	var machineConfig models.MachineConfiguration
+	if err := decode(r, &machineConfig); err != nil {
+		return nil, err
+	}
+	s.config.MachineConfig = &machineConfig
+	return nil, nil
+}
+
+func (s *FakeServer) patchMachineConfiguration(r *http.Request) (interface{}, error) {
+	var update models.MachineConfiguration
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		return nil, badRequest("Invalid request body: %v", err)
+	}
+
+	machineConfig := *s.config.MachineConfig
+	if update.VcpuCount != nil {
+		machineConfig.VcpuCount = update.VcpuCount
+	}
+	if update.MemSizeMib != nil {
+		machineConfig.MemSizeMib = update.MemSizeMib
+	}
+	if update.Smt != nil {
+		machineConfig.Smt = update.Smt
+	}
+	if update.TrackDirtyPages != nil {
+		machineConfig.TrackDirtyPages = update.TrackDirtyPages
+	}
+	if update.CPUTemplate != "" {
+		machineConfig.CPUTemplate = update.CPUTemplate
+	}
+	s.config.MachineConfig = &machineConfig
+	return nil, nil
+}
+
+func (s *FakeServer) putMetrics(r *http.Request) (interface{}, error) {
+	var metrics models.Metrics
+	if err := decode(r, &metrics); err != nil {
+		return nil, err
+	}
+	if s.metricsFile != nil {
+		return nil, badRequest("Reinitialization of metrics not allowed.")
+	}
+
+	f, err := s.openOutput(swag.StringValue(metrics.MetricsPath))
+	if err != nil {
+		return nil, err
+	}
+	s.metricsFile = f
+	s.config.Metrics = &metrics
+	return nil, nil
+}
+
+func (s *FakeServer) getMmds(r *http.Request) (interface{}, error) {
+	if s.mmds == nil {
+		return map[string]interface{}{}, nil
+	}
+	return s.mmds, nil
+}
+
+func (s *FakeServer) putMmds(r *http.Request) (interface{}, error) {
+	var mmds interface{}
+	if err := decode(r, &mmds); err != nil {
+		return nil, err
+	}
+	s.mmds = mmds
+	return nil, nil
+}
+
+func (s *FakeServer) patchMmds(r *http.Request) (interface{}, error) {
+	var patch interface{}
+	if err := decode(r, &patch); err != nil {
+		return nil, err
+	}
+	s.mmds = mergePatch(s.mmds, patch)
+	return nil, nil
+}
+
+// mergePatch applies a JSON merge patch (RFC 7396), as PatchMmds does.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = make(map[string]interface{})
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(targetObj, k)
+			continue
+		}
+		targetObj[k] = mergePatch(targetObj[k], v)
+	}
+	return targetObj
+}
+
+func (s *FakeServer) putMmdsConfig(r *http.Request) (interface{}, error) {
+	var mmdsConfig models.MmdsConfig
+	if err := decode(r, &mmdsConfig); err != nil {
+		return nil, err
+	}
+
+	for _, id := range mmdsConfig.NetworkInterfaces {
+		if s.networkInterface(id) == nil {
+			return nil, badRequest("The network interface %s was not found.", id)
+		}
+	}
+	s.config.MmdsConfig = &mmdsConfig
+	return nil, nil
+}
+
+func (s *FakeServer) networkInterface(id string) *models.NetworkInterface {
+	for _, iface := range s.config.NetworkInterfaces {
+		if *iface.IfaceID == id {
+			return iface
+		}
+	}
+	return nil
+}
+
+func (s *FakeServer) putGuestNetworkInterfaceByID(r *http.Request) (interface{}, error) {
+	var iface models.NetworkInterface
+	if err := decode(r, &iface); err != nil {
+		return nil, err
+	}
+	if id := r.PathValue("iface_id"); *iface.IfaceID != id {
+		return nil, badRequest("The id from the path [%s] does not match the id from the body [%s]!", id, *iface.IfaceID)
+	}
+
+	for i, existing := range s.config.NetworkInterfaces {
+		if *existing.IfaceID == *iface.IfaceID {
+			s.config.NetworkInterfaces[i] = &iface
+			return nil, nil
+		}
+	}
+	s.config.NetworkInterfaces = append(s.config.NetworkInterfaces, &iface)
+	return nil, nil
+}
+
+func (s *FakeServer) patchGuestNetworkInterfaceByID(r *http.Request) (interface{}, error) {
+	var partial models.PartialNetworkInterface
+	if err := decode(r, &partial); err != nil {
+		return nil, err
+	}
+
+	iface := s.networkInterface(r.PathValue("iface_id"))
+	if iface == nil {
+		return nil, badRequest("The network interface %s was not found.", r.PathValue("iface_id"))
+	}
+	if partial.RxRateLimiter != nil {
+		iface.RxRateLimiter = partial.RxRateLimiter
+	}
+	if partial.TxRateLimiter != nil {
+		iface.TxRateLimiter = partial.TxRateLimiter
+	}
+	return nil, nil
+}
+
+func (s *FakeServer) createSnapshot(r *http.Request) (interface{}, error) {
+	var params models.SnapshotCreateParams
+	if err := decode(r, &params); err != nil {
+		return nil, err
+	}
+	if s.state != models.InstanceInfoStatePaused {
+		return nil, badRequest("Operation not allowed: the microVM is running, it must be paused to create a snapshot.")
+	}
+
+	data, err := json.Marshal(fakeSnapshot{Version: s.Version, Config: s.config, Mmds: s.mmds})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(s.path(*params.SnapshotPath), data, 0600); err != nil {
+		return nil, badRequest("Cannot write the snapshot: %v", err)
+	}
+	if err := os.WriteFile(s.path(*params.MemFilePath), nil, 0600); err != nil {
+		return nil, badRequest("Cannot write the memory file: %v", err)
+	}
+	return nil, nil
+}
+
+func (s *FakeServer) loadSnapshot(r *http.Request) (interface{}, error) {
+	var params models.SnapshotLoadParams
+	if err := decode(r, &params); err != nil {
+		return nil, err
+	}
+	if s.config.BootSource != nil || len(s.config.Drives) > 0 || len(s.config.NetworkInterfaces) > 0 {
+		return nil, badRequest("Loading a microVM snapshot not allowed after configuring boot-specific resources.")
+	}
+
+	data, err := os.ReadFile(s.path(*params.SnapshotPath))
+	if err != nil {
+		return nil, badRequest("Cannot read the snapshot: %v", err)
+	}
+	var snapshot fakeSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, badRequest("Cannot parse the snapshot: %v", err)
+	}
+
+	memFilePath := params.MemFilePath
+	if params.MemBackend != nil && swag.StringValue(params.MemBackend.BackendType) == models.MemoryBackendBackendTypeFile {
+		memFilePath = swag.StringValue(params.MemBackend.BackendPath)
+	}
+	if memFilePath != "" {
+		if _, err := os.Stat(s.path(memFilePath)); err != nil {
+			return nil, badRequest("Cannot open the memory file: %v", err)
+		}
+	}
+
+	logger, metrics := s.config.Logger, s.config.Metrics
+	s.config = snapshot.Config
+	s.config.Logger, s.config.Metrics = logger, metrics
+	s.mmds = snapshot.Mmds
+
+	s.state = models.InstanceInfoStatePaused
+	if params.ResumeVM {
+		s.state = models.InstanceInfoStateRunning
+	}
+	return nil, nil
+}
+
+func (s *FakeServer) getFirecrackerVersion(r *http.Request) (interface{}, error) {
+	return &models.FirecrackerVersion{FirecrackerVersion: swag.String(s.Version)}, nil
+}
+
+func (s *FakeServer) patchVM(r *http.Request) (interface{}, error) {
+	var vm models.VM
+	if err := decode(r, &vm); err != nil {
+		return nil, err
+	}
+
+	switch *vm.State {
+	case models.VMStatePaused:
+		s.state = models.InstanceInfoStatePaused
+	case models.VMStateResumed:
+		s.state = models.InstanceInfoStateRunning
+	}
+	return nil, nil
+}
+
+func (s *FakeServer) getExportVMConfig(r *http.Request) (interface{}, error) {
+	return &s.config, nil
+}
+
+func (s *FakeServer) putGuestVsock(r *http.Request) (interface{}, error) {
+	var vsock models.Vsock
+	if err := decode(r, &vsock); err != nil {
+		return nil, err
+	}
+	s.config.Vsock = &vsock
+	return nil, nil
+}
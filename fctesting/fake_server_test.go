@@ -0,0 +1,174 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+package fctesting
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+)
+
+func startFakeServer(t *testing.T) (*FakeServer, func(method, path, body string) (int, string)) {
+	t.Helper()
+
+	s := NewFakeServer(filepath.Join(t.TempDir(), "fc.sock"))
+	if err := s.Start(); err != nil {
+		t.Fatalf("failed to start the fake server: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", s.SocketPath)
+			},
+		},
+	}
+	do := func(method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, "http://localhost"+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("failed to send request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var fault models.Error
+		json.NewDecoder(resp.Body).Decode(&fault)
+		return resp.StatusCode, fault.FaultMessage
+	}
+	return s, do
+}
+
+func TestFakeServerStateRules(t *testing.T) {
+	s, do := startFakeServer(t)
+
+	steps := []struct {
+		method, path, body string
+		status             int
+		state              string
+	}{
+		{"PUT", "/actions", `{"action_type":"InstanceStart"}`, http.StatusBadRequest, models.InstanceInfoStateNotStarted},
+		{"PATCH", "/vm", `{"state":"Paused"}`, http.StatusBadRequest, models.InstanceInfoStateNotStarted},
+		{"PUT", "/boot-source", `{"kernel_image_path":"/vmlinux"}`, http.StatusNoContent, models.InstanceInfoStateNotStarted},
+		{"PUT", "/drives/rootfs", `{"drive_id":"other","path_on_host":"/rootfs","is_root_device":true,"is_read_only":false}`, http.StatusBadRequest, models.InstanceInfoStateNotStarted},
+		{"PUT", "/drives/rootfs", `{"drive_id":"rootfs","path_on_host":"/rootfs","is_root_device":true,"is_read_only":false}`, http.StatusNoContent, models.InstanceInfoStateNotStarted},
+		{"PUT", "/drives/rootfs", `{"drive_id":"rootfs"}`, http.StatusBadRequest, models.InstanceInfoStateNotStarted},
+		{"PUT", "/actions", `{"action_type":"InstanceStart"}`, http.StatusNoContent, models.InstanceInfoStateRunning},
+		{"PUT", "/drives/data", `{"drive_id":"data","path_on_host":"/data","is_root_device":false,"is_read_only":false}`, http.StatusBadRequest, models.InstanceInfoStateRunning},
+		{"PATCH", "/drives/rootfs", `{"drive_id":"rootfs","path_on_host":"/rootfs2"}`, http.StatusNoContent, models.InstanceInfoStateRunning},
+		{"PUT", "/snapshot/create", `{"snapshot_path":"snap","mem_file_path":"mem"}`, http.StatusBadRequest, models.InstanceInfoStateRunning},
+		{"PATCH", "/vm", `{"state":"Paused"}`, http.StatusNoContent, models.InstanceInfoStatePaused},
+		{"PATCH", "/vm", `{"state":"Resumed"}`, http.StatusNoContent, models.InstanceInfoStateRunning},
+	}
+
+	for i, step := range steps {
+		status, msg := do(step.method, step.path, step.body)
+		if e, a := step.status, status; e != a {
+			t.Errorf("step %d: expected status %d, but received %d: %s", i, e, a, msg)
+		}
+		if e, a := step.state, s.State(); e != a {
+			t.Errorf("step %d: expected state %q, but received %q", i, e, a)
+		}
+	}
+
+	if e, a := "/rootfs2", *s.Config().Drives[0].PathOnHost; e != a {
+		t.Errorf("expected %q, but received %q", e, a)
+	}
+	if e, a := len(steps), len(s.Calls()); e != a {
+		t.Errorf("expected %d calls, but received %d", e, a)
+	}
+
+	select {
+	case <-s.ShutdownRequested():
+		t.Errorf("expected no shutdown request")
+	default:
+	}
+	do("PUT", "/actions", `{"action_type":"SendCtrlAltDel"}`)
+	select {
+	case <-s.ShutdownRequested():
+	case <-time.After(time.Second):
+		t.Errorf("expected a shutdown request")
+	}
+}
+
+func TestFakeServerSnapshot(t *testing.T) {
+	s, do := startFakeServer(t)
+	dir := t.TempDir()
+	snapshot := `{"snapshot_path":"` + filepath.Join(dir, "snap") + `","mem_file_path":"` + filepath.Join(dir, "mem") + `"}`
+
+	do("PUT", "/boot-source", `{"kernel_image_path":"/vmlinux"}`)
+	do("PUT", "/mmds", `{"foo":"bar"}`)
+	do("PUT", "/actions", `{"action_type":"InstanceStart"}`)
+	do("PATCH", "/vm", `{"state":"Paused"}`)
+	if status, msg := do("PUT", "/snapshot/create", snapshot); status != http.StatusNoContent {
+		t.Fatalf("expected the snapshot to be created, but received %d: %s", status, msg)
+	}
+	if e, a := models.InstanceInfoStatePaused, s.State(); e != a {
+		t.Errorf("expected state %q, but received %q", e, a)
+	}
+
+	restored, do := startFakeServer(t)
+	loadSnapshot := strings.TrimSuffix(snapshot, "}") + `,"resume_vm":true}`
+	if status, msg := do("PUT", "/snapshot/load", loadSnapshot); status != http.StatusNoContent {
+		t.Fatalf("expected the snapshot to be loaded, but received %d: %s", status, msg)
+	}
+	if e, a := models.InstanceInfoStateRunning, restored.State(); e != a {
+		t.Errorf("expected state %q, but received %q", e, a)
+	}
+	if e, a := "/vmlinux", *restored.Config().BootSource.KernelImagePath; e != a {
+		t.Errorf("expected %q, but received %q", e, a)
+	}
+	if status, _ := do("PUT", "/snapshot/load", loadSnapshot); status != http.StatusBadRequest {
+		t.Errorf("expected a snapshot to be loaded only once, but received %d", status)
+	}
+}
+
+func TestFakeServerFaults(t *testing.T) {
+	s, do := startFakeServer(t)
+
+	s.InjectFault("PutGuestBootSource", Fault{StatusCode: http.StatusInternalServerError, FaultMessage: "injected", Count: 2})
+	for i := 0; i < 2; i++ {
+		if status, msg := do("PUT", "/boot-source", `{"kernel_image_path":"/vmlinux"}`); status != http.StatusInternalServerError || msg != "injected" {
+			t.Errorf("expected the injected fault, but received %d: %s", status, msg)
+		}
+	}
+	if status, msg := do("PUT", "/boot-source", `{"kernel_image_path":"/vmlinux"}`); status != http.StatusNoContent {
+		t.Errorf("expected the fault to be exhausted, but received %d: %s", status, msg)
+	}
+
+	s.InjectFault("GetMachineConfiguration", Fault{Delay: 50 * time.Millisecond})
+	start := time.Now()
+	if status, _ := do("GET", "/machine-config", ""); status != http.StatusOK {
+		t.Errorf("expected the delayed request to succeed, but received %d", status)
+	}
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("expected the request to be delayed, but it took %v", d)
+	}
+
+	s.ClearFaults()
+	start = time.Now()
+	do("GET", "/machine-config", "")
+	if d := time.Since(start); d >= 50*time.Millisecond {
+		t.Errorf("expected the faults to be cleared, but the request took %v", d)
+	}
+}
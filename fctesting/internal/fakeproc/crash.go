@@ -0,0 +1,41 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package fakeproc holds what the fake firecracker and jailer binaries have
+// in common.
+package fakeproc
+
+import (
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Crash terminates the process with sig, as if it did not handle it.
+//
+// The Go runtime handles all signals, and exits with code 2 on some of them,
+// such as SIGSYS or SIGQUIT, instead of being killed by them. The default
+// action of sig is restored before raising it to avoid this.
+func Crash(sig syscall.Signal) {
+	// a zeroed struct sigaction is SIG_DFL, with no flags and no mask
+	var action [4]uint64
+	unix.RawSyscall6(unix.SYS_RT_SIGACTION, uintptr(sig), uintptr(unsafe.Pointer(&action)), 0, 8, 0, 0)
+	unix.Kill(os.Getpid(), sig)
+
+	// the default action of sig may be to ignore it
+	time.Sleep(time.Second)
+	os.Exit(128 + int(sig))
+}
@@ -0,0 +1,208 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fctesting
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+
+	"github.com/go-openapi/runtime"
+	"github.com/go-openapi/strfmt"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+)
+
+// apiRecord is a line of a recording written by firecracker.WithAPIRecorder.
+type apiRecord struct {
+	Operation    string          `json:"operation"`
+	Attempt      int             `json:"attempt"`
+	Body         json.RawMessage `json:"body,omitempty"`
+	StatusCode   int             `json:"status_code,omitempty"`
+	Response     json.RawMessage `json:"response,omitempty"`
+	FaultMessage string          `json:"fault_message,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	Unavailable  bool            `json:"unavailable,omitempty"`
+}
+
+// ReplayClient is an ops.ClientIface replaying the API traffic recorded by
+// firecracker.WithAPIRecorder, for instance during a real boot, so that it
+// can be used with firecracker.WithOpsClient in unit tests.
+//
+// Every request must match a recorded request, with the same operation and
+// an equal body, which was not replayed yet. It then gets the recorded
+// response or error. Requests may be replayed in a different order than they
+// were recorded in, since handlers run concurrently, but identical requests
+// are replayed in order. A request which does not match fails the test.
+type ReplayClient struct {
+	ops.ClientIface
+
+	t        testing.TB
+	mu       sync.Mutex
+	records  []apiRecord
+	replayed []bool
+}
+
+// NewReplayClient returns a ReplayClient replaying the recording at path.
+func NewReplayClient(t testing.TB, path string) *ReplayClient {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open the recording: %v", err)
+	}
+	defer f.Close()
+
+	c := &ReplayClient{t: t}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var record apiRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("invalid record on line %d of %s: %v", line, path, err)
+		}
+		c.records = append(c.records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("failed to read the recording: %v", err)
+	}
+
+	c.replayed = make([]bool, len(c.records))
+	c.ClientIface = ops.New(c, strfmt.Default)
+	return c
+}
+
+// Remaining returns the number of recorded requests which were not replayed.
+func (c *ReplayClient) Remaining() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for _, replayed := range c.replayed {
+		if !replayed {
+			n++
+		}
+	}
+	return n
+}
+
+// Submit implements runtime.ClientTransport for the generated client.
+func (c *ReplayClient) Submit(op *runtime.ClientOperation) (interface{}, error) {
+	req := &runtime.TestClientRequest{}
+	if err := op.Params.WriteToRequest(req, strfmt.Default); err != nil {
+		return nil, err
+	}
+	// the IDs of the operations are not always capitalized like the methods
+	// of the client, unlike the names of their readers
+	operation := strings.TrimSuffix(reflect.TypeOf(op.Reader).Elem().Name(), "Reader")
+
+	record, err := c.match(operation, req.GetBodyParam())
+	if err != nil {
+		c.t.Errorf("unexpected request: %v", err)
+		return nil, err
+	}
+
+	if record.StatusCode == 0 {
+		if record.Unavailable {
+			return nil, fmt.Errorf("%s: %w", record.Error, syscall.ECONNREFUSED)
+		}
+		return nil, errors.New(record.Error)
+	}
+
+	body := []byte(record.Response)
+	if record.StatusCode/100 != 2 {
+		body, _ = json.Marshal(&models.Error{FaultMessage: record.FaultMessage})
+	}
+	return op.Reader.ReadResponse(&replayResponse{code: record.StatusCode, body: body}, runtime.JSONConsumer())
+}
+
+// match finds the first recorded request equal to the given one which was
+// not replayed yet, and marks it as replayed.
+func (c *ReplayClient) match(operation string, body interface{}) (apiRecord, error) {
+	var actual interface{}
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return apiRecord{}, err
+		}
+		if err := json.Unmarshal(data, &actual); err != nil {
+			return apiRecord{}, err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var candidate *apiRecord
+	for i, record := range c.records {
+		if c.replayed[i] || record.Operation != operation {
+			continue
+		}
+
+		var expected interface{}
+		if len(record.Body) > 0 {
+			if err := json.Unmarshal(record.Body, &expected); err != nil {
+				return apiRecord{}, fmt.Errorf("invalid body of recorded %s: %w", operation, err)
+			}
+		}
+		if reflect.DeepEqual(expected, actual) {
+			c.replayed[i] = true
+			return record, nil
+		}
+		if candidate == nil {
+			candidate = &c.records[i]
+		}
+	}
+
+	if candidate == nil {
+		return apiRecord{}, fmt.Errorf("%s was not recorded, or was already replayed", operation)
+	}
+	data, _ := json.Marshal(actual)
+	return apiRecord{}, fmt.Errorf("%s with body %s does not match the recorded body %s", operation, data, candidate.Body)
+}
+
+// replayResponse is a recorded response, read by the generated client.
+type replayResponse struct {
+	code int
+	body []byte
+}
+
+func (r *replayResponse) Code() int {
+	return r.code
+}
+
+func (r *replayResponse) Message() string {
+	return http.StatusText(r.code)
+}
+
+func (r *replayResponse) GetHeader(string) string {
+	return ""
+}
+
+func (r *replayResponse) GetHeaders(string) []string {
+	return nil
+}
+
+func (r *replayResponse) Body() io.ReadCloser {
+	return io.NopCloser(bytes.NewReader(r.body))
+}
@@ -0,0 +1,99 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package fctesting
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/go-openapi/swag"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+)
+
+// errorRecorder records the errors reported to a test instead of failing it.
+type errorRecorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *errorRecorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+const testRecording = `{"operation":"PutGuestDriveByID","attempt":1,"body":{"drive_id":"root","is_read_only":false,"is_root_device":true,"path_on_host":"/rootfs"},"status_code":204}
+{"operation":"PutGuestDriveByID","attempt":1,"body":{"drive_id":"data","is_read_only":true,"is_root_device":false,"path_on_host":"/data"},"status_code":204}
+{"operation":"GetMachineConfiguration","attempt":1,"status_code":200,"response":{"mem_size_mib":256,"vcpu_count":2}}
+{"operation":"PutGuestBootSource","attempt":1,"body":{"kernel_image_path":"/vmlinux"},"status_code":400,"fault_message":"Invalid kernel path"}
+{"operation":"PatchVM","attempt":1,"body":{"state":"Paused"},"error":"connection refused","unavailable":true}
+`
+
+func TestReplayClient(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recording.jsonl")
+	if err := os.WriteFile(path, []byte(testRecording), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := &errorRecorder{TB: t}
+	c := NewReplayClient(recorder, path)
+
+	// requests may be replayed out of order
+	data := &models.Drive{DriveID: swag.String("data"), PathOnHost: swag.String("/data"), IsReadOnly: swag.Bool(true), IsRootDevice: swag.Bool(false)}
+	if _, err := c.PutGuestDriveByID(ops.NewPutGuestDriveByIDParams().WithDriveID("data").WithBody(data)); err != nil {
+		t.Errorf("expected the recorded drive to be replayed, received %v", err)
+	}
+
+	resp, err := c.GetMachineConfiguration(ops.NewGetMachineConfigurationParams())
+	if err != nil || swag.Int64Value(resp.Payload.VcpuCount) != 2 {
+		t.Errorf("expected the recorded machine configuration, received %+v, %v", resp, err)
+	}
+
+	_, err = c.PutGuestBootSource(ops.NewPutGuestBootSourceParams().WithBody(&models.BootSource{KernelImagePath: swag.String("/vmlinux")}))
+	var badRequest *ops.PutGuestBootSourceBadRequest
+	if !errors.As(err, &badRequest) || badRequest.Payload.FaultMessage != "Invalid kernel path" {
+		t.Errorf("expected the recorded fault, received %v", err)
+	}
+
+	_, err = c.PatchVM(ops.NewPatchVMParams().WithBody(&models.VM{State: swag.String(models.VMStatePaused)}))
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("expected the recorded connection error, received %v", err)
+	}
+
+	if len(recorder.errors) != 0 {
+		t.Errorf("unexpected errors %v", recorder.errors)
+	}
+	if n := c.Remaining(); n != 1 {
+		t.Errorf("expected the root drive not to be replayed, %d requests remain", n)
+	}
+
+	// divergent requests fail
+	root := &models.Drive{DriveID: swag.String("root"), PathOnHost: swag.String("/other"), IsReadOnly: swag.Bool(false), IsRootDevice: swag.Bool(true)}
+	if _, err := c.PutGuestDriveByID(ops.NewPutGuestDriveByIDParams().WithDriveID("root").WithBody(root)); err == nil {
+		t.Errorf("expected a divergent body to fail")
+	}
+	if _, err := c.GetMachineConfiguration(ops.NewGetMachineConfigurationParams()); err == nil {
+		t.Errorf("expected a request replayed twice to fail")
+	}
+	if _, err := c.GetMmds(ops.NewGetMmdsParams()); err == nil {
+		t.Errorf("expected a request which was not recorded to fail")
+	}
+	if len(recorder.errors) != 3 {
+		t.Errorf("expected the divergent requests to fail the test, received %v", recorder.errors)
+	}
+}
@@ -15,6 +15,8 @@ package firecracker
 
 import (
 	"context"
+	"errors"
+	"reflect"
 	"time"
 
 	"github.com/go-openapi/strfmt"
@@ -59,6 +61,8 @@ type Client struct {
 	client                    *client.Firecracker
 	firecrackerRequestTimeout int
 	firecrackerInitTimeout    int
+	retryPolicy               *RetryPolicy
+	interceptors              []Interceptor
 }
 
 // NewClient creates a Client
@@ -75,6 +79,121 @@ func NewClient(socketPath string, logger *logrus.Entry, debug bool, opts ...Clie
 	return c
 }
 
+// requestTimeout returns the timeout of a single API request.
+func (f *Client) requestTimeout() time.Duration {
+	return time.Duration(f.firecrackerRequestTimeout) * time.Millisecond
+}
+
+// requestParams is implemented by the parameters of every API operation.
+type requestParams interface {
+	SetContext(ctx context.Context)
+}
+
+// paramsContext returns the context set on params by the options of the
+// caller, if any.
+func paramsContext(params requestParams) context.Context {
+	v := reflect.ValueOf(params)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	field := v.Elem().FieldByName("Context")
+	if !field.IsValid() || field.IsNil() {
+		return nil
+	}
+	ctx, _ := field.Interface().(context.Context)
+	return ctx
+}
+
+// call sends a request through fn, which must use params, and the
+// interceptors of the client. Each attempt is bounded by timeout, unless it is
+// 0 or the retry policy overrides it, and failed attempts are retried as the
+// retry policy allows. The error of the last attempt is returned as an
+// APIError.
+func (f *Client) call(ctx context.Context, operation string, body interface{}, params requestParams, timeout time.Duration, fn func() (interface{}, error)) (interface{}, error) {
+	policy := f.retryPolicy
+	if t, ok := policy.timeout(operation); ok {
+		timeout = t
+	}
+
+	// a context set by the options of the caller also bounds the request,
+	// since every attempt replaces the context of params
+	if paramsCtx := paramsContext(params); paramsCtx != nil && paramsCtx != ctx {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+		if paramsCtx.Err() != nil {
+			cancel(context.Cause(paramsCtx))
+		} else {
+			stop := context.AfterFunc(paramsCtx, func() { cancel(context.Cause(paramsCtx)) })
+			defer stop()
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		call := &APICall{
+			Operation: operation,
+			Request:   body,
+			Attempt:   attempt,
+		}
+		err := f.callAttempt(ctx, call, params, timeout, fn)
+		if err == nil {
+			return call.Response, nil
+		}
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			// returned by an interceptor
+			err = newAPIError(operation, body, err)
+		}
+		if !policy.shouldRetry(ctx, operation, body, attempt, err) {
+			return call.Response, err
+		}
+
+		backoff := policy.backoff(attempt)
+		if policy.OnRetry != nil {
+			policy.OnRetry(RetryAttempt{
+				Operation: operation,
+				Attempt:   attempt,
+				Err:       err,
+				Backoff:   backoff,
+			})
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return call.Response, err
+		}
+	}
+}
+
+func (f *Client) callAttempt(ctx context.Context, call *APICall, params requestParams, timeout time.Duration, fn func() (interface{}, error)) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	invoker := func(ctx context.Context, call *APICall) error {
+		params.SetContext(ctx)
+
+		start := time.Now()
+		resp, err := fn()
+		call.Latency = time.Since(start)
+		if err != nil {
+			return newAPIError(call.Operation, call.Request, err)
+		}
+
+		call.Response = resp
+		return nil
+	}
+
+	ctx, span := startAPISpan(ctx, call, params)
+	err := chainInterceptors(f.interceptors, invoker)(ctx, call)
+	endAPISpan(span, call, err)
+	return err
+}
+
 // GetFirecrackerVersionOpt is a functional option to be used for the
 // GetFirecrackerVersion API in setting any additional optional fields.
 type GetFirecrackerVersionOpt func(*ops.GetFirecrackerVersionParams)
@@ -83,12 +202,15 @@ type GetFirecrackerVersionOpt func(*ops.GetFirecrackerVersionParams)
 // calling of the API easier.
 func (f *Client) GetFirecrackerVersion(ctx context.Context, opts ...GetFirecrackerVersionOpt) (*ops.GetFirecrackerVersionOK, error) {
 	params := ops.NewGetFirecrackerVersionParams()
-	params.SetContext(ctx)
 	for _, opt := range opts {
 		opt(params)
 	}
 
-	return f.client.Operations.GetFirecrackerVersion(params)
+	resp, err := f.call(ctx, "GetFirecrackerVersion", nil, params, 0, func() (interface{}, error) {
+		return f.client.Operations.GetFirecrackerVersion(params)
+	})
+	result, _ := resp.(*ops.GetFirecrackerVersionOK)
+	return result, err
 }
 
 // PutLoggerOpt is a functional option to be used for the PutLogger API in
@@ -98,16 +220,17 @@ type PutLoggerOpt func(*ops.PutLoggerParams)
 // PutLogger is a wrapper for the swagger generated client to make calling of
 // the API easier.
 func (f *Client) PutLogger(ctx context.Context, logger *models.Logger, opts ...PutLoggerOpt) (*ops.PutLoggerNoContent, error) {
-	timeout, cancel := context.WithTimeout(ctx, time.Duration(f.firecrackerRequestTimeout)*time.Millisecond)
-	defer cancel()
-
-	loggerParams := ops.NewPutLoggerParamsWithContext(timeout)
+	loggerParams := ops.NewPutLoggerParams()
 	loggerParams.SetBody(logger)
 	for _, opt := range opts {
 		opt(loggerParams)
 	}
 
-	return f.client.Operations.PutLogger(loggerParams)
+	resp, err := f.call(ctx, "PutLogger", loggerParams.Body, loggerParams, f.requestTimeout(), func() (interface{}, error) {
+		return f.client.Operations.PutLogger(loggerParams)
+	})
+	result, _ := resp.(*ops.PutLoggerNoContent)
+	return result, err
 }
 
 // PutMetricsOpt is a functional option to be used for the PutMetrics API in
@@ -117,16 +240,17 @@ type PutMetricsOpt func(*ops.PutMetricsParams)
 // PutMetrics is a wrapper for the swagger generated client to make calling of
 // the API easier.
 func (f *Client) PutMetrics(ctx context.Context, metrics *models.Metrics, opts ...PutMetricsOpt) (*ops.PutMetricsNoContent, error) {
-	timeout, cancel := context.WithTimeout(ctx, time.Duration(f.firecrackerRequestTimeout)*time.Millisecond)
-	defer cancel()
-
-	params := ops.NewPutMetricsParamsWithContext(timeout)
+	params := ops.NewPutMetricsParams()
 	params.SetBody(metrics)
 	for _, opt := range opts {
 		opt(params)
 	}
 
-	return f.client.Operations.PutMetrics(params)
+	resp, err := f.call(ctx, "PutMetrics", params.Body, params, f.requestTimeout(), func() (interface{}, error) {
+		return f.client.Operations.PutMetrics(params)
+	})
+	result, _ := resp.(*ops.PutMetricsNoContent)
+	return result, err
 }
 
 // PutMachineConfigurationOpt is a functional option to be used for the
@@ -136,16 +260,17 @@ type PutMachineConfigurationOpt func(*ops.PutMachineConfigurationParams)
 // PutMachineConfiguration is a wrapper for the swagger generated client to
 // make calling of the API easier.
 func (f *Client) PutMachineConfiguration(ctx context.Context, cfg *models.MachineConfiguration, opts ...PutMachineConfigurationOpt) (*ops.PutMachineConfigurationNoContent, error) {
-	timeout, cancel := context.WithTimeout(ctx, time.Duration(f.firecrackerRequestTimeout)*time.Millisecond)
-	defer cancel()
-
-	mc := ops.NewPutMachineConfigurationParamsWithContext(timeout)
+	mc := ops.NewPutMachineConfigurationParams()
 	mc.SetBody(cfg)
 	for _, opt := range opts {
 		opt(mc)
 	}
 
-	return f.client.Operations.PutMachineConfiguration(mc)
+	resp, err := f.call(ctx, "PutMachineConfiguration", mc.Body, mc, f.requestTimeout(), func() (interface{}, error) {
+		return f.client.Operations.PutMachineConfiguration(mc)
+	})
+	result, _ := resp.(*ops.PutMachineConfigurationNoContent)
+	return result, err
 }
 
 // PutGuestBootSourceOpt is a functional option to be used for the
@@ -155,16 +280,17 @@ type PutGuestBootSourceOpt func(*ops.PutGuestBootSourceParams)
 // PutGuestBootSource is a wrapper for the swagger generated client to make
 // calling of the API easier.
 func (f *Client) PutGuestBootSource(ctx context.Context, source *models.BootSource, opts ...PutGuestBootSourceOpt) (*ops.PutGuestBootSourceNoContent, error) {
-	timeout, cancel := context.WithTimeout(ctx, time.Duration(f.firecrackerRequestTimeout)*time.Millisecond)
-	defer cancel()
-
-	bootSource := ops.NewPutGuestBootSourceParamsWithContext(timeout)
+	bootSource := ops.NewPutGuestBootSourceParams()
 	bootSource.SetBody(source)
 	for _, opt := range opts {
 		opt(bootSource)
 	}
 
-	return f.client.Operations.PutGuestBootSource(bootSource)
+	resp, err := f.call(ctx, "PutGuestBootSource", bootSource.Body, bootSource, f.requestTimeout(), func() (interface{}, error) {
+		return f.client.Operations.PutGuestBootSource(bootSource)
+	})
+	result, _ := resp.(*ops.PutGuestBootSourceNoContent)
+	return result, err
 }
 
 // PutGuestNetworkInterfaceByIDOpt is a functional option to be used for the
@@ -174,17 +300,18 @@ type PutGuestNetworkInterfaceByIDOpt func(*ops.PutGuestNetworkInterfaceByIDParam
 // PutGuestNetworkInterfaceByID is a wrapper for the swagger generated client
 // to make calling of the API easier.
 func (f *Client) PutGuestNetworkInterfaceByID(ctx context.Context, ifaceID string, ifaceCfg *models.NetworkInterface, opts ...PutGuestNetworkInterfaceByIDOpt) (*ops.PutGuestNetworkInterfaceByIDNoContent, error) {
-	timeout, cancel := context.WithTimeout(ctx, time.Duration(f.firecrackerRequestTimeout)*time.Millisecond)
-	defer cancel()
-
-	cfg := ops.NewPutGuestNetworkInterfaceByIDParamsWithContext(timeout)
+	cfg := ops.NewPutGuestNetworkInterfaceByIDParams()
 	cfg.SetBody(ifaceCfg)
 	cfg.SetIfaceID(ifaceID)
 	for _, opt := range opts {
 		opt(cfg)
 	}
 
-	return f.client.Operations.PutGuestNetworkInterfaceByID(cfg)
+	resp, err := f.call(ctx, "PutGuestNetworkInterfaceByID", cfg.Body, cfg, f.requestTimeout(), func() (interface{}, error) {
+		return f.client.Operations.PutGuestNetworkInterfaceByID(cfg)
+	})
+	result, _ := resp.(*ops.PutGuestNetworkInterfaceByIDNoContent)
+	return result, err
 }
 
 // PatchGuestNetworkInterfaceByIDOpt is a functional option to be used for the
@@ -194,10 +321,7 @@ type PatchGuestNetworkInterfaceByIDOpt func(*ops.PatchGuestNetworkInterfaceByIDP
 // PatchGuestNetworkInterfaceByID is a wrapper for the swagger generated client to make calling of the
 // API easier.
 func (f *Client) PatchGuestNetworkInterfaceByID(ctx context.Context, ifaceID string, ifaceCfg *models.PartialNetworkInterface, opts ...PatchGuestNetworkInterfaceByIDOpt) (*ops.PatchGuestNetworkInterfaceByIDNoContent, error) {
-	timeout, cancel := context.WithTimeout(ctx, time.Duration(f.firecrackerRequestTimeout)*time.Millisecond)
-	defer cancel()
-
-	cfg := ops.NewPatchGuestNetworkInterfaceByIDParamsWithContext(timeout)
+	cfg := ops.NewPatchGuestNetworkInterfaceByIDParams()
 	cfg.SetBody(ifaceCfg)
 	cfg.SetIfaceID(ifaceID)
 
@@ -205,7 +329,11 @@ func (f *Client) PatchGuestNetworkInterfaceByID(ctx context.Context, ifaceID str
 		opt(cfg)
 	}
 
-	return f.client.Operations.PatchGuestNetworkInterfaceByID(cfg)
+	resp, err := f.call(ctx, "PatchGuestNetworkInterfaceByID", cfg.Body, cfg, f.requestTimeout(), func() (interface{}, error) {
+		return f.client.Operations.PatchGuestNetworkInterfaceByID(cfg)
+	})
+	result, _ := resp.(*ops.PatchGuestNetworkInterfaceByIDNoContent)
+	return result, err
 }
 
 // PutGuestDriveByIDOpt is a functional option to be used for the
@@ -215,17 +343,18 @@ type PutGuestDriveByIDOpt func(*ops.PutGuestDriveByIDParams)
 // PutGuestDriveByID is a wrapper for the swagger generated client to make
 // calling of the API easier.
 func (f *Client) PutGuestDriveByID(ctx context.Context, driveID string, drive *models.Drive, opts ...PutGuestDriveByIDOpt) (*ops.PutGuestDriveByIDNoContent, error) {
-	timeout, cancel := context.WithTimeout(ctx, time.Duration(f.firecrackerRequestTimeout)/2*time.Millisecond)
-	defer cancel()
-
-	params := ops.NewPutGuestDriveByIDParamsWithContext(timeout)
+	params := ops.NewPutGuestDriveByIDParams()
 	params.SetDriveID(driveID)
 	params.SetBody(drive)
 	for _, opt := range opts {
 		opt(params)
 	}
 
-	return f.client.Operations.PutGuestDriveByID(params)
+	resp, err := f.call(ctx, "PutGuestDriveByID", params.Body, params, f.requestTimeout()/2, func() (interface{}, error) {
+		return f.client.Operations.PutGuestDriveByID(params)
+	})
+	result, _ := resp.(*ops.PutGuestDriveByIDNoContent)
+	return result, err
 }
 
 // PutGuestVsockOpt is a functional option to be used for the
@@ -236,13 +365,16 @@ type PutGuestVsockOpt func(params *ops.PutGuestVsockParams)
 // calling of the API easier.
 func (f *Client) PutGuestVsock(ctx context.Context, vsock *models.Vsock, opts ...PutGuestVsockOpt) (*ops.PutGuestVsockNoContent, error) {
 	params := ops.NewPutGuestVsockParams()
-	params.SetContext(ctx)
 	params.SetBody(vsock)
 	for _, opt := range opts {
 		opt(params)
 	}
 
-	return f.client.Operations.PutGuestVsock(params)
+	resp, err := f.call(ctx, "PutGuestVsock", params.Body, params, 0, func() (interface{}, error) {
+		return f.client.Operations.PutGuestVsock(params)
+	})
+	result, _ := resp.(*ops.PutGuestVsockNoContent)
+	return result, err
 }
 
 // PatchVMOpt is a functional option to be used for the
@@ -252,16 +384,17 @@ type PatchVMOpt func(*ops.PatchVMParams)
 // PatchVM is a wrapper for the swagger generated client to make
 // calling of the API easier.
 func (f *Client) PatchVM(ctx context.Context, vm *models.VM, opts ...PatchVMOpt) (*ops.PatchVMNoContent, error) {
-	timeout, cancel := context.WithTimeout(ctx, time.Duration(f.firecrackerRequestTimeout)*time.Millisecond)
-	defer cancel()
-
-	params := ops.NewPatchVMParamsWithContext(timeout)
+	params := ops.NewPatchVMParams()
 	params.SetBody(vm)
 	for _, opt := range opts {
 		opt(params)
 	}
 
-	return f.client.Operations.PatchVM(params)
+	resp, err := f.call(ctx, "PatchVM", params.Body, params, f.requestTimeout(), func() (interface{}, error) {
+		return f.client.Operations.PatchVM(params)
+	})
+	result, _ := resp.(*ops.PatchVMNoContent)
+	return result, err
 }
 
 // CreateSnapshotOpt is a functional option to be used for the
@@ -271,14 +404,18 @@ type CreateSnapshotOpt func(*ops.CreateSnapshotParams)
 // CreateSnapshot is a wrapper for the swagger generated client to make
 // calling of the API easier.
 func (f *Client) CreateSnapshot(ctx context.Context, snapshotParams *models.SnapshotCreateParams, opts ...CreateSnapshotOpt) (*ops.CreateSnapshotNoContent, error) {
-	params := ops.NewCreateSnapshotParamsWithContext(ctx)
+	params := ops.NewCreateSnapshotParams()
 	params.SetBody(snapshotParams)
 
 	for _, opt := range opts {
 		opt(params)
 	}
 
-	return f.client.Operations.CreateSnapshot(params)
+	resp, err := f.call(ctx, "CreateSnapshot", params.Body, params, 0, func() (interface{}, error) {
+		return f.client.Operations.CreateSnapshot(params)
+	})
+	result, _ := resp.(*ops.CreateSnapshotNoContent)
+	return result, err
 }
 
 // LoadSnapshotOpt is a functional option to be used for the
@@ -288,14 +425,18 @@ type LoadSnapshotOpt func(*ops.LoadSnapshotParams)
 // LoadSnapshot is a wrapper for the swagger generated client to make
 // calling of the API easier.
 func (f *Client) LoadSnapshot(ctx context.Context, snapshotParams *models.SnapshotLoadParams, opts ...LoadSnapshotOpt) (*ops.LoadSnapshotNoContent, error) {
-	params := ops.NewLoadSnapshotParamsWithContext(ctx)
+	params := ops.NewLoadSnapshotParams()
 	params.SetBody(snapshotParams)
 
 	for _, opt := range opts {
 		opt(params)
 	}
 
-	return f.client.Operations.LoadSnapshot(params)
+	resp, err := f.call(ctx, "LoadSnapshot", params.Body, params, 0, func() (interface{}, error) {
+		return f.client.Operations.LoadSnapshot(params)
+	})
+	result, _ := resp.(*ops.LoadSnapshotNoContent)
+	return result, err
 }
 
 // CreateSyncActionOpt is a functional option to be used for the
@@ -306,13 +447,16 @@ type CreateSyncActionOpt func(*ops.CreateSyncActionParams)
 // calling of the API easier.
 func (f *Client) CreateSyncAction(ctx context.Context, info *models.InstanceActionInfo, opts ...CreateSyncActionOpt) (*ops.CreateSyncActionNoContent, error) {
 	params := ops.NewCreateSyncActionParams()
-	params.SetContext(ctx)
 	params.SetInfo(info)
 	for _, opt := range opts {
 		opt(params)
 	}
 
-	return f.client.Operations.CreateSyncAction(params)
+	resp, err := f.call(ctx, "CreateSyncAction", params.Info, params, 0, func() (interface{}, error) {
+		return f.client.Operations.CreateSyncAction(params)
+	})
+	result, _ := resp.(*ops.CreateSyncActionNoContent)
+	return result, err
 }
 
 // PutMmdsOpt is a functional option to be used for the PutMmds API in setting
@@ -323,13 +467,16 @@ type PutMmdsOpt func(*ops.PutMmdsParams)
 // API easier.
 func (f *Client) PutMmds(ctx context.Context, metadata interface{}, opts ...PutMmdsOpt) (*ops.PutMmdsNoContent, error) {
 	params := ops.NewPutMmdsParams()
-	params.SetContext(ctx)
 	params.SetBody(metadata)
 	for _, opt := range opts {
 		opt(params)
 	}
 
-	return f.client.Operations.PutMmds(params)
+	resp, err := f.call(ctx, "PutMmds", params.Body, params, 0, func() (interface{}, error) {
+		return f.client.Operations.PutMmds(params)
+	})
+	result, _ := resp.(*ops.PutMmdsNoContent)
+	return result, err
 }
 
 // GetMmdsOpt is a functional option to be used for the GetMmds API in setting
@@ -340,12 +487,15 @@ type GetMmdsOpt func(*ops.GetMmdsParams)
 // API easier.
 func (f *Client) GetMmds(ctx context.Context, opts ...GetMmdsOpt) (*ops.GetMmdsOK, error) {
 	params := ops.NewGetMmdsParams()
-	params.SetContext(ctx)
 	for _, opt := range opts {
 		opt(params)
 	}
 
-	return f.client.Operations.GetMmds(params)
+	resp, err := f.call(ctx, "GetMmds", nil, params, 0, func() (interface{}, error) {
+		return f.client.Operations.GetMmds(params)
+	})
+	result, _ := resp.(*ops.GetMmdsOK)
+	return result, err
 }
 
 // PatchMmdsOpt is a functional option to be used for the GetMmds API in setting
@@ -356,23 +506,29 @@ type PatchMmdsOpt func(*ops.PatchMmdsParams)
 // API easier.
 func (f *Client) PatchMmds(ctx context.Context, metadata interface{}, opts ...PatchMmdsOpt) (*ops.PatchMmdsNoContent, error) {
 	params := ops.NewPatchMmdsParams()
-	params.SetContext(ctx)
 	params.SetBody(metadata)
 	for _, opt := range opts {
 		opt(params)
 	}
 
-	return f.client.Operations.PatchMmds(params)
+	resp, err := f.call(ctx, "PatchMmds", params.Body, params, 0, func() (interface{}, error) {
+		return f.client.Operations.PatchMmds(params)
+	})
+	result, _ := resp.(*ops.PatchMmdsNoContent)
+	return result, err
 }
 
 // PutMmdsConfig is a wrapper for the swagger generated client to make calling of the
 // API easier.
 func (f *Client) PutMmdsConfig(ctx context.Context, config *models.MmdsConfig) (*ops.PutMmdsConfigNoContent, error) {
 	params := ops.NewPutMmdsConfigParams()
-	params.SetContext(ctx)
 	params.SetBody(config)
 
-	return f.client.Operations.PutMmdsConfig(params)
+	resp, err := f.call(ctx, "PutMmdsConfig", params.Body, params, 0, func() (interface{}, error) {
+		return f.client.Operations.PutMmdsConfig(params)
+	})
+	result, _ := resp.(*ops.PutMmdsConfigNoContent)
+	return result, err
 }
 
 // GetMachineConfigurationOpt  is a functional option to be used for the
@@ -383,12 +539,15 @@ type GetMachineConfigurationOpt func(*ops.GetMachineConfigurationParams)
 // calling of the API easier.
 func (f *Client) GetMachineConfiguration(opts ...GetMachineConfigurationOpt) (*ops.GetMachineConfigurationOK, error) {
 	p := ops.NewGetMachineConfigurationParams()
-	p.SetTimeout(time.Duration(f.firecrackerRequestTimeout) * time.Millisecond)
 	for _, opt := range opts {
 		opt(p)
 	}
 
-	return f.client.Operations.GetMachineConfiguration(p)
+	resp, err := f.call(context.Background(), "GetMachineConfiguration", nil, p, f.requestTimeout(), func() (interface{}, error) {
+		return f.client.Operations.GetMachineConfiguration(p)
+	})
+	result, _ := resp.(*ops.GetMachineConfigurationOK)
+	return result, err
 }
 
 // DescribeInstanceOpt is a functional option to be used for the DescribeInstance API
@@ -399,12 +558,15 @@ type DescribeInstanceOpt func(*ops.DescribeInstanceParams)
 // the API easier
 func (f *Client) GetInstanceInfo(ctx context.Context, opts ...DescribeInstanceOpt) (*ops.DescribeInstanceOK, error) {
 	params := ops.NewDescribeInstanceParams()
-	params.SetContext(ctx)
 	for _, opt := range opts {
 		opt(params)
 	}
 
-	return f.client.Operations.DescribeInstance(params)
+	resp, err := f.call(ctx, "DescribeInstance", nil, params, 0, func() (interface{}, error) {
+		return f.client.Operations.DescribeInstance(params)
+	})
+	result, _ := resp.(*ops.DescribeInstanceOK)
+	return result, err
 }
 
 // PatchGuestDriveByIDOpt is a functional option to be used for the PutMmds API in setting
@@ -415,7 +577,6 @@ type PatchGuestDriveByIDOpt func(*ops.PatchGuestDriveByIDParams)
 // API easier.
 func (f *Client) PatchGuestDriveByID(ctx context.Context, driveID, pathOnHost string, opts ...PatchGuestDriveByIDOpt) (*ops.PatchGuestDriveByIDNoContent, error) {
 	params := ops.NewPatchGuestDriveByIDParams()
-	params.SetContext(ctx)
 
 	partialDrive := models.PartialDrive{
 		DriveID:    &driveID,
@@ -428,7 +589,11 @@ func (f *Client) PatchGuestDriveByID(ctx context.Context, driveID, pathOnHost st
 		opt(params)
 	}
 
-	return f.client.Operations.PatchGuestDriveByID(params)
+	resp, err := f.call(ctx, "PatchGuestDriveByID", params.Body, params, 0, func() (interface{}, error) {
+		return f.client.Operations.PatchGuestDriveByID(params)
+	})
+	result, _ := resp.(*ops.PatchGuestDriveByIDNoContent)
+	return result, err
 }
 
 // PutBalloonOpt is a functional option to be used for the
@@ -438,26 +603,29 @@ type PutBalloonOpt func(*ops.PutBalloonParams)
 // PutBalloonOpt is a wrapper for the swagger generated client to make
 // calling of the API easier.
 func (f *Client) PutBalloon(ctx context.Context, balloon *models.Balloon, opts ...PutBalloonOpt) (*ops.PutBalloonNoContent, error) {
-	timeout, cancel := context.WithTimeout(ctx, time.Duration(f.firecrackerRequestTimeout)*time.Millisecond)
-	defer cancel()
-
-	params := ops.NewPutBalloonParamsWithContext(timeout)
+	params := ops.NewPutBalloonParams()
 	params.SetBody(balloon)
 	for _, opt := range opts {
 		opt(params)
 	}
 
-	return f.client.Operations.PutBalloon(params)
+	resp, err := f.call(ctx, "PutBalloon", params.Body, params, f.requestTimeout(), func() (interface{}, error) {
+		return f.client.Operations.PutBalloon(params)
+	})
+	result, _ := resp.(*ops.PutBalloonNoContent)
+	return result, err
 }
 
 // DescribeBalloonConfig is a wrapper for the swagger generated client to make
 // calling of the API easier.
 func (f *Client) DescribeBalloonConfig(ctx context.Context) (*ops.DescribeBalloonConfigOK, error) {
 	params := ops.NewDescribeBalloonConfigParams()
-	params.SetContext(ctx)
-	params.SetTimeout(time.Duration(f.firecrackerRequestTimeout) * time.Millisecond)
 
-	return f.client.Operations.DescribeBalloonConfig(params)
+	resp, err := f.call(ctx, "DescribeBalloonConfig", nil, params, f.requestTimeout(), func() (interface{}, error) {
+		return f.client.Operations.DescribeBalloonConfig(params)
+	})
+	result, _ := resp.(*ops.DescribeBalloonConfigOK)
+	return result, err
 }
 
 // PatchBalloonOpt is a functional option to be used for the PatchBalloon API in setting
@@ -467,26 +635,29 @@ type PatchBalloonOpt func(*ops.PatchBalloonParams)
 // PatchBalloon is a wrapper for the swagger generated client to make calling of the
 // API easier.
 func (f *Client) PatchBalloon(ctx context.Context, ballonUpdate *models.BalloonUpdate, opts ...PatchBalloonOpt) (*ops.PatchBalloonNoContent, error) {
-	timeout, cancel := context.WithTimeout(ctx, time.Duration(f.firecrackerRequestTimeout)*time.Millisecond)
-	defer cancel()
-
-	params := ops.NewPatchBalloonParamsWithContext(timeout)
+	params := ops.NewPatchBalloonParams()
 	params.SetBody(ballonUpdate)
 	for _, opt := range opts {
 		opt(params)
 	}
 
-	return f.client.Operations.PatchBalloon(params)
+	resp, err := f.call(ctx, "PatchBalloon", params.Body, params, f.requestTimeout(), func() (interface{}, error) {
+		return f.client.Operations.PatchBalloon(params)
+	})
+	result, _ := resp.(*ops.PatchBalloonNoContent)
+	return result, err
 }
 
 // DescribeBalloonStats is a wrapper for the swagger generated client to make calling of the
 // API easier.
 func (f *Client) DescribeBalloonStats(ctx context.Context) (*ops.DescribeBalloonStatsOK, error) {
 	params := ops.NewDescribeBalloonStatsParams()
-	params.SetContext(ctx)
-	params.SetTimeout(time.Duration(f.firecrackerRequestTimeout) * time.Millisecond)
 
-	return f.client.Operations.DescribeBalloonStats(params)
+	resp, err := f.call(ctx, "DescribeBalloonStats", nil, params, f.requestTimeout(), func() (interface{}, error) {
+		return f.client.Operations.DescribeBalloonStats(params)
+	})
+	result, _ := resp.(*ops.DescribeBalloonStatsOK)
+	return result, err
 }
 
 // PatchBalloonStatsIntervalOpt is a functional option to be used for the PatchBalloonStatsInterval API in setting
@@ -496,26 +667,30 @@ type PatchBalloonStatsIntervalOpt func(*ops.PatchBalloonStatsIntervalParams)
 // PatchBalloonStatsInterval is a wrapper for the swagger generated client to make calling of the
 // API easier.
 func (f *Client) PatchBalloonStatsInterval(ctx context.Context, balloonStatsUpdate *models.BalloonStatsUpdate, opts ...PatchBalloonStatsIntervalOpt) (*ops.PatchBalloonStatsIntervalNoContent, error) {
-	timeout, cancel := context.WithTimeout(ctx, time.Duration(f.firecrackerRequestTimeout)*time.Millisecond)
-	defer cancel()
-
-	params := ops.NewPatchBalloonStatsIntervalParamsWithContext(timeout)
+	params := ops.NewPatchBalloonStatsIntervalParams()
 	params.SetBody(balloonStatsUpdate)
 	for _, opt := range opts {
 		opt(params)
 	}
 
-	return f.client.Operations.PatchBalloonStatsInterval(params)
+	resp, err := f.call(ctx, "PatchBalloonStatsInterval", params.Body, params, f.requestTimeout(), func() (interface{}, error) {
+		return f.client.Operations.PatchBalloonStatsInterval(params)
+	})
+	result, _ := resp.(*ops.PatchBalloonStatsIntervalNoContent)
+	return result, err
 }
 
 type GetExportVMConfigOpt func(*ops.GetExportVMConfigParams)
 
 func (f *Client) GetExportVMConfig(opts ...GetExportVMConfigOpt) (*ops.GetExportVMConfigOK, error) {
 	p := ops.NewGetExportVMConfigParams()
-	p.SetTimeout(time.Duration(f.firecrackerRequestTimeout) * time.Millisecond)
 	for _, opt := range opts {
 		opt(p)
 	}
 
-	return f.client.Operations.GetExportVMConfig(p)
+	resp, err := f.call(context.Background(), "GetExportVMConfig", nil, p, f.requestTimeout(), func() (interface{}, error) {
+		return f.client.Operations.GetExportVMConfig(p)
+	})
+	result, _ := resp.(*ops.GetExportVMConfigOK)
+	return result, err
 }
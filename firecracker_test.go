@@ -19,6 +19,7 @@ import (
 	"time"
 
 	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
 	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
 	"github.com/stretchr/testify/require"
 )
@@ -100,3 +101,37 @@ func TestGetFirecrackerVersion(t *testing.T) {
 	_, err := client.GetFirecrackerVersion(ctx)
 	require.NoError(t, err, "failed to get firecracker version")
 }
+
+func TestClientOptsContext(t *testing.T) {
+	var received []error
+	client := NewClient("/path/to/socket", nil, false, WithOpsClient(&fctesting.MockClient{
+		GetExportVMConfigFn: func(params *ops.GetExportVMConfigParams) (*ops.GetExportVMConfigOK, error) {
+			received = append(received, params.Context.Err())
+			return &ops.GetExportVMConfigOK{}, nil
+		},
+		PutGuestBootSourceFn: func(params *ops.PutGuestBootSourceParams) (*ops.PutGuestBootSourceNoContent, error) {
+			received = append(received, params.Context.Err())
+			return &ops.PutGuestBootSourceNoContent{}, nil
+		},
+	}))
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// the context set by an option bounds the request
+	_, err := client.GetExportVMConfig(func(params *ops.GetExportVMConfigParams) {
+		params.SetContext(cancelled)
+	})
+	require.NoError(t, err)
+	_, err = client.PutGuestBootSource(context.Background(), &models.BootSource{}, func(params *ops.PutGuestBootSourceParams) {
+		params.SetContext(cancelled)
+	})
+	require.NoError(t, err)
+	_, err = client.GetExportVMConfig()
+	require.NoError(t, err)
+
+	require.Len(t, received, 3)
+	require.Equal(t, context.Canceled, received[0])
+	require.Equal(t, context.Canceled, received[1])
+	require.NoError(t, received[2])
+}
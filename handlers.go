@@ -16,7 +16,11 @@ package firecracker
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
 )
 
 // Handler name constants
@@ -35,14 +39,22 @@ const (
 	SetupNetworkHandlerName            = "fcinit.SetupNetwork"
 	SetupKernelArgsHandlerName         = "fcinit.SetupKernelArgs"
 	CreateBalloonHandlerName           = "fcinit.CreateBalloon"
+	ConfigBalloonHandlerName           = "fcinit.ConfigBalloon"
 	LoadSnapshotHandlerName            = "fcinit.LoadSnapshot"
+	WriteConfigFileHandlerName         = "fcinit.WriteConfigFile"
+	QueryCapabilitiesHandlerName       = "fcinit.QueryCapabilities"
 
 	ValidateCfgHandlerName             = "validate.Cfg"
 	ValidateJailerCfgHandlerName       = "validate.JailerCfg"
 	ValidateNetworkCfgHandlerName      = "validate.NetworkCfg"
 	ValidateLoadSnapshotCfgHandlerName = "validate.LoadSnapshotCfg"
+	DetectCapabilitiesHandlerName      = "validate.DetectCapabilities"
 )
 
+// defaultHandlerConcurrency is the number of handlers which may run
+// concurrently, unless set with WithHandlerConcurrency.
+const defaultHandlerConcurrency = 4
+
 // HandlersAdapter is an interface used to modify a given set of handlers.
 type HandlersAdapter interface {
 	AdaptHandlers(*Handlers) error
@@ -77,43 +89,7 @@ var JailerConfigValidationHandler = Handler{
 			return nil
 		}
 
-		hasRoot := m.Cfg.InitrdPath != ""
-		for _, drive := range m.Cfg.Drives {
-			if BoolValue(drive.IsRootDevice) {
-				hasRoot = true
-				break
-			}
-		}
-
-		if !hasRoot {
-			return fmt.Errorf("A root drive must be present in the drive list")
-		}
-
-		if m.Cfg.JailerCfg.ChrootStrategy == nil {
-			return fmt.Errorf("ChrootStrategy cannot be nil")
-		}
-
-		if len(m.Cfg.JailerCfg.ExecFile) == 0 {
-			return fmt.Errorf("exec file must be specified when using jailer mode")
-		}
-
-		if len(m.Cfg.JailerCfg.ID) == 0 {
-			return fmt.Errorf("id must be specified when using jailer mode")
-		}
-
-		if m.Cfg.JailerCfg.GID == nil {
-			return fmt.Errorf("GID must be specified when using jailer mode")
-		}
-
-		if m.Cfg.JailerCfg.UID == nil {
-			return fmt.Errorf("UID must be specified when using jailer mode")
-		}
-
-		if m.Cfg.JailerCfg.NumaNode == nil {
-			return fmt.Errorf("ID must be specified when using jailer mode")
-		}
-
-		return nil
+		return m.Cfg.ValidateJailer()
 	},
 }
 
@@ -139,14 +115,12 @@ func createFifoOrFile(ctx context.Context, m *Machine, fifo, path string) error
 			return err
 		}
 
-		m.cleanupFuncs = append(m.cleanupFuncs,
-			func() error {
-				if err := os.Remove(fifo); !os.IsNotExist(err) {
-					return err
-				}
-				return nil
-			},
-		)
+		m.RegisterCleanup(func() error {
+			if err := os.Remove(fifo); !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		})
 	} else if len(path) > 0 {
 		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
 		if err != nil {
@@ -170,11 +144,18 @@ var CreateLogFilesHandler = Handler{
 		}
 
 		if m.Cfg.FifoLogWriter != nil {
-			if err := m.captureFifoToFile(ctx, m.logger, m.Cfg.LogFifo, m.Cfg.FifoLogWriter); err != nil {
+			// keep the end of the log around for ExitStatus
+			m.logTail = newLineTail(exitLogTailLines)
+			w := io.MultiWriter(m.Cfg.FifoLogWriter, m.logTail, &m.boot)
+			if err := m.captureFifoToFile(ctx, m.logger, m.Cfg.LogFifo, w); err != nil {
 				m.logger.Warnf("captureFifoToFile() returned %s. Continuing anyway.", err)
 			}
 		}
 
+		if len(m.Cfg.MetricsFifo) > 0 {
+			m.metricsFifoCreated(ctx)
+		}
+
 		m.logger.Debug("Created metrics and logging fifos.")
 
 		return nil
@@ -292,6 +273,19 @@ func NewCreateBalloonHandler(amountMib int64, deflateOnOom bool, StatsPollingInt
 	}
 }
 
+// ConfigBalloonHandler is a named handler that puts the balloon device
+// configured in Config.Balloon, if any, into the firecracker process.
+var ConfigBalloonHandler = Handler{
+	Name: ConfigBalloonHandlerName,
+	Fn: func(ctx context.Context, m *Machine) error {
+		balloon := m.Cfg.Balloon
+		if balloon == nil {
+			return nil
+		}
+		return m.CreateBalloon(ctx, Int64Value(balloon.AmountMib), BoolValue(balloon.DeflateOnOom), balloon.StatsPollingIntervals)
+	},
+}
+
 // LoadSnapshotHandler is a named handler that loads a snapshot
 // from the specified filepath
 var LoadSnapshotHandler = Handler{
@@ -301,6 +295,9 @@ var LoadSnapshotHandler = Handler{
 	},
 }
 
+// The devices are independent from each other once the VMM is up, so that
+// their handlers run concurrently, except for the MMDS which refers to the
+// network interfaces.
 var defaultFcInitHandlerList = HandlerList{}.Append(
 	SetupNetworkHandler,
 	SetupKernelArgsHandler,
@@ -309,12 +306,19 @@ var defaultFcInitHandlerList = HandlerList{}.Append(
 	BootstrapLoggingHandler,
 	CreateMachineHandler,
 	CreateBootSourceHandler,
-	AttachDrivesHandler,
-	CreateNetworkInterfacesHandler,
-	AddVsocksHandler,
-	ConfigMmdsHandler,
+	dependsOn(AttachDrivesHandler, StartVMMHandlerName),
+	dependsOn(CreateNetworkInterfacesHandler, StartVMMHandlerName),
+	dependsOn(AddVsocksHandler, StartVMMHandlerName),
+	dependsOn(ConfigMmdsHandler, CreateNetworkInterfacesHandlerName),
+	dependsOn(ConfigBalloonHandler, StartVMMHandlerName),
 )
 
+// dependsOn returns a copy of the handler depending on the named handlers.
+func dependsOn(handler Handler, names ...string) Handler {
+	handler.DependsOn = names
+	return handler
+}
+
 // When the machine starts, these handlers cannot run
 // if we plan to load a snapshot. As these handlers are
 // included in defaultFcInitHandlerList, we must remove them
@@ -326,6 +330,7 @@ var loadSnapshotRemoveHandlerList = []Handler{
 	AttachDrivesHandler,
 	CreateNetworkInterfacesHandler,
 	ConfigMmdsHandler,
+	ConfigBalloonHandler,
 }
 
 var defaultValidationHandlerList = HandlerList{}.Append(
@@ -342,6 +347,21 @@ var defaultHandlers = Handlers{
 type Handler struct {
 	Name string
 	Fn   func(context.Context, *Machine) error
+
+	// DependsOn lists the names of the handlers which must complete before
+	// this one runs. A handler without DependsOn runs after all the handlers
+	// before it in the list, and before all those after it. A handler with
+	// DependsOn, even if empty, may run concurrently with the handlers around
+	// it which have DependsOn, once the handlers it depends on and the last
+	// handler without DependsOn before it completed.
+	DependsOn []string
+
+	// Undo, if set, reverts what the handler did. When a handler fails, the
+	// Undo functions of the handlers of the same run which completed are
+	// called in the reverse order of their completion. Changes which must be
+	// reverted when the VMM exits as well should be registered with
+	// Machine.RegisterCleanup instead.
+	Undo func(context.Context, *Machine) error
 }
 
 // Handlers is a container that houses categories of handler lists.
@@ -443,13 +463,34 @@ func (l HandlerList) Swappend(handler Handler) HandlerList {
 }
 
 // Remove will return an updated handler with all instances of the specific
-// named handler being removed.
+// named handler being removed. The handlers which depended on it inherit its
+// dependencies.
 func (l HandlerList) Remove(name string) HandlerList {
+	var inherited []string
+	for _, h := range l.list {
+		if h.Name == name {
+			inherited = append(inherited, h.DependsOn...)
+		}
+	}
+
 	newList := HandlerList{}
 	for _, h := range l.list {
-		if h.Name != name {
-			newList.list = append(newList.list, h)
+		if h.Name == name {
+			continue
+		}
+
+		if h.DependsOn != nil {
+			dependsOn := []string{}
+			for _, dep := range h.DependsOn {
+				if dep == name {
+					dependsOn = append(dependsOn, inherited...)
+					continue
+				}
+				dependsOn = append(dependsOn, dep)
+			}
+			h.DependsOn = dependsOn
 		}
+		newList.list = append(newList.list, h)
 	}
 
 	return newList
@@ -461,16 +502,174 @@ func (l HandlerList) Clear() HandlerList {
 	return l
 }
 
-// Run will execute each instruction in the handler list. If an error occurs in
-// any of the handlers, then the list will halt execution and return the error.
+// Run will execute each instruction in the handler list, in order, except for
+// the handlers with DependsOn which run concurrently once their dependencies
+// completed, up to the limit set by WithHandlerConcurrency. If an error occurs
+// in any of the handlers, then the list will halt execution and, once the
+// handlers already running completed, undo the completed handlers and return
+// the error along with the errors of their Undo functions, if any.
 func (l HandlerList) Run(ctx context.Context, m *Machine) error {
-	for _, handler := range l.list {
-		m.logger.Debugf("Running handler %s", handler.Name)
-		if err := handler.Fn(ctx, m); err != nil {
-			m.logger.Warnf("Failed handler %q: %v", handler.Name, err)
-			return err
+	deps, err := l.dependencies()
+	if err != nil {
+		return err
+	}
+
+	concurrency := m.handlerConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultHandlerConcurrency
+	}
+
+	type result struct {
+		index int
+		err   error
+	}
+	results := make(chan result)
+	started := make([]bool, len(l.list))
+	completed := make([]bool, len(l.list))
+	ready := func(i int) bool {
+		for _, dep := range deps[i] {
+			if !completed[dep] {
+				return false
+			}
 		}
+		return true
 	}
 
+	var firstErr error
+	var succeeded []int
+	running := 0
+	for {
+		for i := 0; firstErr == nil && running < concurrency && i < len(l.list); i++ {
+			if started[i] || !ready(i) {
+				continue
+			}
+			started[i] = true
+			running++
+			go func(i int) {
+				results <- result{index: i, err: l.list[i].run(ctx, m)}
+			}(i)
+		}
+
+		if running == 0 {
+			break
+		}
+		res := <-results
+		running--
+		completed[res.index] = true
+		if res.err == nil {
+			succeeded = append(succeeded, res.index)
+		} else if firstErr == nil {
+			firstErr = res.err
+		}
+	}
+
+	if firstErr != nil {
+		return l.rollback(ctx, m, succeeded, firstErr)
+	}
 	return nil
 }
+
+// rollback calls the Undo functions of the given handlers in reverse order,
+// and returns err along with their errors.
+func (l HandlerList) rollback(ctx context.Context, m *Machine, succeeded []int, err error) error {
+	// the handler may have failed because ctx is done, which must not
+	// prevent undoing the others
+	ctx = context.WithoutCancel(ctx)
+
+	var undoErr *multierror.Error
+	for i := len(succeeded) - 1; i >= 0; i-- {
+		h := l.list[succeeded[i]]
+		if h.Undo == nil {
+			continue
+		}
+
+		m.logger.Debugf("Undoing handler %s", h.Name)
+		if err := h.Undo(ctx, m); err != nil {
+			m.logger.Warnf("Failed to undo handler %q: %v", h.Name, err)
+			undoErr = multierror.Append(undoErr, fmt.Errorf("failed to undo handler %q: %w", h.Name, err))
+		}
+	}
+
+	if undoErr == nil {
+		return err
+	}
+	return multierror.Append(err, undoErr.Errors...)
+}
+
+func (h Handler) run(ctx context.Context, m *Machine) error {
+	m.logger.Debugf("Running handler %s", h.Name)
+	handlerCtx, span := m.startSpan(ctx, h.Name)
+	start := time.Now()
+	err := h.Fn(handlerCtx, m)
+	m.boot.addStep(BootStep{HandlerName: h.Name, Start: start, Duration: time.Since(start), Err: err})
+	endSpan(span, err)
+	if err != nil {
+		m.logger.Warnf("Failed handler %q: %v", h.Name, err)
+	}
+	return err
+}
+
+// dependencies returns, for each handler of the list, the indexes of the
+// handlers it waits for. It returns an error if a handler depends on a
+// handler which is not in the list, or if the dependencies have a cycle.
+func (l HandlerList) dependencies() ([][]int, error) {
+	indexes := make(map[string][]int)
+	for i, h := range l.list {
+		indexes[h.Name] = append(indexes[h.Name], i)
+	}
+
+	deps := make([][]int, len(l.list))
+	barrier := -1
+	for i, h := range l.list {
+		if h.DependsOn == nil {
+			for j := 0; j < i; j++ {
+				deps[i] = append(deps[i], j)
+			}
+			barrier = i
+			continue
+		}
+
+		if barrier >= 0 {
+			deps[i] = append(deps[i], barrier)
+		}
+		for _, name := range h.DependsOn {
+			dep, ok := indexes[name]
+			if !ok {
+				return nil, fmt.Errorf("handler %q depends on %q, which is not in the list", h.Name, name)
+			}
+			deps[i] = append(deps[i], dep...)
+		}
+	}
+
+	// depth-first search of a cycle
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(l.list))
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visiting:
+			return fmt.Errorf("handler %q has a dependency cycle", l.list[i].Name)
+		case visited:
+			return nil
+		}
+		state[i] = visiting
+		for _, dep := range deps[i] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		state[i] = visited
+		return nil
+	}
+	for i := range l.list {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return deps, nil
+}
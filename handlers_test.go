@@ -14,12 +14,16 @@ package firecracker
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
 	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
@@ -206,6 +210,240 @@ func TestHandlerListRun(t *testing.T) {
 	}
 }
 
+func TestHandlerListRunDependencies(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	handler := func(name string, fn func() error, dependsOn ...string) Handler {
+		return Handler{
+			Name: name,
+			Fn: func(ctx context.Context, m *Machine) error {
+				record("start " + name)
+				err := fn()
+				record("end " + name)
+				return err
+			},
+			DependsOn: dependsOn,
+		}
+	}
+	noop := func() error { return nil }
+
+	// drives and nics can only complete if they run concurrently
+	drivesStarted, nicsStarted := make(chan struct{}), make(chan struct{})
+	waitFor := func(started chan struct{}, other chan struct{}) func() error {
+		return func() error {
+			close(started)
+			select {
+			case <-other:
+				return nil
+			case <-time.After(5 * time.Second):
+				return fmt.Errorf("handlers did not run concurrently")
+			}
+		}
+	}
+
+	h := HandlerList{}.Append(
+		handler("vmm", noop),
+		handler("drives", waitFor(drivesStarted, nicsStarted), "vmm"),
+		handler("nics", waitFor(nicsStarted, drivesStarted), "vmm"),
+		handler("mmds", noop, "nics"),
+		handler("boot", noop),
+	)
+
+	m := &Machine{
+		logger: fctesting.NewLogEntry(t),
+	}
+	if err := h.Run(context.Background(), m); err != nil {
+		t.Fatalf("expected no error, but received %v", err)
+	}
+
+	index := make(map[string]int)
+	for i, event := range events {
+		index[event] = i
+	}
+	for _, order := range [][2]string{
+		{"end vmm", "start drives"},
+		{"end vmm", "start nics"},
+		{"end nics", "start mmds"},
+		{"end drives", "start boot"},
+		{"end mmds", "start boot"},
+	} {
+		if index[order[0]] > index[order[1]] {
+			t.Errorf("expected %q before %q, but received %v", order[0], order[1], events)
+		}
+	}
+}
+
+func TestHandlerListRunConcurrency(t *testing.T) {
+	var running, maxRunning int32
+	h := HandlerList{}
+	for i := 0; i < 5; i++ {
+		h = h.Append(Handler{
+			Name: fmt.Sprintf("handler%d", i),
+			Fn: func(ctx context.Context, m *Machine) error {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					max := atomic.LoadInt32(&maxRunning)
+					if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+						break
+					}
+				}
+				time.Sleep(10 * time.Millisecond)
+				return nil
+			},
+			DependsOn: []string{},
+		})
+	}
+
+	for _, concurrency := range []int{1, 2} {
+		atomic.StoreInt32(&maxRunning, 0)
+		m := &Machine{
+			logger: fctesting.NewLogEntry(t),
+		}
+		WithHandlerConcurrency(concurrency)(m)
+		if err := h.Run(context.Background(), m); err != nil {
+			t.Errorf("expected no error, but received %v", err)
+		}
+		if e, a := int32(concurrency), atomic.LoadInt32(&maxRunning); e != a {
+			t.Errorf("expected at most %d handlers running, but received %d", e, a)
+		}
+	}
+}
+
+func TestHandlerListRunInvalidDependencies(t *testing.T) {
+	called := false
+	fn := func(ctx context.Context, m *Machine) error {
+		called = true
+		return nil
+	}
+
+	cases := []struct {
+		name string
+		list HandlerList
+	}{
+		{
+			name: "missing dependency",
+			list: HandlerList{}.Append(
+				Handler{Name: "foo", Fn: fn},
+				Handler{Name: "bar", Fn: fn, DependsOn: []string{"baz"}},
+			),
+		},
+		{
+			name: "cycle",
+			list: HandlerList{}.Append(
+				Handler{Name: "foo", Fn: fn, DependsOn: []string{"bar"}},
+				Handler{Name: "bar", Fn: fn, DependsOn: []string{"foo"}},
+			),
+		},
+		{
+			name: "dependency on a later sequential handler",
+			list: HandlerList{}.Append(
+				Handler{Name: "foo", Fn: fn, DependsOn: []string{"bar"}},
+				Handler{Name: "bar", Fn: fn},
+			),
+		},
+	}
+
+	m := &Machine{
+		logger: fctesting.NewLogEntry(t),
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.list.Run(context.Background(), m); err == nil {
+				t.Errorf("expected an error, but received none")
+			}
+			if called {
+				t.Errorf("expected no handler to run")
+			}
+		})
+	}
+}
+
+func TestHandlerListRemoveInheritsDependencies(t *testing.T) {
+	h := HandlerList{}.Append(
+		Handler{Name: "foo"},
+		Handler{Name: "bar", DependsOn: []string{"foo"}},
+		Handler{Name: "baz", DependsOn: []string{"bar"}},
+		Handler{Name: "qux"},
+	)
+
+	h = h.Remove("bar")
+	if e, a := []string{"foo"}, h.list[1].DependsOn; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	h = h.Remove("foo")
+	if e, a := []string{}, h.list[0].DependsOn; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+	if _, err := h.dependencies(); err != nil {
+		t.Errorf("expected no error, but received %v", err)
+	}
+
+	// the default handlers stay valid when loading a snapshot
+	if _, err := modifyHandlersForLoadSnapshot(defaultFcInitHandlerList).dependencies(); err != nil {
+		t.Errorf("expected no error, but received %v", err)
+	}
+}
+
+func TestHandlerListRunUndo(t *testing.T) {
+	var undone []string
+	undo := func(name string, err error) func(context.Context, *Machine) error {
+		return func(ctx context.Context, m *Machine) error {
+			if ctx.Err() != nil {
+				t.Errorf("expected a live context to undo %s", name)
+			}
+			undone = append(undone, name)
+			return err
+		}
+	}
+	noop := func(ctx context.Context, m *Machine) error { return nil }
+	tapErr := fmt.Errorf("tap error")
+	mountErr := fmt.Errorf("device busy")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := HandlerList{}.Append(
+		Handler{Name: "tap", Fn: noop, Undo: undo("tap", nil)},
+		Handler{Name: "noundo", Fn: noop},
+		Handler{Name: "mount", Fn: noop, Undo: undo("mount", mountErr)},
+		Handler{
+			Name: "fail",
+			Fn: func(ctx context.Context, m *Machine) error {
+				cancel()
+				return tapErr
+			},
+			Undo: undo("fail", nil),
+		},
+		Handler{Name: "next", Fn: noop, Undo: undo("next", nil)},
+	)
+
+	m := &Machine{
+		logger: fctesting.NewLogEntry(t),
+	}
+	err := h.Run(ctx, m)
+	if !errors.Is(err, tapErr) || !errors.Is(err, mountErr) {
+		t.Errorf("expected the handler and undo errors, but received %v", err)
+	}
+	if e, a := []string{"mount", "tap"}, undone; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+
+	// the error of the handler is returned as is if nothing failed to undo
+	undone = nil
+	h = h.Remove("mount")
+	if err := h.Run(context.Background(), m); err != tapErr {
+		t.Errorf("expected %v, but received %v", tapErr, err)
+	}
+	if e, a := []string{"tap"}, undone; !reflect.DeepEqual(e, a) {
+		t.Errorf("expected %v, but received %v", e, a)
+	}
+}
+
 func TestHandlerListHas(t *testing.T) {
 	cases := []struct {
 		name     string
@@ -660,6 +898,24 @@ func TestHandlers(t *testing.T) {
 				}},
 			},
 		},
+		{
+			Handler: ConfigBalloonHandler,
+			Client: fctesting.MockClient{
+				PutBalloonFn: func(params *ops.PutBalloonParams) (*ops.PutBalloonNoContent, error) {
+					called = ConfigBalloonHandlerName
+					if Int64Value(params.Body.AmountMib) != 64 || !BoolValue(params.Body.DeflateOnOom) {
+						return nil, fmt.Errorf("incorrect balloon value: %v", params.Body)
+					}
+					return &ops.PutBalloonNoContent{}, nil
+				},
+			},
+			Config: Config{
+				Balloon: &models.Balloon{
+					AmountMib:    Int64(64),
+					DeflateOnOom: Bool(true),
+				},
+			},
+		},
 	}
 
 	ctx := context.Background()
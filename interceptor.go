@@ -0,0 +1,69 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"time"
+)
+
+// APICall describes a request sent by the Client to the Firecracker API.
+type APICall struct {
+	// Operation is the name of the API operation, such as PutGuestDriveByID.
+	Operation string
+	// Request is the model sent as the body of the request, such as a
+	// *models.Drive, or nil if the request has no body.
+	Request interface{}
+	// Attempt is the number of the attempt, starting at 1. It is greater than
+	// 1 when the request is retried by the RetryPolicy of the Client.
+	Attempt int
+
+	// Response is the response of the generated client, such as a
+	// *ops.PutGuestDriveByIDNoContent. It is set once the request succeeded.
+	Response interface{}
+	// Latency is the time spent in the generated client. It is set once the
+	// request completed.
+	Latency time.Duration
+}
+
+// APIInvoker sends the request described by call.
+type APIInvoker func(ctx context.Context, call *APICall) error
+
+// Interceptor is called around every attempt of every request of the Client.
+// It calls next to send the request, and may inspect or modify call and the
+// returned error before and after doing so. Errors returned by next are
+// APIErrors. An interceptor which does not call next, for instance to inject
+// a fault, must return an error or set call.Response.
+type Interceptor func(ctx context.Context, call *APICall, next APIInvoker) error
+
+// WithInterceptors adds interceptors to the Client. The first interceptor is
+// the outermost one: it is called first and sees the results of all the
+// others.
+func WithInterceptors(interceptors ...Interceptor) ClientOpt {
+	return func(c *Client) {
+		c.interceptors = append(c.interceptors, interceptors...)
+	}
+}
+
+// chainInterceptors returns an APIInvoker calling the interceptors in order
+// around invoker.
+func chainInterceptors(interceptors []Interceptor, invoker APIInvoker) APIInvoker {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], invoker
+		invoker = func(ctx context.Context, call *APICall) error {
+			return interceptor(ctx, call, next)
+		}
+	}
+	return invoker
+}
@@ -0,0 +1,123 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+func TestInterceptors(t *testing.T) {
+	var events []string
+	recorder := func(name string) Interceptor {
+		return func(ctx context.Context, call *APICall, next APIInvoker) error {
+			events = append(events, name+" before "+call.Operation)
+			err := next(ctx, call)
+			events = append(events, name+" after "+call.Operation)
+			return err
+		}
+	}
+
+	var seen *APICall
+	var seenErr error
+	inspector := func(ctx context.Context, call *APICall, next APIInvoker) error {
+		seenErr = next(ctx, call)
+		seen = call
+		return seenErr
+	}
+
+	client := NewClient("/path/to/socket", nil, false,
+		WithOpsClient(&fctesting.MockClient{
+			PutGuestBootSourceFn: func(params *ops.PutGuestBootSourceParams) (*ops.PutGuestBootSourceNoContent, error) {
+				time.Sleep(time.Millisecond)
+				return &ops.PutGuestBootSourceNoContent{}, nil
+			},
+			PutGuestVsockFn: func(params *ops.PutGuestVsockParams) (*ops.PutGuestVsockNoContent, error) {
+				return nil, &ops.PutGuestVsockBadRequest{Payload: &models.Error{FaultMessage: "Invalid CID"}}
+			},
+		}),
+		WithInterceptors(recorder("a"), recorder("b")),
+		WithInterceptors(inspector),
+	)
+
+	source := &models.BootSource{KernelImagePath: String("/vmlinux")}
+	resp, err := client.PutGuestBootSource(context.Background(), source)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"a before PutGuestBootSource",
+		"b before PutGuestBootSource",
+		"b after PutGuestBootSource",
+		"a after PutGuestBootSource",
+	}, events)
+
+	require.NotNil(t, seen)
+	assert.Equal(t, "PutGuestBootSource", seen.Operation)
+	assert.Equal(t, 1, seen.Attempt)
+	assert.Equal(t, source, seen.Request)
+	assert.Equal(t, resp, seen.Response)
+	assert.GreaterOrEqual(t, seen.Latency, time.Millisecond)
+	assert.NoError(t, seenErr)
+
+	_, err = client.PutGuestVsock(context.Background(), &models.Vsock{})
+	var apiErr *APIError
+	require.True(t, errors.As(seenErr, &apiErr), "unexpected error %v", seenErr)
+	assert.Equal(t, "Invalid CID", apiErr.FaultMessage)
+	assert.Nil(t, seen.Response)
+	assert.Equal(t, seenErr, err)
+}
+
+func TestInterceptorFaultInjection(t *testing.T) {
+	var calls, injected int
+	client := NewClient("/path/to/socket", nil, false,
+		WithOpsClient(&fctesting.MockClient{
+			GetMachineConfigurationFn: func(params *ops.GetMachineConfigurationParams) (*ops.GetMachineConfigurationOK, error) {
+				calls++
+				return &ops.GetMachineConfigurationOK{Payload: &models.MachineConfiguration{VcpuCount: Int64(2)}}, nil
+			},
+		}),
+		WithRetryPolicy(RetryPolicy{InitialBackoff: time.Millisecond}),
+		WithInterceptors(func(ctx context.Context, call *APICall, next APIInvoker) error {
+			if call.Attempt == 1 {
+				injected++
+				return errConnRefused
+			}
+			return next(ctx, call)
+		}),
+	)
+
+	resp, err := client.GetMachineConfiguration()
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), Int64Value(resp.Payload.VcpuCount))
+	assert.Equal(t, 1, injected)
+	assert.Equal(t, 1, calls)
+
+	// the injected error is classified like a real one
+	client = NewClient("/path/to/socket", nil, false,
+		WithOpsClient(&fctesting.MockClient{}),
+		WithInterceptors(func(ctx context.Context, call *APICall, next APIInvoker) error {
+			return errConnRefused
+		}),
+	)
+	_, err = client.GetMachineConfiguration()
+	assert.True(t, errors.Is(err, ErrVMMUnavailable), "unexpected error %v", err)
+}
@@ -20,8 +20,10 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 const (
@@ -349,15 +351,19 @@ func (b JailerCommandBuilder) Build(ctx context.Context) *exec.Cmd {
 	return cmd
 }
 
+// jailerRootfs returns the root of the chroot the jailer runs firecracker in.
+func jailerRootfs(cfg *JailerConfig) string {
+	chrootBaseDir := cfg.ChrootBaseDir
+	if chrootBaseDir == "" {
+		chrootBaseDir = defaultJailerPath
+	}
+	return filepath.Join(chrootBaseDir, filepath.Base(cfg.ExecFile), cfg.ID, rootfsFolderName)
+}
+
 // Jail will set up proper handlers and remove configuration validation due to
 // stating of files
 func jail(ctx context.Context, m *Machine, cfg *Config) error {
-	jailerWorkspaceDir := ""
-	if len(cfg.JailerCfg.ChrootBaseDir) > 0 {
-		jailerWorkspaceDir = filepath.Join(cfg.JailerCfg.ChrootBaseDir, filepath.Base(cfg.JailerCfg.ExecFile), cfg.JailerCfg.ID, rootfsFolderName)
-	} else {
-		jailerWorkspaceDir = filepath.Join(defaultJailerPath, filepath.Base(cfg.JailerCfg.ExecFile), cfg.JailerCfg.ID, rootfsFolderName)
-	}
+	jailerWorkspaceDir := jailerRootfs(cfg.JailerCfg)
 
 	var machineSocketPath string
 	if cfg.SocketPath != "" {
@@ -379,6 +385,7 @@ func jail(ctx context.Context, m *Machine, cfg *Config) error {
 	}
 
 	fcArgs := seccompArgs(cfg)
+	fcArgs = append(fcArgs, bootTimerArgs(cfg)...)
 	fcArgs = append(fcArgs, "--api-sock", machineSocketPath)
 
 	builder := NewJailerCommandBuilder().
@@ -408,7 +415,9 @@ func jail(ctx context.Context, m *Machine, cfg *Config) error {
 		builder = builder.WithStdin(stdin)
 	}
 
-	m.cmd = builder.Build(ctx)
+	// The jailer must outlive ctx, its lifetime is bound to the Machine's
+	// lifecycle context instead.
+	m.cmd = builder.Build(context.Background())
 
 	if err := cfg.JailerCfg.ChrootStrategy.AdaptHandlers(&m.Handlers); err != nil {
 		return err
@@ -515,6 +524,50 @@ func NewNaiveChrootStrategy(kernelImagePath string) NaiveChrootStrategy {
 	}
 }
 
+// NaiveChrootStrategyName is the name NaiveChrootStrategy is registered under,
+// see RegisterChrootStrategy.
+const NaiveChrootStrategyName = "naive"
+
+// ChrootStrategyFactory creates the chroot strategy of a jailed VM from its
+// Config.
+type ChrootStrategyFactory func(cfg Config) (HandlersAdapter, error)
+
+var (
+	chrootStrategiesMu sync.RWMutex
+	chrootStrategies   = map[string]ChrootStrategyFactory{
+		NaiveChrootStrategyName: func(cfg Config) (HandlersAdapter, error) {
+			return NewNaiveChrootStrategy(cfg.KernelImagePath), nil
+		},
+	}
+)
+
+// RegisterChrootStrategy makes a chroot strategy available by name to
+// configuration files read with LoadConfig and ParseConfig. Registering a
+// strategy under an existing name replaces it.
+func RegisterChrootStrategy(name string, factory ChrootStrategyFactory) {
+	chrootStrategiesMu.Lock()
+	defer chrootStrategiesMu.Unlock()
+
+	chrootStrategies[name] = factory
+}
+
+// newChrootStrategy creates the chroot strategy registered under name.
+func newChrootStrategy(name string, cfg Config) (HandlersAdapter, error) {
+	chrootStrategiesMu.RLock()
+	factory, ok := chrootStrategies[name]
+	names := make([]string, 0, len(chrootStrategies))
+	for n := range chrootStrategies {
+		names = append(names, n)
+	}
+	chrootStrategiesMu.RUnlock()
+
+	if !ok {
+		sort.Strings(names)
+		return nil, fmt.Errorf("unknown chroot strategy %q, expected one of %s", name, strings.Join(names, ", "))
+	}
+	return factory(cfg)
+}
+
 // ErrRequiredHandlerMissing occurs when a required handler is not present in
 // the handler list.
 var ErrRequiredHandlerMissing = fmt.Errorf("required handler is missing from FcInit's list")
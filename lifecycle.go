@@ -0,0 +1,209 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// subscriberBufferSize is the number of events that may be queued for a
+// subscriber before further events are dropped.
+const subscriberBufferSize = 16
+
+// MachineState represents a step in the lifecycle of a Machine.
+//
+// A Machine moves through the states as follows:
+//
+//	Created -> Starting -> Running <-> Paused -> Stopping -> Exited
+//
+// Failed is entered instead of Exited when the Machine fails to start or the
+// VMM exits with an error without having been asked to stop. Exited and
+// Failed are terminal states.
+type MachineState int
+
+const (
+	// StateCreated is the state of a Machine returned by NewMachine, or by
+	// AttachMachine for a VMM whose instance was not started.
+	StateCreated MachineState = iota
+	// StateStarting is entered once Start begins running the handlers.
+	StateStarting
+	// StateRunning is entered once the guest has been booted or resumed.
+	StateRunning
+	// StatePaused is entered once the guest has been paused, or a snapshot
+	// has been loaded without resuming it.
+	StatePaused
+	// StateStopping is entered once a shutdown of the VMM has been requested.
+	StateStopping
+	// StateExited is entered once the VMM process has exited.
+	StateExited
+	// StateFailed is entered when the Machine failed to start or the VMM
+	// exited unexpectedly.
+	StateFailed
+)
+
+var machineStateNames = map[MachineState]string{
+	StateCreated:  "Created",
+	StateStarting: "Starting",
+	StateRunning:  "Running",
+	StatePaused:   "Paused",
+	StateStopping: "Stopping",
+	StateExited:   "Exited",
+	StateFailed:   "Failed",
+}
+
+func (s MachineState) String() string {
+	if name, ok := machineStateNames[s]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (s MachineState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (s *MachineState) UnmarshalText(text []byte) error {
+	for state, name := range machineStateNames {
+		if name == string(text) {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown machine state %q", text)
+}
+
+// Terminal returns true if no further transitions can happen from the state.
+func (s MachineState) Terminal() bool {
+	return s == StateExited || s == StateFailed
+}
+
+// MachineEvent describes a transition of a Machine from one state to another.
+type MachineEvent struct {
+	// VMID is the ID of the Machine that emitted the event.
+	VMID string
+	// Previous is the state the Machine was in before the transition.
+	Previous MachineState
+	// State is the state the Machine transitioned to.
+	State MachineState
+	// Time is when the transition happened.
+	Time time.Time
+	// Err is the error that caused the transition, if any.
+	Err error
+}
+
+// State returns the current lifecycle state of the Machine.
+func (m *Machine) State() MachineState {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	return m.state
+}
+
+// Subscribe returns a channel on which every subsequent state transition of
+// the Machine is delivered. The channel is closed once the provided context is
+// cancelled or the Machine reaches a terminal state, after the terminal event
+// has been delivered.
+//
+// Events are buffered per subscriber; a subscriber that does not keep up will
+// miss events rather than block the Machine. Transitions that happened before
+// Subscribe was called are not replayed, use State to get the current state.
+func (m *Machine) Subscribe(ctx context.Context) <-chan MachineEvent {
+	ch := make(chan MachineEvent, subscriberBufferSize)
+
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	if m.state.Terminal() {
+		close(ch)
+		return ch
+	}
+
+	if m.subscribers == nil {
+		m.subscribers = make(map[chan MachineEvent]chan struct{})
+	}
+	done := make(chan struct{})
+	m.subscribers[ch] = done
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+
+		m.stateMu.Lock()
+		defer m.stateMu.Unlock()
+
+		// the subscriber may already have been closed by a terminal transition
+		if _, ok := m.subscribers[ch]; ok {
+			delete(m.subscribers, ch)
+			close(ch)
+		}
+	}()
+
+	return ch
+}
+
+// setState transitions the Machine to the given state and notifies all
+// subscribers. Transitions out of a terminal state, transitions to the
+// current state and stopping a Machine without a VMM are ignored.
+func (m *Machine) setState(state MachineState, err error) {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	if m.state.Terminal() || m.state == state {
+		return
+	}
+	if state == StateStopping && m.state == StateCreated && m.vmmProcess() == nil {
+		// nothing will ever exit
+		return
+	}
+
+	event := MachineEvent{
+		VMID:     m.Cfg.VMID,
+		Previous: m.state,
+		State:    state,
+		Time:     time.Now(),
+		Err:      err,
+	}
+	m.state = state
+	m.writeStateRecord(state)
+
+	if m.logger != nil {
+		m.logger.Debugf("machine state changed from %s to %s", event.Previous, event.State)
+	}
+
+	for ch, done := range m.subscribers {
+		select {
+		case ch <- event:
+		default:
+			if m.logger != nil {
+				m.logger.Warnf("dropping %s event for slow subscriber", event.State)
+			}
+		}
+
+		if state.Terminal() {
+			close(ch)
+			close(done)
+		}
+	}
+
+	if state.Terminal() {
+		m.subscribers = nil
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+func receiveStates(t *testing.T, ch <-chan MachineEvent, n int) []MachineState {
+	t.Helper()
+
+	var states []MachineState
+	for i := 0; i < n; i++ {
+		select {
+		case event, ok := <-ch:
+			require.True(t, ok, "subscription closed after %v", states)
+			states = append(states, event.State)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for event, received %v", states)
+		}
+	}
+	return states
+}
+
+func TestMachineStateString(t *testing.T) {
+	assert.Equal(t, "Created", StateCreated.String())
+	assert.Equal(t, "Paused", StatePaused.String())
+	assert.Equal(t, "Unknown", MachineState(42).String())
+
+	assert.False(t, StateStopping.Terminal())
+	assert.True(t, StateExited.Terminal())
+	assert.True(t, StateFailed.Terminal())
+}
+
+func TestSubscribePauseResume(t *testing.T) {
+	m, err := NewMachine(
+		context.Background(),
+		Config{DisableValidation: true, VMID: "test-vm"},
+		WithClient(NewClient("/path/to/socket", nil, false, WithOpsClient(&fctesting.MockClient{}))),
+		WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, StateCreated, m.State())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events := m.Subscribe(ctx)
+
+	require.NoError(t, m.PauseVM(ctx))
+	require.NoError(t, m.ResumeVM(ctx))
+	// resuming a running machine is not a transition
+	require.NoError(t, m.ResumeVM(ctx))
+	require.NoError(t, m.PauseVM(ctx))
+
+	assert.Equal(t, []MachineState{StatePaused, StateRunning, StatePaused}, receiveStates(t, events, 3))
+	assert.Equal(t, StatePaused, m.State())
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok, "expected the subscription to be closed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription was not closed after its context was cancelled")
+	}
+}
+
+func TestStopNotStarted(t *testing.T) {
+	m, err := NewMachine(
+		context.Background(),
+		Config{DisableValidation: true, VMID: "test-vm"},
+		WithClient(NewClient("/path/to/socket", nil, false, WithOpsClient(&fctesting.MockClient{}))),
+		WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+
+	events := m.Subscribe(context.Background())
+	require.NoError(t, m.StopVMM())
+	_, err = m.ShutdownWithPolicy(context.Background(), ShutdownPolicy{})
+	require.NoError(t, err)
+	require.NoError(t, m.Shutdown(context.Background()))
+
+	// a Machine that was never started has nothing to stop
+	assert.Equal(t, StateCreated, m.State())
+	select {
+	case event := <-events:
+		t.Errorf("unexpected transition to %s", event.State)
+	default:
+	}
+}
+
+func TestSubscribeTerminalState(t *testing.T) {
+	m := &Machine{Cfg: Config{VMID: "test-vm"}, logger: fctesting.NewLogEntry(t)}
+
+	events := m.Subscribe(context.Background())
+	m.setState(StateStarting, nil)
+	m.setState(StateFailed, assert.AnError)
+	// transitions out of a terminal state are ignored
+	m.setState(StateRunning, nil)
+
+	var received []MachineEvent
+	for event := range events {
+		received = append(received, event)
+	}
+	require.Len(t, received, 2)
+	assert.Equal(t, StateCreated, received[0].Previous)
+	assert.Equal(t, StateStarting, received[0].State)
+	assert.Equal(t, StateFailed, received[1].State)
+	assert.Equal(t, assert.AnError, received[1].Err)
+	assert.Equal(t, "test-vm", received[1].VMID)
+	assert.Equal(t, StateFailed, m.State())
+
+	_, ok := <-m.Subscribe(context.Background())
+	assert.False(t, ok, "expected subscribing to a terminated machine to return a closed channel")
+}
+
+func TestMachineStateLifecycle(t *testing.T) {
+	socketPath, cleanup := makeSocketPath(t)
+	defer cleanup()
+
+	// the socket only needs to exist, the API calls are served by the mock
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	ctx := context.Background()
+	m, err := NewMachine(
+		ctx,
+		Config{
+			SocketPath:        socketPath,
+			DisableValidation: true,
+			MachineCfg:        models.MachineConfiguration{VcpuCount: Int64(1), MemSizeMib: Int64(64)},
+		},
+		WithClient(NewClient(socketPath, nil, false, WithOpsClient(&fctesting.MockClient{}))),
+		WithProcessRunner(exec.Command("sleep", "60")),
+		WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+	m.Handlers.FcInit = HandlerList{}.Append(StartVMMHandler)
+
+	events := m.Subscribe(ctx)
+
+	require.NoError(t, m.Start(ctx))
+	assert.Equal(t, StateRunning, m.State())
+
+	require.NoError(t, m.StopVMM())
+	assert.Error(t, m.Wait(ctx), "expected the VMM to be killed by a signal")
+	assert.Equal(t, StateExited, m.State())
+
+	var states []MachineState
+	for event := range events {
+		states = append(states, event.State)
+	}
+	assert.Equal(t, []MachineState{StateStarting, StateRunning, StateStopping, StateExited}, states)
+}
+
+func TestMachineStateUnexpectedExit(t *testing.T) {
+	socketPath, cleanup := makeSocketPath(t)
+	defer cleanup()
+
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	ctx := context.Background()
+	m, err := NewMachine(
+		ctx,
+		Config{SocketPath: socketPath, DisableValidation: true},
+		WithClient(NewClient(socketPath, nil, false, WithOpsClient(&fctesting.MockClient{}))),
+		WithProcessRunner(exec.Command("sh", "-c", "sleep 0.2; exit 3")),
+		WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+	m.Handlers.FcInit = HandlerList{}.Append(StartVMMHandler)
+
+	require.NoError(t, m.Start(ctx))
+	assert.Error(t, m.Wait(ctx))
+	assert.Equal(t, StateFailed, m.State())
+}
+
+// newLifecycleTestMachine returns a Machine running sleep in place of
+// firecracker.
+func newLifecycleTestMachine(t *testing.T, opts ...Opt) *Machine {
+	t.Helper()
+
+	socketPath, cleanup := makeSocketPath(t)
+	t.Cleanup(cleanup)
+
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	opts = append([]Opt{
+		WithClient(NewClient(socketPath, nil, false, WithOpsClient(&fctesting.MockClient{}))),
+		WithProcessRunner(exec.Command("sleep", "60")),
+		WithLogger(fctesting.NewLogEntry(t)),
+	}, opts...)
+
+	m, err := NewMachine(context.Background(), Config{SocketPath: socketPath, DisableValidation: true}, opts...)
+	require.NoError(t, err)
+	m.Handlers.FcInit = HandlerList{}.Append(StartVMMHandler)
+	return m
+}
+
+func TestStartContextOnlyBoundsBoot(t *testing.T) {
+	m := newLifecycleTestMachine(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, m.Start(ctx))
+	cancel()
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer waitCancel()
+	assert.Equal(t, context.DeadlineExceeded, m.Wait(waitCtx), "the VMM must outlive the Start context")
+	assert.Equal(t, StateRunning, m.State())
+
+	require.NoError(t, m.Close())
+	assert.Equal(t, StateExited, m.State())
+}
+
+func TestWithLifecycleContext(t *testing.T) {
+	lifecycleCtx, cancel := context.WithCancel(context.Background())
+	m := newLifecycleTestMachine(t, WithLifecycleContext(lifecycleCtx))
+
+	require.NoError(t, m.Start(context.Background()))
+	cancel()
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer waitCancel()
+	assert.Error(t, m.Wait(waitCtx), "expected the VMM to be stopped by a signal")
+	assert.Equal(t, StateExited, m.State())
+}
+
+func TestStartFailureStopsVMM(t *testing.T) {
+	m := newLifecycleTestMachine(t)
+	m.Handlers.FcInit = m.Handlers.FcInit.Append(Handler{
+		Name: "fcinit.Fail",
+		Fn: func(ctx context.Context, m *Machine) error {
+			return assert.AnError
+		},
+	})
+
+	assert.Equal(t, assert.AnError, m.Start(context.Background()))
+	assert.Equal(t, StateFailed, m.State())
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer waitCancel()
+	assert.NotEqual(t, context.DeadlineExceeded, m.Wait(waitCtx), "expected the VMM to be stopped")
+}
+
+func TestStartFailureRollsBack(t *testing.T) {
+	m := newLifecycleTestMachine(t)
+
+	var events []string
+	m.Handlers.FcInit = m.Handlers.FcInit.Append(
+		Handler{
+			Name: "test.CreateTap",
+			Fn: func(ctx context.Context, m *Machine) error {
+				m.RegisterCleanup(func() error {
+					events = append(events, "cleanup tap")
+					return nil
+				})
+				return nil
+			},
+			Undo: func(ctx context.Context, m *Machine) error {
+				events = append(events, "undo tap")
+				return nil
+			},
+		},
+		Handler{
+			Name: "fcinit.Fail",
+			Fn: func(ctx context.Context, m *Machine) error {
+				return assert.AnError
+			},
+		},
+	)
+
+	assert.Equal(t, assert.AnError, m.Start(context.Background()))
+	assert.Equal(t, []string{"undo tap", "cleanup tap"}, events)
+}
+
+func TestLifecycleWithFakeServer(t *testing.T) {
+	dir := t.TempDir()
+	server := fctesting.NewFakeServer(filepath.Join(dir, "fc.sock"))
+	require.NoError(t, server.Start())
+	defer server.Close()
+
+	m, err := NewMachine(context.Background(), Config{
+		SocketPath:        server.SocketPath,
+		DisableValidation: true,
+		KernelImagePath:   "/vmlinux",
+		Drives:            NewDrivesBuilder("/rootfs").Build(),
+		MachineCfg: models.MachineConfiguration{
+			VcpuCount:  Int64(2),
+			MemSizeMib: Int64(256),
+		},
+	},
+		WithProcessRunner(exec.Command("sleep", "60")),
+		WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, m.Start(context.Background()))
+	defer m.StopVMM()
+	assert.Equal(t, models.InstanceInfoStateRunning, server.State())
+	assert.Equal(t, int64(2), Int64Value(server.Config().MachineConfig.VcpuCount))
+
+	require.NoError(t, m.UpdateGuestDrive(context.Background(), "root_drive", "/rootfs2"))
+	assert.Equal(t, "/rootfs2", StringValue(server.Config().Drives[0].PathOnHost))
+	err = m.CreateSnapshot(context.Background(), filepath.Join(dir, "mem"), filepath.Join(dir, "snapshot"))
+	assert.True(t, errors.Is(err, ErrInvalidState), "a running VM cannot be snapshotted, received %v", err)
+
+	require.NoError(t, m.PauseVM(context.Background()))
+	assert.Equal(t, models.InstanceInfoStatePaused, server.State())
+	require.NoError(t, m.CreateSnapshot(context.Background(), filepath.Join(dir, "mem"), filepath.Join(dir, "snapshot")))
+	require.NoError(t, m.ResumeVM(context.Background()))
+
+	server.InjectFault("PatchVM", fctesting.Fault{FaultMessage: "injected"})
+	assert.Error(t, m.PauseVM(context.Background()))
+	assert.Equal(t, StateRunning, m.State())
+
+	if runtime.GOARCH != "arm64" {
+		require.NoError(t, m.Shutdown(context.Background()))
+		select {
+		case <-server.ShutdownRequested():
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the guest to be asked to shut down")
+		}
+	}
+}
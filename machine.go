@@ -26,7 +26,6 @@ import (
 	"path/filepath"
 	"runtime"
 	"strconv"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -35,6 +34,7 @@ import (
 	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/google/uuid"
 	"github.com/hashicorp/go-multierror"
+	"go.opentelemetry.io/otel/trace"
 
 	log "github.com/sirupsen/logrus"
 
@@ -158,6 +158,11 @@ type Config struct {
 	// restrictive they should be.
 	Seccomp SeccompConfig
 
+	// BootTimer starts Firecracker with --boot-timer, so that it logs the
+	// boot time of the guest, which is then reported by BootReport. The guest
+	// must signal the end of its boot by writing to the boot timer device.
+	BootTimer bool
+
 	// MmdsAddress is IPv4 address used by guest applications when issuing requests to MMDS.
 	// It is possible to use a valid IPv4 link-local address (169.254.0.0/16).
 	// If not provided, the default address (169.254.169.254) will be used.
@@ -169,6 +174,17 @@ type Config struct {
 
 	// Configuration for snapshot loading
 	Snapshot SnapshotConfig
+
+	// Balloon configures a memory balloon device for the microVM.
+	//
+	// This parameter is optional.
+	Balloon *models.Balloon
+
+	// Capabilities lists the features supported by the Firecracker binary.
+	// Validation and the handlers refuse to use the other features. If nil,
+	// the features are not checked. WithCapabilityDetection sets it from the
+	// version of the binary, CapabilitiesForVersion from a known version.
+	Capabilities Capabilities
 }
 
 func (cfg *Config) hasSnapshot() bool {
@@ -176,47 +192,17 @@ func (cfg *Config) hasSnapshot() bool {
 }
 
 // Validate will ensure that the required fields are set and that
-// the fields are valid values.
+// the fields are valid values. It returns ValidationErrors listing every
+// problem found.
 func (cfg *Config) Validate() error {
 	if cfg.DisableValidation {
 		return nil
 	}
 
-	if _, err := os.Stat(cfg.KernelImagePath); err != nil {
-		return fmt.Errorf("failed to stat kernel image path, %q: %v", cfg.KernelImagePath, err)
-	}
-
-	if cfg.InitrdPath != "" {
-		if _, err := os.Stat(cfg.InitrdPath); err != nil {
-			return fmt.Errorf("failed to stat initrd image path, %q: %v", cfg.InitrdPath, err)
-		}
-	}
-
-	for _, drive := range cfg.Drives {
-		if BoolValue(drive.IsRootDevice) {
-			rootPath := StringValue(drive.PathOnHost)
-			if _, err := os.Stat(rootPath); err != nil {
-				return fmt.Errorf("failed to stat host drive path, %q: %v", rootPath, err)
-			}
-
-			break
-		}
-	}
-
-	// Check the non-existence of some files:
-	if _, err := os.Stat(cfg.SocketPath); err == nil {
-		return fmt.Errorf("socket %s already exists", cfg.SocketPath)
-	}
-
-	if cfg.MachineCfg.VcpuCount == nil ||
-		Int64Value(cfg.MachineCfg.VcpuCount) < 1 {
-		return fmt.Errorf("machine needs a nonzero VcpuCount")
-	}
-	if cfg.MachineCfg.MemSizeMib == nil ||
-		Int64Value(cfg.MachineCfg.MemSizeMib) < 1 {
-		return fmt.Errorf("machine needs a nonzero amount of memory")
-	}
-	return nil
+	var v validator
+	cfg.validateFiles(&v)
+	cfg.validateDevices(&v)
+	return v.err()
 }
 
 func (cfg *Config) ValidateLoadSnapshot() error {
@@ -224,6 +210,12 @@ func (cfg *Config) ValidateLoadSnapshot() error {
 		return nil
 	}
 
+	var v validator
+	cfg.validateCapabilities(&v)
+	if err := v.err(); err != nil {
+		return err
+	}
+
 	for _, drive := range cfg.Drives {
 		rootPath := StringValue(drive.PathOnHost)
 		if _, err := os.Stat(rootPath); err != nil {
@@ -269,15 +261,54 @@ type Machine struct {
 	// exitCh is a channel which gets closed when the VMM exits
 	exitCh chan struct{}
 	// shutdownCh is a channel which gets closed when the VM is shutdown
-	shutdownCh chan struct{}
+	shutdownCh   chan struct{}
+	shutdownOnce sync.Once
 	// fatalErr records an error that either stops or prevent starting the VMM
 	fatalErr error
 
-	// callbacks that should be run when the machine is being torn down
+	// callbacks that should be run when the machine is being torn down,
+	// guarded by cleanupMu
 	cleanupOnce  sync.Once
+	cleanupMu    sync.Mutex
 	cleanupFuncs []func() error
 	// cleanupCh is a channel that gets closed to notify cleanup cleanupFuncs has been called totally
 	cleanupCh chan struct{}
+
+	// lifecycleCtx bounds the lifetime of the VMM, see WithLifecycleContext
+	lifecycleCtx context.Context
+
+	// process is the VMM process of a Machine created by AttachMachine, in
+	// which case cmd is nil.
+	process *os.Process
+
+	// stateMu guards the lifecycle state and its subscribers
+	stateMu     sync.Mutex
+	state       MachineState
+	subscribers map[chan MachineEvent]chan struct{}
+
+	// stateDir is where the state record is written, see WithStateDir
+	stateDir string
+	// recoveredState is the record a Machine was re-attached from, if any
+	recoveredState *MachineStateRecord
+
+	// configFile is set when the VM boots from a configuration file, see
+	// WithConfigFile
+	configFile *configFile
+
+	// exitInfo describes how the VMM exited, guarded by stateMu
+	exitInfo ExitInfo
+	// logTail keeps the last lines of the log captured from LogFifo
+	logTail *lineTail
+
+	// tracer creates the spans of the machine, see WithTracerProvider
+	tracer trace.Tracer
+	// boot collects the timeline of Start, see BootReport
+	boot bootRecorder
+	// metrics streams the metrics read from MetricsFifo, see Metrics
+	metrics metricsStream
+	// handlerConcurrency bounds how many handlers run concurrently, see
+	// WithHandlerConcurrency
+	handlerConcurrency int
 }
 
 // Logger returns a logrus logger appropriate for logging hypervisor messages
@@ -287,7 +318,8 @@ func (m *Machine) Logger() *log.Entry {
 
 // PID returns the machine's running process PID or an error if not running
 func (m *Machine) PID() (int, error) {
-	if m.cmd == nil || m.cmd.Process == nil {
+	process := m.vmmProcess()
+	if process == nil {
 		return 0, fmt.Errorf("machine is not running")
 	}
 	select {
@@ -295,15 +327,42 @@ func (m *Machine) PID() (int, error) {
 		return 0, fmt.Errorf("machine process has exited")
 	default:
 	}
-	return m.cmd.Process.Pid, nil
+	return process.Pid, nil
+}
+
+// vmmProcess returns the VMM process, either started by or attached to the
+// Machine, or nil if there is none.
+func (m *Machine) vmmProcess() *os.Process {
+	if m.process != nil {
+		return m.process
+	}
+	if m.cmd != nil {
+		return m.cmd.Process
+	}
+	return nil
+}
+
+// RegisterCleanup registers a function to be called when the machine is torn
+// down, that is once the VMM exited or when Start failed. The functions are
+// called in the reverse order of their registration, and their errors are
+// reported in ExitInfo.CleanupErrors. It may be called by handlers running
+// concurrently.
+func (m *Machine) RegisterCleanup(fn func() error) {
+	m.cleanupMu.Lock()
+	defer m.cleanupMu.Unlock()
+	m.cleanupFuncs = append(m.cleanupFuncs, fn)
 }
 
 func (m *Machine) doCleanup() error {
 	var err *multierror.Error
 	m.cleanupOnce.Do(func() {
+		m.cleanupMu.Lock()
+		cleanupFuncs := m.cleanupFuncs
+		m.cleanupMu.Unlock()
+
 		// run them in reverse order so changes are "unwound" (similar to defer statements)
-		for i := range m.cleanupFuncs {
-			cleanupFunc := m.cleanupFuncs[len(m.cleanupFuncs)-1-i]
+		for i := range cleanupFuncs {
+			cleanupFunc := cleanupFuncs[len(cleanupFuncs)-1-i]
 			err = multierror.Append(err, cleanupFunc())
 		}
 	})
@@ -351,20 +410,30 @@ func seccompArgs(cfg *Config) []string {
 	return args
 }
 
+// bootTimerArgs constructs the boot timer related command line arguments
+func bootTimerArgs(cfg *Config) []string {
+	if cfg.BootTimer {
+		return []string{"--boot-timer"}
+	}
+	return nil
+}
+
 func configureBuilder(builder VMCommandBuilder, cfg Config) VMCommandBuilder {
 	return builder.
 		WithSocketPath(cfg.SocketPath).
 		AddArgs("--id", cfg.VMID).
-		AddArgs(seccompArgs(&cfg)...)
+		AddArgs(seccompArgs(&cfg)...).
+		AddArgs(bootTimerArgs(&cfg)...)
 }
 
 // NewMachine initializes a new Machine instance and performs validation of the
 // provided Config.
 func NewMachine(ctx context.Context, cfg Config, opts ...Opt) (*Machine, error) {
 	m := &Machine{
-		exitCh:     make(chan struct{}),
-		shutdownCh: make(chan struct{}),
-		cleanupCh:  make(chan struct{}),
+		lifecycleCtx: context.Background(),
+		exitCh:       make(chan struct{}),
+		shutdownCh:   make(chan struct{}),
+		cleanupCh:    make(chan struct{}),
 	}
 
 	if cfg.VMID == "" {
@@ -384,7 +453,9 @@ func NewMachine(ctx context.Context, cfg Config, opts ...Opt) (*Machine, error)
 		}
 	} else {
 		m.Handlers.Validation = m.Handlers.Validation.Append(ConfigValidationHandler)
-		m.cmd = configureBuilder(defaultFirecrackerVMMCommandBuilder, cfg).Build(ctx)
+		// The VMM must outlive ctx, its lifetime is bound to the Machine's
+		// lifecycle context instead.
+		m.cmd = configureBuilder(defaultFirecrackerVMMCommandBuilder, cfg).Build(context.Background())
 	}
 
 	if m.client == nil {
@@ -408,6 +479,11 @@ func NewMachine(ctx context.Context, cfg Config, opts ...Opt) (*Machine, error)
 		m.Cfg.NetNS = m.defaultNetNSPath()
 	}
 
+	// a Config loaded from a file may describe a snapshot, without WithSnapshot
+	if cfg.hasSnapshot() {
+		useLoadSnapshotHandlers(m)
+	}
+
 	for _, opt := range opts {
 		opt(m)
 	}
@@ -423,11 +499,14 @@ func NewMachine(ctx context.Context, cfg Config, opts ...Opt) (*Machine, error)
 }
 
 // Start actually start a Firecracker microVM.
-// The context must not be cancelled while the microVM is running.
+// The context only bounds the boot sequence and may be cancelled once Start
+// returns. The VMM keeps running until it is stopped, the Machine is closed or
+// the context passed to WithLifecycleContext is done.
 //
 // It will iterate through the handler list and call each handler. If an
-// error occurred during handler execution, that error will be returned. If the
-// handlers succeed, then this will start the VMM instance.
+// error occurred during handler execution, that error will be returned and
+// the VMM is stopped if it was already started. If the handlers succeed, then
+// this will start the VMM instance.
 // Start may only be called once per Machine.  Subsequent calls will return
 // ErrAlreadyStarted.
 func (m *Machine) Start(ctx context.Context) error {
@@ -441,9 +520,19 @@ func (m *Machine) Start(ctx context.Context) error {
 		return ErrAlreadyStarted
 	}
 
+	m.setState(StateStarting, nil)
+
+	ctx, span := m.startSpan(ctx, "firecracker.Start")
 	var err error
+	defer func() { endSpan(span, err) }()
 	defer func() {
 		if err != nil {
+			m.setState(StateFailed, err)
+			if m.vmmProcess() != nil && !m.vmmExited() {
+				if _, stopErr := m.terminateVMM(context.Background(), 0); stopErr != nil {
+					m.Logger().Errorf("failed to stop VMM after previous start failure: %v", stopErr)
+				}
+			}
 			if cleanupErr := m.doCleanup(); cleanupErr != nil {
 				m.Logger().Errorf(
 					"failed to cleanup VM after previous start failure: %v", cleanupErr)
@@ -457,16 +546,28 @@ func (m *Machine) Start(ctx context.Context) error {
 	}
 
 	err = m.startInstance(ctx)
-	return err
+	if err != nil {
+		return err
+	}
+
+	// loading a snapshot already moved the machine to either Paused or Running
+	if m.State() == StateStarting {
+		m.setState(StateRunning, nil)
+	}
+	return nil
 }
 
 // Shutdown requests a clean shutdown of the VM by sending CtrlAltDelete on the virtual keyboard
-func (m *Machine) Shutdown(ctx context.Context) error {
+func (m *Machine) Shutdown(ctx context.Context) (err error) {
 	m.logger.Debug("Called machine.Shutdown()")
+	ctx, span := m.startSpan(ctx, "firecracker.Shutdown")
+	defer func() { endSpan(span, err) }()
 
-	close(m.shutdownCh)
+	m.shutdownOnce.Do(func() { close(m.shutdownCh) })
+	m.setState(StateStopping, nil)
 
 	if runtime.GOARCH != "arm64" {
+		m.markShutdownStage(ShutdownStageGuest)
 		return m.sendCtrlAltDel(ctx)
 	} else {
 		return m.StopVMM()
@@ -475,7 +576,8 @@ func (m *Machine) Shutdown(ctx context.Context) error {
 
 // Wait will wait until the firecracker process has finished.  Wait is safe to
 // call concurrently, and will deliver the same error to all callers, subject to
-// each caller's context cancellation.
+// each caller's context cancellation. Use ExitStatus for details on how the
+// VMM exited.
 func (m *Machine) Wait(ctx context.Context) error {
 	select {
 	case <-ctx.Done():
@@ -499,7 +601,10 @@ func (m *Machine) GetFirecrackerVersion(ctx context.Context) (string, error) {
 
 func (m *Machine) setupNetwork(ctx context.Context) error {
 	err, cleanupFuncs := m.Cfg.NetworkInterfaces.setupNetwork(ctx, m.Cfg.VMID, m.Cfg.NetNS, m.logger)
-	m.cleanupFuncs = append(m.cleanupFuncs, cleanupFuncs...)
+	for _, cleanupFunc := range cleanupFuncs {
+		m.RegisterCleanup(cleanupFunc)
+	}
+	m.persistState()
 	return err
 }
 
@@ -582,16 +687,17 @@ func (m *Machine) startVMM(ctx context.Context) error {
 	}
 	m.logger.Debugf("VMM started socket path is %s", m.Cfg.SocketPath)
 
-	m.cleanupFuncs = append(m.cleanupFuncs,
-		func() error {
-			if err := os.Remove(m.Cfg.SocketPath); !os.IsNotExist(err) {
-				return err
-			}
-			return nil
-		},
-	)
+	m.RegisterCleanup(func() error {
+		if err := os.Remove(m.Cfg.SocketPath); !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	})
+	m.persistState()
 
-	errCh := make(chan error)
+	// errCh is buffered so that the goroutine below does not block when
+	// waitForSocket gave up before the VMM exited.
+	errCh := make(chan error, 1)
 	go func() {
 		waitErr := m.cmd.Wait()
 
@@ -613,6 +719,14 @@ func (m *Machine) startVMM(ctx context.Context) error {
 		if cleanupErr != nil {
 			m.logger.Errorf("failed to cleanup after VM exit: %v", cleanupErr)
 		}
+		m.recordExit(m.cmd.ProcessState, waitErr, cleanupErr)
+
+		// Exiting with an error is only expected once the VMM was asked to stop.
+		if waitErr != nil && m.State() != StateStopping {
+			m.setState(StateFailed, waitErr)
+		} else {
+			m.setState(StateExited, waitErr)
+		}
 
 		errCh <- multierror.Append(waitErr, cleanupErr).ErrorOrNil()
 
@@ -625,8 +739,12 @@ func (m *Machine) startVMM(ctx context.Context) error {
 
 	m.setupSignals()
 
-	// Wait for firecracker to initialize:
-	err = m.waitForSocket(time.Duration(m.client.firecrackerInitTimeout)*time.Second, errCh)
+	// Wait for firecracker to initialize, unless it does not serve the API:
+	if m.configFile == nil || !m.configFile.noAPI {
+		waitStart := time.Now()
+		err = m.waitForSocket(time.Duration(m.client.firecrackerInitTimeout)*time.Second, errCh)
+		m.boot.setSocketWait(time.Since(waitStart))
+	}
 	if err != nil {
 		err = fmt.Errorf("Firecracker did not create API socket %s: %w", m.Cfg.SocketPath, err)
 		m.fatalErr = err
@@ -635,49 +753,67 @@ func (m *Machine) startVMM(ctx context.Context) error {
 		return err
 	}
 
-	// This goroutine is used to kill the process by context cancellation,
-	// but doesn't tell anyone about that.
+	m.stopOnLifecycleDone()
+
+	// This goroutine is used to tell clients that the process is stopped
+	// (gracefully or not).
+	go func() {
+		m.fatalErr = <-errCh
+		m.logger.Debugf("closing the exitCh %v", m.fatalErr)
+		close(m.exitCh)
+	}()
+
+	m.logger.Debugf("returning from startVMM()")
+	return nil
+}
+
+// stopOnLifecycleDone stops the VMM once the lifecycle context is done.
+func (m *Machine) stopOnLifecycleDone() {
+	lifecycleCtx := m.lifecycleCtx
+	if lifecycleCtx == nil {
+		lifecycleCtx = context.Background()
+	}
+
 	go func() {
 		select {
-		case <-ctx.Done():
+		case <-lifecycleCtx.Done():
 			break
 		case <-m.exitCh:
 			// VMM exited on its own; no need to stop it.
 			return
 		}
+		m.setState(StateStopping, nil)
 		err := m.stopVMM()
 		if err != nil {
 			m.logger.WithError(err).Errorf("failed to stop vm %q", m.Cfg.VMID)
 		}
 	}()
+}
 
-	// This goroutine is used to tell clients that the process is stopped
-	// (gracefully or not).
-	go func() {
-		m.fatalErr = <-errCh
-		m.logger.Debugf("closing the exitCh %v", m.fatalErr)
-		close(m.exitCh)
-	}()
-
-	m.logger.Debugf("returning from startVMM()")
-	return nil
+// Close stops the VMM if it is running and waits for it to exit, see StopVMM.
+// It is a no-op if the VMM was never started or has already exited.
+func (m *Machine) Close() error {
+	if m.vmmProcess() == nil {
+		return nil
+	}
+	return m.StopVMM()
 }
 
-// StopVMM stops the current VMM.
+// StopVMM stops the current VMM by sending it SIGTERM, followed by SIGKILL if
+// it has not exited after 10 seconds. It returns once the VMM has exited. Use
+// ShutdownWithPolicy for control over the timeouts.
 func (m *Machine) StopVMM() error {
+	m.setState(StateStopping, nil)
 	return m.stopVMM()
 }
 
 func (m *Machine) stopVMM() error {
-	if m.cmd != nil && m.cmd.Process != nil {
+	if process := m.vmmProcess(); process != nil {
 		m.logger.Debug("stopVMM(): sending sigterm to firecracker")
-		err := m.cmd.Process.Signal(syscall.SIGTERM)
-		if err != nil && !strings.Contains(err.Error(), "os: process already finished") {
-			return err
-		}
-		// Wait for the cleanup to finish.
-		<-m.cleanupCh
-		return nil
+		// Wait for the cleanup to finish, killing firecracker if it ignores
+		// SIGTERM.
+		_, err := m.terminateVMM(context.Background(), defaultTermTimeout)
+		return err
 	}
 	m.logger.Debug("stopVMM(): no firecracker process running, not sending a signal")
 
@@ -892,6 +1028,12 @@ func (m *Machine) UpdateGuestNetworkInterfaceRateLimit(ctx context.Context, ifac
 
 // attachDrive attaches a secondary block device
 func (m *Machine) attachDrive(ctx context.Context, dev models.Drive) error {
+	if dev.IoEngine != nil {
+		if err := m.Cfg.Capabilities.require(CapabilityDriveIoEngine); err != nil {
+			return err
+		}
+	}
+
 	hostPath := StringValue(dev.PathOnHost)
 	m.logger.Infof("Attaching drive %s, slot %s, root %t.", hostPath, StringValue(dev.DriveID), BoolValue(dev.IsRootDevice))
 	respNoContent, err := m.client.PutGuestDriveByID(ctx, StringValue(dev.DriveID), &dev)
@@ -920,7 +1062,8 @@ func (m *Machine) addVsock(ctx context.Context, dev VsockDevice) error {
 }
 
 func (m *Machine) startInstance(ctx context.Context) error {
-	if m.Cfg.hasSnapshot() {
+	// firecracker boots the VM from its configuration file on its own
+	if m.Cfg.hasSnapshot() || m.configFile != nil {
 		return nil
 	}
 
@@ -957,6 +1100,11 @@ func (m *Machine) setMmdsConfig(ctx context.Context, address net.IP, ifaces Netw
 	var mmdsCfg models.MmdsConfig
 	// MMDS config supports v1 and v2, v1 is going to be deprecated.
 	// Default to the version 1 if no version is specified
+	if version == MMDSv2 {
+		if err := m.Cfg.Capabilities.require(CapabilityMMDSv2); err != nil {
+			return err
+		}
+	}
 	if version == MMDSv1 || version == MMDSv2 {
 		mmdsCfg.Version = String(string(version))
 	} else {
@@ -1124,7 +1272,7 @@ func (m *Machine) setupSignals() {
 			case sig := <-sigchan:
 				m.logger.Debugf("Caught signal %s", sig)
 				// Some signals kill the process, some of them are not.
-				m.cmd.Process.Signal(sig)
+				m.vmmProcess().Signal(sig)
 			case <-m.exitCh:
 				// And if a signal kills the process, we can stop this for loop and remove sigchan.
 				break ForLoop
@@ -1137,7 +1285,10 @@ func (m *Machine) setupSignals() {
 }
 
 // PauseVM pauses the VM
-func (m *Machine) PauseVM(ctx context.Context, opts ...PatchVMOpt) error {
+func (m *Machine) PauseVM(ctx context.Context, opts ...PatchVMOpt) (err error) {
+	ctx, span := m.startSpan(ctx, "firecracker.PauseVM")
+	defer func() { endSpan(span, err) }()
+
 	vm := &models.VM{
 		State: String(models.VMStatePaused),
 	}
@@ -1147,12 +1298,16 @@ func (m *Machine) PauseVM(ctx context.Context, opts ...PatchVMOpt) error {
 		return err
 	}
 
+	m.setState(StatePaused, nil)
 	m.logger.Debug("VM paused successfully")
 	return nil
 }
 
 // ResumeVM resumes the VM
-func (m *Machine) ResumeVM(ctx context.Context, opts ...PatchVMOpt) error {
+func (m *Machine) ResumeVM(ctx context.Context, opts ...PatchVMOpt) (err error) {
+	ctx, span := m.startSpan(ctx, "firecracker.ResumeVM")
+	defer func() { endSpan(span, err) }()
+
 	vm := &models.VM{
 		State: String(models.VMStateResumed),
 	}
@@ -1162,12 +1317,16 @@ func (m *Machine) ResumeVM(ctx context.Context, opts ...PatchVMOpt) error {
 		return err
 	}
 
+	m.setState(StateRunning, nil)
 	m.logger.Debug("VM resumed successfully")
 	return nil
 }
 
 // CreateSnapshot creates a snapshot of the VM
-func (m *Machine) CreateSnapshot(ctx context.Context, memFilePath, snapshotPath string, opts ...CreateSnapshotOpt) error {
+func (m *Machine) CreateSnapshot(ctx context.Context, memFilePath, snapshotPath string, opts ...CreateSnapshotOpt) (err error) {
+	ctx, span := m.startSpan(ctx, "firecracker.CreateSnapshot")
+	defer func() { endSpan(span, err) }()
+
 	snapshotParams := &models.SnapshotCreateParams{
 		MemFilePath:  String(memFilePath),
 		SnapshotPath: String(snapshotPath),
@@ -1183,7 +1342,21 @@ func (m *Machine) CreateSnapshot(ctx context.Context, memFilePath, snapshotPath
 }
 
 // loadSnapshot loads a snapshot of the VM
-func (m *Machine) loadSnapshot(ctx context.Context, snapshot *SnapshotConfig) error {
+func (m *Machine) loadSnapshot(ctx context.Context, snapshot *SnapshotConfig) (err error) {
+	ctx, span := m.startSpan(ctx, "firecracker.LoadSnapshot")
+	defer func() { endSpan(span, err) }()
+
+	if snapshot.EnableDiffSnapshots {
+		if err := m.Cfg.Capabilities.require(CapabilityDiffSnapshots); err != nil {
+			return err
+		}
+	}
+	if snapshot.MemBackend != nil && StringValue(snapshot.MemBackend.BackendType) == models.MemoryBackendBackendTypeUffd {
+		if err := m.Cfg.Capabilities.require(CapabilityUffdBackend); err != nil {
+			return err
+		}
+	}
+
 	snapshotParams := &models.SnapshotLoadParams{
 		MemFilePath:         snapshot.MemFilePath,
 		MemBackend:          snapshot.MemBackend,
@@ -1196,12 +1369,22 @@ func (m *Machine) loadSnapshot(ctx context.Context, snapshot *SnapshotConfig) er
 		return fmt.Errorf("failed to load a snapshot for VM: %v", err)
 	}
 
+	if snapshot.ResumeVM {
+		m.setState(StateRunning, nil)
+	} else {
+		m.setState(StatePaused, nil)
+	}
+
 	m.logger.Debug("snapshot loaded successfully")
 	return nil
 }
 
 // CreateBalloon creates a balloon device if one does not exist
 func (m *Machine) CreateBalloon(ctx context.Context, amountMib int64, deflateOnOom bool, statsPollingIntervals int64, opts ...PutBalloonOpt) error {
+	if err := m.Cfg.Capabilities.require(CapabilityBalloon); err != nil {
+		return err
+	}
+
 	balloon := models.Balloon{
 		AmountMib:             &amountMib,
 		DeflateOnOom:          &deflateOnOom,
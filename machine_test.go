@@ -421,14 +421,14 @@ func TestStartVMM(t *testing.T) {
 		WithSocketPath(cfg.SocketPath).
 		WithBin(getFirecrackerBinaryPath()).
 		Build(ctx)
-	m, err := NewMachine(ctx, cfg, WithProcessRunner(cmd), WithLogger(fctesting.NewLogEntry(t)))
+	timeout, cancel := context.WithTimeout(ctx, 250*time.Millisecond)
+	defer cancel()
+	m, err := NewMachine(ctx, cfg, WithProcessRunner(cmd), WithLogger(fctesting.NewLogEntry(t)), WithLifecycleContext(timeout))
 	if err != nil {
 		t.Fatalf("failed to create new machine: %v", err)
 	}
 
 	m.Handlers.Validation = m.Handlers.Validation.Clear()
-	timeout, cancel := context.WithTimeout(ctx, 250*time.Millisecond)
-	defer cancel()
 	err = m.startVMM(timeout)
 	if err != nil {
 		t.Fatalf("startVMM failed: %s", err)
@@ -783,7 +783,8 @@ func testAttachVsock(ctx context.Context, t *testing.T, m *Machine) {
 	}
 	err := m.addVsock(ctx, dev)
 	if err != nil {
-		if badRequest, ok := err.(*ops.PutGuestVsockBadRequest); ok &&
+		var badRequest *ops.PutGuestVsockBadRequest
+		if errors.As(err, &badRequest) &&
 			strings.HasPrefix(badRequest.Payload.FaultMessage, "Invalid request method and/or path") {
 			t.Errorf(`attaching vsock failed: %s
 Does your Firecracker binary have vsock support?
@@ -798,7 +799,8 @@ Build one with vsock support by running `+"`cargo build --release --features vso
 func testStartInstance(ctx context.Context, t *testing.T, m *Machine) {
 	err := m.startInstance(ctx)
 	if err != nil {
-		if syncErr, ok := err.(*ops.CreateSyncActionDefault); ok &&
+		var syncErr *ops.CreateSyncActionDefault
+		if errors.As(err, &syncErr) &&
 			strings.HasPrefix(syncErr.Payload.FaultMessage, "Cannot create vsock device") {
 			t.Errorf(`startInstance: %s
 Do you have permission to interact with /dev/vhost-vsock?
@@ -1546,10 +1548,10 @@ func TestWait(t *testing.T) {
 				// some unexported members
 				args := m.cmd.Args[1:]
 				m.cmd = exec.Command(getFirecrackerBinaryPath(), args...)
-			}, WithLogger(logrus.NewEntry(machineLogger)))
+			}, WithLogger(logrus.NewEntry(machineLogger)), WithLifecycleContext(vmContext))
 			require.NoError(t, err)
 
-			err = m.Start(vmContext)
+			err = m.Start(ctx)
 			require.NoError(t, err)
 
 			pid, err := m.PID()
@@ -0,0 +1,405 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package manager keeps track of many Firecracker microVMs and runs
+// operations on them in bulk.
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+)
+
+// defaultParallelism is the number of VMs a bulk operation works on at the
+// same time unless WithParallelism is used.
+const defaultParallelism = 8
+
+// ErrExists is returned when a VM with the same ID is already registered.
+var ErrExists = errors.New("manager: a VM with this ID is already registered")
+
+// Option configures a Manager.
+type Option func(*Manager)
+
+// WithParallelism sets the number of VMs a bulk operation works on at the
+// same time. Values lower than 1 are ignored.
+func WithParallelism(n int) Option {
+	return func(m *Manager) {
+		if n > 0 {
+			m.parallelism = n
+		}
+	}
+}
+
+// WithLogger sets the logger of the Manager.
+func WithLogger(logger *logrus.Entry) Option {
+	return func(m *Manager) {
+		m.logger = logger
+	}
+}
+
+// Manager is a registry of microVMs keyed by their VMID. It is safe for
+// concurrent use.
+type Manager struct {
+	parallelism int
+	logger      *logrus.Entry
+
+	mu  sync.RWMutex
+	vms map[string]*VM
+}
+
+// New returns an empty Manager.
+func New(opts ...Option) *Manager {
+	m := &Manager{
+		parallelism: defaultParallelism,
+		vms:         make(map[string]*VM),
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	if m.logger == nil {
+		noop := logrus.New()
+		noop.Out = io.Discard
+		m.logger = logrus.NewEntry(noop)
+	}
+
+	return m
+}
+
+// VM is a Machine registered with a Manager.
+type VM struct {
+	// Machine is the registered microVM.
+	Machine *firecracker.Machine
+
+	id     string
+	cancel context.CancelFunc
+
+	mu     sync.RWMutex
+	labels map[string]string
+}
+
+// ID returns the VMID of the VM.
+func (vm *VM) ID() string {
+	return vm.id
+}
+
+// Labels returns a copy of the labels of the VM.
+func (vm *VM) Labels() map[string]string {
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+
+	labels := make(map[string]string, len(vm.labels))
+	for k, v := range vm.labels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// Label returns the value of a label of the VM.
+func (vm *VM) Label(key string) (string, bool) {
+	vm.mu.RLock()
+	defer vm.mu.RUnlock()
+
+	value, ok := vm.labels[key]
+	return value, ok
+}
+
+// SetLabel sets a label of the VM.
+func (vm *VM) SetLabel(key, value string) {
+	vm.mu.Lock()
+	defer vm.mu.Unlock()
+
+	vm.labels[key] = value
+}
+
+// Create creates a Machine with firecracker.NewMachine and registers it with
+// the given labels. The Machine is not started.
+func (m *Manager) Create(ctx context.Context, cfg firecracker.Config, labels map[string]string, opts ...firecracker.Opt) (*VM, error) {
+	machine, err := firecracker.NewMachine(ctx, cfg, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.Add(machine, labels)
+}
+
+// Add registers an existing Machine, for example one created with
+// firecracker.AttachMachine, with the given labels.
+//
+// The VM is removed from the Manager once its Machine reaches a terminal
+// state: when it exits, or when its Start fails, even if no VMM was started.
+func (m *Manager) Add(machine *firecracker.Machine, labels map[string]string) (*VM, error) {
+	vm := &VM{
+		Machine: machine,
+		id:      machine.Cfg.VMID,
+		labels:  make(map[string]string, len(labels)),
+	}
+	for k, v := range labels {
+		vm.labels[k] = v
+	}
+
+	m.mu.Lock()
+	if _, ok := m.vms[vm.id]; ok {
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%w: %q", ErrExists, vm.id)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	vm.cancel = cancel
+	m.vms[vm.id] = vm
+	m.mu.Unlock()
+
+	go m.removeOnExit(ctx, vm)
+
+	m.logger.WithField("vmid", vm.id).Debug("registered VM")
+	return vm, nil
+}
+
+// removeOnExit removes the VM once its Machine has exited or failed to
+// start, unless it is removed explicitly first. Machine.Wait is not enough,
+// since it never returns if Start fails before starting the VMM.
+func (m *Manager) removeOnExit(ctx context.Context, vm *VM) {
+	// the subscription is closed on a terminal state, or when ctx is done
+	state := vm.Machine.State()
+	var err error
+	for event := range vm.Machine.Subscribe(ctx) {
+		state, err = event.State, event.Err
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	m.logger.WithField("vmid", vm.id).WithError(err).Debugf("VM %s", state)
+	m.remove(vm)
+}
+
+// Get returns the VM with the given ID.
+func (m *Manager) Get(vmid string) (*VM, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	vm, ok := m.vms[vmid]
+	return vm, ok
+}
+
+// List returns the VMs matching the filter, ordered by ID. A nil filter
+// matches all VMs.
+func (m *Manager) List(filter Filter) []*VM {
+	m.mu.RLock()
+	vms := make([]*VM, 0, len(m.vms))
+	for _, vm := range m.vms {
+		vms = append(vms, vm)
+	}
+	m.mu.RUnlock()
+
+	matching := vms[:0]
+	for _, vm := range vms {
+		if filter == nil || filter(vm) {
+			matching = append(matching, vm)
+		}
+	}
+
+	sort.Slice(matching, func(i, j int) bool {
+		return matching[i].id < matching[j].id
+	})
+	return matching
+}
+
+// Remove unregisters the VM with the given ID without stopping it. It returns
+// false if no such VM is registered.
+func (m *Manager) Remove(vmid string) bool {
+	m.mu.RLock()
+	vm, ok := m.vms[vmid]
+	m.mu.RUnlock()
+
+	if !ok {
+		return false
+	}
+	return m.remove(vm)
+}
+
+// remove unregisters the VM, unless another VM has been registered under its
+// ID in the meantime.
+func (m *Manager) remove(vm *VM) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.vms[vm.id] != vm {
+		return false
+	}
+
+	delete(m.vms, vm.id)
+	vm.cancel()
+
+	m.logger.WithField("vmid", vm.id).Debug("removed VM")
+	return true
+}
+
+// Filter selects VMs.
+type Filter func(*VM) bool
+
+// WithLabels returns a Filter matching the VMs that have all of the given
+// labels.
+func WithLabels(labels map[string]string) Filter {
+	return func(vm *VM) bool {
+		for k, v := range labels {
+			if value, ok := vm.Label(k); !ok || value != v {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// InState returns a Filter matching the VMs in one of the given states.
+func InState(states ...firecracker.MachineState) Filter {
+	return func(vm *VM) bool {
+		state := vm.Machine.State()
+		for _, s := range states {
+			if s == state {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Errors is returned by bulk operations and maps the ID of each VM the
+// operation failed on to its error.
+type Errors map[string]error
+
+func (e Errors) Error() string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	msgs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", id, e[id]))
+	}
+	return fmt.Sprintf("%d VMs failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// ForEach runs fn on every VM matching the filter, on at most the configured
+// number of VMs at the same time. It returns Errors if fn failed on any VM.
+// Once ctx is done, fn is not run on the remaining VMs and ctx.Err() is
+// reported for them.
+func (m *Manager) ForEach(ctx context.Context, filter Filter, fn func(context.Context, *VM) error) error {
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs = Errors{}
+		sem  = make(chan struct{}, m.parallelism)
+	)
+
+	setErr := func(vm *VM, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs[vm.id] = err
+	}
+
+	for _, vm := range m.List(filter) {
+		if err := ctx.Err(); err != nil {
+			setErr(vm, err)
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			setErr(vm, ctx.Err())
+			continue
+		}
+
+		wg.Add(1)
+		go func(vm *VM) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := fn(ctx, vm); err != nil {
+				m.logger.WithField("vmid", vm.id).WithError(err).Warn("bulk operation failed")
+				setErr(vm, err)
+			}
+		}(vm)
+	}
+	wg.Wait()
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// PauseAll pauses the VMs matching the filter.
+func (m *Manager) PauseAll(ctx context.Context, filter Filter) error {
+	return m.ForEach(ctx, filter, func(ctx context.Context, vm *VM) error {
+		return vm.Machine.PauseVM(ctx)
+	})
+}
+
+// ResumeAll resumes the VMs matching the filter.
+func (m *Manager) ResumeAll(ctx context.Context, filter Filter) error {
+	return m.ForEach(ctx, filter, func(ctx context.Context, vm *VM) error {
+		return vm.Machine.ResumeVM(ctx)
+	})
+}
+
+// SnapshotPaths returns where the memory file and the snapshot of a VM are
+// written.
+type SnapshotPaths func(vm *VM) (memFilePath, snapshotPath string)
+
+// SnapshotAll creates a snapshot of each VM matching the filter. Running VMs
+// are paused for the snapshot and resumed afterwards.
+func (m *Manager) SnapshotAll(ctx context.Context, filter Filter, paths SnapshotPaths, opts ...firecracker.CreateSnapshotOpt) error {
+	return m.ForEach(ctx, filter, func(ctx context.Context, vm *VM) error {
+		wasRunning := vm.Machine.State() == firecracker.StateRunning
+		if wasRunning {
+			if err := vm.Machine.PauseVM(ctx); err != nil {
+				return err
+			}
+		}
+
+		memFilePath, snapshotPath := paths(vm)
+		err := vm.Machine.CreateSnapshot(ctx, memFilePath, snapshotPath, opts...)
+
+		if wasRunning {
+			if resumeErr := vm.Machine.ResumeVM(ctx); resumeErr != nil && err == nil {
+				err = resumeErr
+			}
+		}
+		return err
+	})
+}
+
+// ShutdownAll stops the VMs matching the filter with
+// Machine.ShutdownWithPolicy.
+func (m *Manager) ShutdownAll(ctx context.Context, filter Filter, policy firecracker.ShutdownPolicy) error {
+	return m.ForEach(ctx, filter, func(ctx context.Context, vm *VM) error {
+		_, err := vm.Machine.ShutdownWithPolicy(ctx, policy)
+		return err
+	})
+}
@@ -0,0 +1,206 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+func createVM(t *testing.T, mgr *Manager, vmid string, labels map[string]string, client *fctesting.MockClient) *VM {
+	t.Helper()
+
+	vm, err := mgr.Create(context.Background(),
+		firecracker.Config{VMID: vmid, DisableValidation: true},
+		labels,
+		firecracker.WithClient(firecracker.NewClient("/path/to/socket", nil, false, firecracker.WithOpsClient(client))),
+		firecracker.WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+	return vm
+}
+
+func ids(vms []*VM) []string {
+	var ids []string
+	for _, vm := range vms {
+		ids = append(ids, vm.ID())
+	}
+	return ids
+}
+
+func TestRegistry(t *testing.T) {
+	mgr := New()
+	client := &fctesting.MockClient{}
+
+	createVM(t, mgr, "b", map[string]string{"tenant": "x"}, client)
+	vm := createVM(t, mgr, "a", map[string]string{"tenant": "y"}, client)
+
+	_, err := mgr.Create(context.Background(), firecracker.Config{VMID: "a", DisableValidation: true}, nil)
+	assert.True(t, errors.Is(err, ErrExists))
+
+	got, ok := mgr.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, vm, got)
+
+	assert.Equal(t, []string{"a", "b"}, ids(mgr.List(nil)))
+	assert.Equal(t, []string{"b"}, ids(mgr.List(WithLabels(map[string]string{"tenant": "x"}))))
+
+	vm.SetLabel("tenant", "x")
+	assert.Equal(t, []string{"a", "b"}, ids(mgr.List(WithLabels(map[string]string{"tenant": "x"}))))
+	assert.Equal(t, map[string]string{"tenant": "x"}, vm.Labels())
+
+	assert.True(t, mgr.Remove("a"))
+	assert.False(t, mgr.Remove("a"))
+	_, ok = mgr.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, []string{"b"}, ids(mgr.List(nil)))
+}
+
+func TestPauseAllParallelism(t *testing.T) {
+	const parallelism = 2
+
+	var running, maxRunning int32
+	client := &fctesting.MockClient{
+		PatchVMFn: func(params *ops.PatchVMParams) (*ops.PatchVMNoContent, error) {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				max := atomic.LoadInt32(&maxRunning)
+				if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			return &ops.PatchVMNoContent{}, nil
+		},
+	}
+
+	mgr := New(WithParallelism(parallelism))
+	for i := 0; i < 6; i++ {
+		createVM(t, mgr, fmt.Sprintf("vm-%d", i), nil, client)
+	}
+
+	require.NoError(t, mgr.PauseAll(context.Background(), nil))
+	assert.Equal(t, int32(parallelism), atomic.LoadInt32(&maxRunning))
+	assert.Len(t, mgr.List(InState(firecracker.StatePaused)), 6)
+}
+
+func TestBulkErrors(t *testing.T) {
+	mgr := New()
+	createVM(t, mgr, "ok", nil, &fctesting.MockClient{})
+	createVM(t, mgr, "broken", nil, &fctesting.MockClient{
+		PatchVMFn: func(params *ops.PatchVMParams) (*ops.PatchVMNoContent, error) {
+			return nil, assert.AnError
+		},
+	})
+
+	err := mgr.PauseAll(context.Background(), nil)
+	var errs Errors
+	require.True(t, errors.As(err, &errs))
+	require.Len(t, errs, 1)
+	assert.True(t, errors.Is(errs["broken"], assert.AnError))
+	assert.Contains(t, err.Error(), "broken")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = mgr.ResumeAll(ctx, nil)
+	require.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 2)
+}
+
+func TestSnapshotAll(t *testing.T) {
+	var states []string
+	client := &fctesting.MockClient{
+		PatchVMFn: func(params *ops.PatchVMParams) (*ops.PatchVMNoContent, error) {
+			states = append(states, firecracker.StringValue(params.Body.State))
+			return &ops.PatchVMNoContent{}, nil
+		},
+		CreateSnapshotFn: func(params *ops.CreateSnapshotParams) (*ops.CreateSnapshotNoContent, error) {
+			assert.Equal(t, "/snapshots/vm.mem", firecracker.StringValue(params.Body.MemFilePath))
+			assert.Equal(t, "/snapshots/vm.snap", firecracker.StringValue(params.Body.SnapshotPath))
+			return &ops.CreateSnapshotNoContent{}, nil
+		},
+	}
+
+	mgr := New()
+	vm := createVM(t, mgr, "vm", nil, client)
+	require.NoError(t, vm.Machine.ResumeVM(context.Background()))
+	states = nil
+
+	err := mgr.SnapshotAll(context.Background(), nil, func(vm *VM) (string, string) {
+		return "/snapshots/" + vm.ID() + ".mem", "/snapshots/" + vm.ID() + ".snap"
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{models.VMStatePaused, models.VMStateResumed}, states)
+}
+
+func TestRemoveOnExit(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "fc.sock")
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	mgr := New()
+	vm, err := mgr.Create(context.Background(),
+		firecracker.Config{VMID: "vm", SocketPath: socketPath, DisableValidation: true},
+		nil,
+		firecracker.WithClient(firecracker.NewClient(socketPath, nil, false, firecracker.WithOpsClient(&fctesting.MockClient{}))),
+		firecracker.WithProcessRunner(exec.Command("sleep", "60")),
+		firecracker.WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+	vm.Machine.Handlers.FcInit = firecracker.HandlerList{}.Append(firecracker.StartVMMHandler)
+
+	require.NoError(t, vm.Machine.Start(context.Background()))
+	require.NoError(t, mgr.ShutdownAll(context.Background(), nil, firecracker.ShutdownPolicy{TermTimeout: 5 * time.Second}))
+
+	assert.Eventually(t, func() bool {
+		_, ok := mgr.Get("vm")
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRemoveOnFailedStart(t *testing.T) {
+	mgr := New()
+	vm, err := mgr.Create(context.Background(),
+		firecracker.Config{VMID: "vm", SocketPath: filepath.Join(t.TempDir(), "fc.sock")},
+		nil,
+		firecracker.WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+
+	// the configuration lacks a kernel image, no VMM is started
+	require.Error(t, vm.Machine.Start(context.Background()))
+	assert.Equal(t, firecracker.StateFailed, vm.Machine.State())
+
+	assert.Eventually(t, func() bool {
+		_, ok := mgr.Get("vm")
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+}
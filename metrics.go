@@ -0,0 +1,208 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	"github.com/firecracker-microvm/firecracker-go-sdk/metrics"
+)
+
+// metricsStream reads the metrics written to MetricsFifo and fans them out to
+// the channels returned by Metrics. The FIFO is only read once Metrics is
+// called, so that it can be read by someone else otherwise.
+type metricsStream struct {
+	mu sync.Mutex
+	// fifoPath is the path of the FIFO on the host, set once it was created
+	fifoPath string
+	// capturing is set once the FIFO is read
+	capturing bool
+	// closed is set once the FIFO is no longer read
+	closed      bool
+	subscribers map[chan *metrics.FirecrackerMetrics]chan struct{}
+
+	vmID   string
+	logger *log.Entry
+	// partial is the unterminated line read so far
+	partial []byte
+}
+
+// Metrics returns a channel receiving the metrics Firecracker writes to
+// MetricsFifo, every minute and whenever FlushMetrics is called, with VMID
+// set to the ID of the Machine. The channel is closed when ctx is done or
+// when the VMM exits. It is closed immediately if MetricsFifo is not set.
+//
+// Metrics may be called before Start. The first call makes the SDK the reader
+// of the FIFO, which must then not be read by anyone else.
+//
+// Samples are buffered per subscriber; a subscriber that does not keep up will
+// miss samples rather than block Firecracker. Samples are shared between the
+// subscribers and must not be modified.
+func (m *Machine) Metrics(ctx context.Context) <-chan *metrics.FirecrackerMetrics {
+	ch := make(chan *metrics.FirecrackerMetrics, subscriberBufferSize)
+
+	s := &m.metrics
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m.Cfg.MetricsFifo == "" || s.closed {
+		close(ch)
+		return ch
+	}
+
+	if s.subscribers == nil {
+		s.subscribers = make(map[chan *metrics.FirecrackerMetrics]chan struct{})
+	}
+	done := make(chan struct{})
+	s.subscribers[ch] = done
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// the subscriber may already have been closed with the FIFO
+		if _, ok := s.subscribers[ch]; ok {
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}()
+
+	if s.fifoPath != "" && !s.capturing {
+		m.captureMetrics(context.Background())
+	}
+	return ch
+}
+
+// metricsFifoCreated records that MetricsFifo was created, and starts reading
+// it if Metrics was already called.
+func (m *Machine) metricsFifoCreated(ctx context.Context) {
+	s := &m.metrics
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the jailer later rewrites MetricsFifo relative to the chroot
+	s.fifoPath = m.Cfg.MetricsFifo
+	if len(s.subscribers) > 0 {
+		m.captureMetrics(ctx)
+	}
+}
+
+// captureMetrics starts reading the metrics FIFO. It must be called with the
+// lock of the stream held.
+func (m *Machine) captureMetrics(ctx context.Context) {
+	s := &m.metrics
+	s.capturing = true
+	s.vmID = m.Cfg.VMID
+	s.logger = m.logger
+
+	done := make(chan error, 1)
+	if err := m.captureFifoToFileWithChannel(ctx, m.logger, s.fifoPath, s, done); err != nil {
+		m.logger.Warnf("captureFifoToFile() returned %s. Metrics will not be streamed.", err)
+		s.close()
+		return
+	}
+
+	go func() {
+		for range done {
+		}
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.close()
+	}()
+}
+
+// Write parses the metrics read from the FIFO and sends them to the
+// subscribers.
+func (s *metricsStream) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		s.publish(data[:i])
+		data = data[i+1:]
+	}
+	s.partial = append([]byte(nil), data...)
+
+	return len(p), nil
+}
+
+// publish sends a line of metrics to the subscribers.
+func (s *metricsStream) publish(line []byte) {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
+	}
+
+	sample, err := metrics.Parse(line)
+	if err != nil {
+		s.logger.WithError(err).Warn("failed to parse the metrics")
+		return
+	}
+	sample.VMID = s.vmID
+
+	for ch := range s.subscribers {
+		select {
+		case ch <- sample:
+		default:
+			s.logger.Warn("dropping metrics for slow subscriber")
+		}
+	}
+}
+
+// close closes the channels of all the subscribers. It must be called with
+// the lock of the stream held.
+func (s *metricsStream) close() {
+	s.closed = true
+	for ch, done := range s.subscribers {
+		close(ch)
+		close(done)
+	}
+	s.subscribers = nil
+}
+
+// FlushMetrics makes Firecracker write its metrics immediately, rather than
+// at the next minute. They can be read with Metrics.
+func (m *Machine) FlushMetrics(ctx context.Context) (err error) {
+	ctx, span := m.startSpan(ctx, "firecracker.FlushMetrics")
+	defer func() { endSpan(span, err) }()
+
+	action := models.InstanceActionInfoActionTypeFlushMetrics
+	info := models.InstanceActionInfo{
+		ActionType: &action,
+	}
+
+	if _, err := m.client.CreateSyncAction(ctx, &info); err != nil {
+		m.logger.Errorf("failed to flush the metrics: %v", err)
+		return err
+	}
+
+	m.logger.Debug("metrics flushed successfully")
+	return nil
+}
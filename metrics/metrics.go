@@ -0,0 +1,420 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package metrics parses the metrics Firecracker writes to its metrics file or
+// FIFO, one JSON object per line, every minute and whenever a FlushMetrics
+// action is sent to the API.
+//
+// Most metrics are counters, which hold the increments since the previous
+// sample, since Firecracker resets them whenever it writes the metrics.
+// Metrics unknown to the installed version of Firecracker are left to 0.
+package metrics
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	// blockDevicePrefix prefixes the metrics of every drive.
+	blockDevicePrefix = "block_"
+	// netDevicePrefix prefixes the metrics of every network interface.
+	netDevicePrefix = "net_"
+)
+
+// FirecrackerMetrics is a sample of the metrics of a Firecracker process.
+type FirecrackerMetrics struct {
+	// VMID is the ID of the VM the sample is of. It is not written by
+	// Firecracker, but set by the SDK.
+	VMID string `json:"-"`
+	// UTCTimestampMs is when the sample was written, in milliseconds since
+	// the epoch.
+	UTCTimestampMs int64 `json:"utc_timestamp_ms"`
+
+	APIServer        APIServerMetrics     `json:"api_server"`
+	Balloon          BalloonMetrics       `json:"balloon"`
+	DeprecatedAPI    DeprecatedAPIMetrics `json:"deprecated_api"`
+	GetAPIRequests   GetRequestsMetrics   `json:"get_api_requests"`
+	PutAPIRequests   PutRequestsMetrics   `json:"put_api_requests"`
+	PatchAPIRequests PatchRequestsMetrics `json:"patch_api_requests"`
+	I8042            I8042Metrics         `json:"i8042"`
+	Latencies        LatencyMetrics       `json:"latencies_us"`
+	Logger           LoggerMetrics        `json:"logger"`
+	MMDS             MMDSMetrics          `json:"mmds"`
+	RTC              RTCMetrics           `json:"rtc"`
+	Seccomp          SeccompMetrics       `json:"seccomp"`
+	Signals          SignalMetrics        `json:"signals"`
+	UART             SerialMetrics        `json:"uart"`
+	VCPU             VCPUMetrics          `json:"vcpu"`
+	VMM              VMMMetrics           `json:"vmm"`
+	Vsock            VsockMetrics         `json:"vsock"`
+	Entropy          EntropyMetrics       `json:"entropy"`
+
+	// Block aggregates the metrics of all the drives.
+	Block BlockDeviceMetrics `json:"block"`
+	// Drives are the metrics of every drive, by drive ID. They are only
+	// written by Firecracker v1.5 and later.
+	Drives map[string]BlockDeviceMetrics `json:"-"`
+	// Net aggregates the metrics of all the network interfaces.
+	Net NetDeviceMetrics `json:"net"`
+	// NetworkInterfaces are the metrics of every network interface, by
+	// interface ID. They are only written by Firecracker v1.5 and later.
+	NetworkInterfaces map[string]NetDeviceMetrics `json:"-"`
+}
+
+// Time returns when the sample was written.
+func (m *FirecrackerMetrics) Time() time.Time {
+	return time.UnixMilli(m.UTCTimestampMs)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, collecting the metrics of every
+// drive and network interface.
+func (m *FirecrackerMetrics) UnmarshalJSON(data []byte) error {
+	type plain FirecrackerMetrics
+	if err := json.Unmarshal(data, (*plain)(m)); err != nil {
+		return err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	for key, value := range fields {
+		switch {
+		case strings.HasPrefix(key, blockDevicePrefix):
+			var device BlockDeviceMetrics
+			if err := json.Unmarshal(value, &device); err != nil {
+				return fmt.Errorf("invalid metrics of %s: %w", key, err)
+			}
+			if m.Drives == nil {
+				m.Drives = make(map[string]BlockDeviceMetrics)
+			}
+			m.Drives[strings.TrimPrefix(key, blockDevicePrefix)] = device
+		case strings.HasPrefix(key, netDevicePrefix):
+			var device NetDeviceMetrics
+			if err := json.Unmarshal(value, &device); err != nil {
+				return fmt.Errorf("invalid metrics of %s: %w", key, err)
+			}
+			if m.NetworkInterfaces == nil {
+				m.NetworkInterfaces = make(map[string]NetDeviceMetrics)
+			}
+			m.NetworkInterfaces[strings.TrimPrefix(key, netDevicePrefix)] = device
+		}
+	}
+	return nil
+}
+
+// APIServerMetrics are the metrics of the API server.
+type APIServerMetrics struct {
+	// ProcessStartupTimeUs is the time it took Firecracker to start serving
+	// the API, in microseconds.
+	ProcessStartupTimeUs uint64 `json:"process_startup_time_us"`
+	// ProcessStartupTimeCPUUs is the CPU time it took Firecracker to start
+	// serving the API, in microseconds.
+	ProcessStartupTimeCPUUs uint64 `json:"process_startup_time_cpu_us"`
+	SyncResponseFails       uint64 `json:"sync_response_fails"`
+	SyncVMMSendTimeoutCount uint64 `json:"sync_vmm_send_timeout_count"`
+}
+
+// BalloonMetrics are the metrics of the balloon device.
+type BalloonMetrics struct {
+	ActivateFails     uint64 `json:"activate_fails"`
+	InflateCount      uint64 `json:"inflate_count"`
+	DeflateCount      uint64 `json:"deflate_count"`
+	StatsUpdatesCount uint64 `json:"stats_updates_count"`
+	StatsUpdateFails  uint64 `json:"stats_update_fails"`
+	EventFails        uint64 `json:"event_fails"`
+}
+
+// BlockDeviceMetrics are the metrics of a drive, or of all the drives.
+type BlockDeviceMetrics struct {
+	ActivateFails              uint64 `json:"activate_fails"`
+	CfgFails                   uint64 `json:"cfg_fails"`
+	NoAvailBuffer              uint64 `json:"no_avail_buffer"`
+	EventFails                 uint64 `json:"event_fails"`
+	ExecuteFails               uint64 `json:"execute_fails"`
+	InvalidReqsCount           uint64 `json:"invalid_reqs_count"`
+	FlushCount                 uint64 `json:"flush_count"`
+	QueueEventCount            uint64 `json:"queue_event_count"`
+	RateLimiterEventCount      uint64 `json:"rate_limiter_event_count"`
+	UpdateCount                uint64 `json:"update_count"`
+	UpdateFails                uint64 `json:"update_fails"`
+	ReadBytes                  uint64 `json:"read_bytes"`
+	WriteBytes                 uint64 `json:"write_bytes"`
+	ReadCount                  uint64 `json:"read_count"`
+	WriteCount                 uint64 `json:"write_count"`
+	RateLimiterThrottledEvents uint64 `json:"rate_limiter_throttled_events"`
+	IOEngineThrottledEvents    uint64 `json:"io_engine_throttled_events"`
+}
+
+// DeprecatedAPIMetrics count the uses of deprecated APIs.
+type DeprecatedAPIMetrics struct {
+	DeprecatedHTTPAPICalls    uint64 `json:"deprecated_http_api_calls"`
+	DeprecatedCmdLineAPICalls uint64 `json:"deprecated_cmd_line_api_calls"`
+}
+
+// GetRequestsMetrics count the GET requests to the API.
+type GetRequestsMetrics struct {
+	InstanceInfoCount uint64 `json:"instance_info_count"`
+	MachineCfgCount   uint64 `json:"machine_cfg_count"`
+	MMDSCount         uint64 `json:"mmds_count"`
+	VMMVersionCount   uint64 `json:"vmm_version_count"`
+}
+
+// PutRequestsMetrics count the PUT requests to the API, and their failures.
+type PutRequestsMetrics struct {
+	ActionsCount    uint64 `json:"actions_count"`
+	ActionsFails    uint64 `json:"actions_fails"`
+	BootSourceCount uint64 `json:"boot_source_count"`
+	BootSourceFails uint64 `json:"boot_source_fails"`
+	DriveCount      uint64 `json:"drive_count"`
+	DriveFails      uint64 `json:"drive_fails"`
+	LoggerCount     uint64 `json:"logger_count"`
+	LoggerFails     uint64 `json:"logger_fails"`
+	MachineCfgCount uint64 `json:"machine_cfg_count"`
+	MachineCfgFails uint64 `json:"machine_cfg_fails"`
+	CPUCfgCount     uint64 `json:"cpu_cfg_count"`
+	CPUCfgFails     uint64 `json:"cpu_cfg_fails"`
+	MetricsCount    uint64 `json:"metrics_count"`
+	MetricsFails    uint64 `json:"metrics_fails"`
+	NetworkCount    uint64 `json:"network_count"`
+	NetworkFails    uint64 `json:"network_fails"`
+	MMDSCount       uint64 `json:"mmds_count"`
+	MMDSFails       uint64 `json:"mmds_fails"`
+	VsockCount      uint64 `json:"vsock_count"`
+	VsockFails      uint64 `json:"vsock_fails"`
+}
+
+// PatchRequestsMetrics count the PATCH requests to the API, and their
+// failures.
+type PatchRequestsMetrics struct {
+	DriveCount      uint64 `json:"drive_count"`
+	DriveFails      uint64 `json:"drive_fails"`
+	NetworkCount    uint64 `json:"network_count"`
+	NetworkFails    uint64 `json:"network_fails"`
+	MachineCfgCount uint64 `json:"machine_cfg_count"`
+	MachineCfgFails uint64 `json:"machine_cfg_fails"`
+	MMDSCount       uint64 `json:"mmds_count"`
+	MMDSFails       uint64 `json:"mmds_fails"`
+}
+
+// I8042Metrics are the metrics of the i8042 keyboard controller.
+type I8042Metrics struct {
+	ErrorCount       uint64 `json:"error_count"`
+	MissedReadCount  uint64 `json:"missed_read_count"`
+	MissedWriteCount uint64 `json:"missed_write_count"`
+	ReadCount        uint64 `json:"read_count"`
+	ResetCount       uint64 `json:"reset_count"`
+	WriteCount       uint64 `json:"write_count"`
+}
+
+// LatencyMetrics are the durations of the last operations of each kind, in
+// microseconds. The vmm_ ones exclude the time spent in the API thread.
+type LatencyMetrics struct {
+	FullCreateSnapshot    uint64 `json:"full_create_snapshot"`
+	DiffCreateSnapshot    uint64 `json:"diff_create_snapshot"`
+	LoadSnapshot          uint64 `json:"load_snapshot"`
+	PauseVM               uint64 `json:"pause_vm"`
+	ResumeVM              uint64 `json:"resume_vm"`
+	VMMFullCreateSnapshot uint64 `json:"vmm_full_create_snapshot"`
+	VMMDiffCreateSnapshot uint64 `json:"vmm_diff_create_snapshot"`
+	VMMLoadSnapshot       uint64 `json:"vmm_load_snapshot"`
+	VMMPauseVM            uint64 `json:"vmm_pause_vm"`
+	VMMResumeVM           uint64 `json:"vmm_resume_vm"`
+}
+
+// LoggerMetrics are the metrics of the logging and metrics systems.
+type LoggerMetrics struct {
+	MissedMetricsCount uint64 `json:"missed_metrics_count"`
+	MetricsFails       uint64 `json:"metrics_fails"`
+	MissedLogCount     uint64 `json:"missed_log_count"`
+	LogFails           uint64 `json:"log_fails"`
+}
+
+// MMDSMetrics are the metrics of the microVM metadata service.
+type MMDSMetrics struct {
+	RxAccepted           uint64 `json:"rx_accepted"`
+	RxAcceptedErr        uint64 `json:"rx_accepted_err"`
+	RxAcceptedUnusual    uint64 `json:"rx_accepted_unusual"`
+	RxBadEth             uint64 `json:"rx_bad_eth"`
+	RxInvalidToken       uint64 `json:"rx_invalid_token"`
+	RxNoToken            uint64 `json:"rx_no_token"`
+	RxCount              uint64 `json:"rx_count"`
+	TxBytes              uint64 `json:"tx_bytes"`
+	TxCount              uint64 `json:"tx_count"`
+	TxErrors             uint64 `json:"tx_errors"`
+	TxFrames             uint64 `json:"tx_frames"`
+	ConnectionsCreated   uint64 `json:"connections_created"`
+	ConnectionsDestroyed uint64 `json:"connections_destroyed"`
+}
+
+// NetDeviceMetrics are the metrics of a network interface, or of all the
+// network interfaces.
+type NetDeviceMetrics struct {
+	ActivateFails           uint64 `json:"activate_fails"`
+	CfgFails                uint64 `json:"cfg_fails"`
+	MACAddressUpdates       uint64 `json:"mac_address_updates"`
+	NoRxAvailBuffer         uint64 `json:"no_rx_avail_buffer"`
+	NoTxAvailBuffer         uint64 `json:"no_tx_avail_buffer"`
+	EventFails              uint64 `json:"event_fails"`
+	RxQueueEventCount       uint64 `json:"rx_queue_event_count"`
+	RxEventRateLimiterCount uint64 `json:"rx_event_rate_limiter_count"`
+	RxPartialWrites         uint64 `json:"rx_partial_writes"`
+	RxRateLimiterThrottled  uint64 `json:"rx_rate_limiter_throttled"`
+	RxTapEventCount         uint64 `json:"rx_tap_event_count"`
+	RxBytesCount            uint64 `json:"rx_bytes_count"`
+	RxPacketsCount          uint64 `json:"rx_packets_count"`
+	RxFails                 uint64 `json:"rx_fails"`
+	RxCount                 uint64 `json:"rx_count"`
+	TapReadFails            uint64 `json:"tap_read_fails"`
+	TapWriteFails           uint64 `json:"tap_write_fails"`
+	TxBytesCount            uint64 `json:"tx_bytes_count"`
+	TxMalformedFrames       uint64 `json:"tx_malformed_frames"`
+	TxFails                 uint64 `json:"tx_fails"`
+	TxCount                 uint64 `json:"tx_count"`
+	TxPacketsCount          uint64 `json:"tx_packets_count"`
+	TxPartialReads          uint64 `json:"tx_partial_reads"`
+	TxQueueEventCount       uint64 `json:"tx_queue_event_count"`
+	TxRateLimiterEventCount uint64 `json:"tx_rate_limiter_event_count"`
+	TxRateLimiterThrottled  uint64 `json:"tx_rate_limiter_throttled"`
+	TxSpoofedMACCount       uint64 `json:"tx_spoofed_mac_count"`
+}
+
+// RTCMetrics are the metrics of the real-time clock, only present on aarch64.
+type RTCMetrics struct {
+	ErrorCount       uint64 `json:"error_count"`
+	MissedReadCount  uint64 `json:"missed_read_count"`
+	MissedWriteCount uint64 `json:"missed_write_count"`
+}
+
+// SeccompMetrics are the metrics of the seccomp filters.
+type SeccompMetrics struct {
+	// NumFaults is the number of syscalls denied by the filters.
+	NumFaults uint64 `json:"num_faults"`
+}
+
+// SignalMetrics count the signals received by Firecracker.
+type SignalMetrics struct {
+	SIGBUS  uint64 `json:"sigbus"`
+	SIGSEGV uint64 `json:"sigsegv"`
+	SIGXFSZ uint64 `json:"sigxfsz"`
+	SIGXCPU uint64 `json:"sigxcpu"`
+	SIGPIPE uint64 `json:"sigpipe"`
+	SIGHUP  uint64 `json:"sighup"`
+	SIGILL  uint64 `json:"sigill"`
+}
+
+// SerialMetrics are the metrics of the serial console.
+type SerialMetrics struct {
+	ErrorCount       uint64 `json:"error_count"`
+	FlushCount       uint64 `json:"flush_count"`
+	MissedReadCount  uint64 `json:"missed_read_count"`
+	MissedWriteCount uint64 `json:"missed_write_count"`
+	ReadCount        uint64 `json:"read_count"`
+	WriteCount       uint64 `json:"write_count"`
+}
+
+// VCPUMetrics count the exits of the vCPUs.
+type VCPUMetrics struct {
+	ExitIOIn      uint64 `json:"exit_io_in"`
+	ExitIOOut     uint64 `json:"exit_io_out"`
+	ExitMMIORead  uint64 `json:"exit_mmio_read"`
+	ExitMMIOWrite uint64 `json:"exit_mmio_write"`
+	Failures      uint64 `json:"failures"`
+	FilterCPUID   uint64 `json:"filter_cpuid"`
+}
+
+// VMMMetrics are the metrics of the VMM thread.
+type VMMMetrics struct {
+	DeviceEvents uint64 `json:"device_events"`
+	PanicCount   uint64 `json:"panic_count"`
+}
+
+// VsockMetrics are the metrics of the vsock device.
+type VsockMetrics struct {
+	ActivateFails     uint64 `json:"activate_fails"`
+	CfgFails          uint64 `json:"cfg_fails"`
+	RxQueueEventFails uint64 `json:"rx_queue_event_fails"`
+	TxQueueEventFails uint64 `json:"tx_queue_event_fails"`
+	EvQueueEventFails uint64 `json:"ev_queue_event_fails"`
+	MuxerEventFails   uint64 `json:"muxer_event_fails"`
+	ConnEventFails    uint64 `json:"conn_event_fails"`
+	RxQueueEventCount uint64 `json:"rx_queue_event_count"`
+	TxQueueEventCount uint64 `json:"tx_queue_event_count"`
+	RxBytesCount      uint64 `json:"rx_bytes_count"`
+	TxBytesCount      uint64 `json:"tx_bytes_count"`
+	RxPacketsCount    uint64 `json:"rx_packets_count"`
+	TxPacketsCount    uint64 `json:"tx_packets_count"`
+	ConnsAdded        uint64 `json:"conns_added"`
+	ConnsKilled       uint64 `json:"conns_killed"`
+	ConnsRemoved      uint64 `json:"conns_removed"`
+	KillqResync       uint64 `json:"killq_resync"`
+	TxFlushFails      uint64 `json:"tx_flush_fails"`
+	TxWriteFails      uint64 `json:"tx_write_fails"`
+	RxReadFails       uint64 `json:"rx_read_fails"`
+}
+
+// EntropyMetrics are the metrics of the entropy device.
+type EntropyMetrics struct {
+	ActivateFails               uint64 `json:"activate_fails"`
+	EntropyEventFails           uint64 `json:"entropy_event_fails"`
+	EntropyEventCount           uint64 `json:"entropy_event_count"`
+	EntropyBytes                uint64 `json:"entropy_bytes"`
+	HostRNGFails                uint64 `json:"host_rng_fails"`
+	EntropyRateLimiterThrottled uint64 `json:"entropy_rate_limiter_throttled"`
+	RateLimiterEventCount       uint64 `json:"rate_limiter_event_count"`
+}
+
+// Parse parses a line of metrics written by Firecracker.
+func Parse(data []byte) (*FirecrackerMetrics, error) {
+	var m FirecrackerMetrics
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid metrics: %w", err)
+	}
+	return &m, nil
+}
+
+// Decoder reads the metrics written by Firecracker from a stream, such as
+// the metrics FIFO.
+type Decoder struct {
+	scanner *bufio.Scanner
+}
+
+// NewDecoder returns a Decoder reading from r.
+func NewDecoder(r io.Reader) *Decoder {
+	scanner := bufio.NewScanner(r)
+	// a sample of a VM with many devices may exceed the default of 64KiB
+	scanner.Buffer(nil, 1024*1024)
+	return &Decoder{scanner: scanner}
+}
+
+// Decode returns the next sample, or io.EOF at the end of the stream. A line
+// which cannot be parsed is returned as an error, after which Decode may be
+// called again to read the following lines.
+func (d *Decoder) Decode() (*FirecrackerMetrics, error) {
+	for d.scanner.Scan() {
+		line := d.scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+		return Parse(line)
+	}
+	if err := d.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
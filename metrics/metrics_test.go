@@ -0,0 +1,89 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metrics
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSample = `{"utc_timestamp_ms":1700000000123,` +
+	`"api_server":{"process_startup_time_us":1250,"process_startup_time_cpu_us":900,"sync_response_fails":0,"sync_vmm_send_timeout_count":0},` +
+	`"block":{"read_bytes":8192,"write_bytes":4096,"read_count":2,"write_count":1,"flush_count":1},` +
+	`"block_rootfs":{"read_bytes":8192,"read_count":2},` +
+	`"block_data":{"write_bytes":4096,"write_count":1,"flush_count":1},` +
+	`"net":{"rx_bytes_count":1500,"tx_bytes_count":600,"rx_packets_count":1,"tx_packets_count":1},` +
+	`"net_eth0":{"rx_bytes_count":1500,"tx_bytes_count":600,"rx_packets_count":1,"tx_packets_count":1},` +
+	`"put_api_requests":{"actions_count":1,"drive_count":2,"machine_cfg_count":1},` +
+	`"seccomp":{"num_faults":0},` +
+	`"vcpu":{"exit_io_in":12,"exit_io_out":340,"exit_mmio_read":5,"exit_mmio_write":7,"failures":0},` +
+	`"vmm":{"device_events":42,"panic_count":0},` +
+	`"signals":{"sigbus":0,"sigsegv":0},` +
+	`"latencies_us":{"pause_vm":150,"vmm_pause_vm":120},` +
+	`"unknown_component":{"new_counter":1}}`
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(testSample))
+	require.NoError(t, err)
+
+	assert.Equal(t, time.UnixMilli(1700000000123), m.Time())
+	assert.Equal(t, uint64(1250), m.APIServer.ProcessStartupTimeUs)
+	assert.Equal(t, uint64(8192), m.Block.ReadBytes)
+	assert.Equal(t, uint64(2), m.PutAPIRequests.DriveCount)
+	assert.Equal(t, uint64(340), m.VCPU.ExitIOOut)
+	assert.Equal(t, uint64(42), m.VMM.DeviceEvents)
+	assert.Equal(t, uint64(120), m.Latencies.VMMPauseVM)
+	assert.Empty(t, m.VMID)
+
+	assert.Equal(t, map[string]BlockDeviceMetrics{
+		"rootfs": {ReadBytes: 8192, ReadCount: 2},
+		"data":   {WriteBytes: 4096, WriteCount: 1, FlushCount: 1},
+	}, m.Drives)
+	assert.Equal(t, map[string]NetDeviceMetrics{
+		"eth0": {RxBytesCount: 1500, TxBytesCount: 600, RxPacketsCount: 1, TxPacketsCount: 1},
+	}, m.NetworkInterfaces)
+
+	_, err = Parse([]byte(`{"block_rootfs":{"read_bytes":"many"}}`))
+	assert.Error(t, err)
+	_, err = Parse([]byte(`Flushing metrics`))
+	assert.Error(t, err)
+}
+
+func TestDecoder(t *testing.T) {
+	stream := testSample + "\n\n" +
+		`not metrics` + "\n" +
+		`{"utc_timestamp_ms":1700000060123,"vmm":{"device_events":3}}` + "\n"
+	d := NewDecoder(strings.NewReader(stream))
+
+	m, err := d.Decode()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), m.VMM.DeviceEvents)
+
+	// the decoder recovers from an invalid line
+	_, err = d.Decode()
+	assert.Error(t, err)
+
+	m, err = d.Decode()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), m.VMM.DeviceEvents)
+	assert.Nil(t, m.Drives)
+
+	_, err = d.Decode()
+	assert.Equal(t, io.EOF, err)
+}
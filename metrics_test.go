@@ -0,0 +1,137 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+	"github.com/firecracker-microvm/firecracker-go-sdk/metrics"
+)
+
+func receiveMetrics(t *testing.T, ch <-chan *metrics.FirecrackerMetrics) *metrics.FirecrackerMetrics {
+	t.Helper()
+
+	select {
+	case sample, ok := <-ch:
+		require.True(t, ok, "metrics stream closed")
+		return sample
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for metrics")
+	}
+	return nil
+}
+
+func requireMetricsClosed(t *testing.T, ch <-chan *metrics.FirecrackerMetrics) {
+	t.Helper()
+
+	select {
+	case _, ok := <-ch:
+		require.False(t, ok, "expected the metrics stream to be closed")
+	case <-time.After(5 * time.Second):
+		t.Fatal("metrics stream was not closed")
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	dir := t.TempDir()
+	server := fctesting.NewFakeServer(filepath.Join(dir, "fc.sock"))
+	require.NoError(t, server.Start())
+	defer server.Close()
+
+	cfg := Config{
+		VMID:              "test-vm",
+		SocketPath:        server.SocketPath,
+		DisableValidation: true,
+		KernelImagePath:   "/vmlinux",
+		Drives:            NewDrivesBuilder("/rootfs").AddDrive("/data", true).Build(),
+		MetricsFifo:       filepath.Join(dir, "metrics.fifo"),
+		MachineCfg: models.MachineConfiguration{
+			VcpuCount:  Int64(1),
+			MemSizeMib: Int64(128),
+		},
+	}
+	m, err := NewMachine(context.Background(), cfg,
+		WithProcessRunner(exec.Command("sleep", "60")),
+		WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+
+	// subscribing before Start
+	before := m.Metrics(context.Background())
+	require.NoError(t, m.Start(context.Background()))
+	defer m.StopVMM()
+
+	// and after the FIFO is read already
+	ctx, cancel := context.WithCancel(context.Background())
+	after := m.Metrics(ctx)
+
+	require.NoError(t, m.FlushMetrics(context.Background()))
+	for _, ch := range []<-chan *metrics.FirecrackerMetrics{before, after} {
+		sample := receiveMetrics(t, ch)
+		assert.Equal(t, "test-vm", sample.VMID)
+		assert.Equal(t, uint64(2), sample.PutAPIRequests.DriveCount)
+		assert.Equal(t, uint64(1), sample.PutAPIRequests.MetricsCount)
+		assert.Contains(t, sample.Drives, "root_drive")
+		assert.WithinDuration(t, time.Now(), sample.Time(), time.Minute)
+	}
+
+	cancel()
+	requireMetricsClosed(t, after)
+
+	require.NoError(t, m.FlushMetrics(context.Background()))
+	receiveMetrics(t, before)
+
+	require.NoError(t, m.StopVMM())
+	require.Error(t, m.Wait(context.Background()))
+	requireMetricsClosed(t, before)
+	requireMetricsClosed(t, m.Metrics(context.Background()))
+}
+
+func TestMetricsWithoutFifo(t *testing.T) {
+	m, err := NewMachine(context.Background(), Config{DisableValidation: true, MetricsPath: "/tmp/metrics"},
+		WithClient(NewClient("/path/to/socket", nil, false, WithOpsClient(&fctesting.MockClient{}))),
+		WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+
+	requireMetricsClosed(t, m.Metrics(context.Background()))
+}
+
+func TestFlushMetrics(t *testing.T) {
+	var action string
+	client := &fctesting.MockClient{
+		CreateSyncActionFn: func(params *ops.CreateSyncActionParams) (*ops.CreateSyncActionNoContent, error) {
+			action = *params.Info.ActionType
+			return nil, nil
+		},
+	}
+	m, err := NewMachine(context.Background(), Config{DisableValidation: true},
+		WithClient(NewClient("/path/to/socket", nil, false, WithOpsClient(client))),
+		WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, m.FlushMetrics(context.Background()))
+	assert.Equal(t, models.InstanceActionInfoActionTypeFlushMetrics, action)
+}
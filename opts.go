@@ -14,6 +14,7 @@
 package firecracker
 
 import (
+	"context"
 	"os/exec"
 
 	"github.com/firecracker-microvm/firecracker-go-sdk/client/models"
@@ -49,6 +50,28 @@ func WithProcessRunner(cmd *exec.Cmd) Opt {
 	}
 }
 
+// WithLifecycleContext binds the lifetime of the VMM to the given context: the
+// VMM is stopped as with StopVMM once the context is done. By default the VMM
+// runs until it is stopped or the Machine is closed, regardless of the context
+// passed to NewMachine or Start.
+//
+// Note that a command passed to WithProcessRunner that was built with
+// exec.CommandContext is also killed when its own context is done.
+func WithLifecycleContext(ctx context.Context) Opt {
+	return func(machine *Machine) {
+		machine.lifecycleCtx = ctx
+	}
+}
+
+// WithHandlerConcurrency sets how many handlers with DependsOn may run at the
+// same time while the machine starts. A concurrency of 1 runs the handlers one
+// after the other. By default, up to 4 handlers run concurrently.
+func WithHandlerConcurrency(n int) Opt {
+	return func(m *Machine) {
+		m.handlerConcurrency = n
+	}
+}
+
 // WithSnapshotOpt allows configuration of the snapshot config
 // to be passed to LoadSnapshot
 type WithSnapshotOpt func(*SnapshotConfig)
@@ -71,16 +94,25 @@ func WithSnapshot(memFilePath, snapshotPath string, opts ...WithSnapshotOpt) Opt
 			opt(&m.Cfg.Snapshot)
 		}
 
-		m.Handlers.Validation = m.Handlers.Validation.Remove(ValidateCfgHandlerName).Append(LoadSnapshotConfigValidationHandler)
-		m.Handlers.FcInit = modifyHandlersForLoadSnapshot(m.Handlers.FcInit)
+		useLoadSnapshotHandlers(m)
 	}
 }
 
+// useLoadSnapshotHandlers replaces the handlers booting the VM by those
+// loading Cfg.Snapshot. It may be called more than once.
+func useLoadSnapshotHandlers(m *Machine) {
+	m.Handlers.Validation = m.Handlers.Validation.
+		Remove(ValidateCfgHandlerName).
+		Remove(ValidateLoadSnapshotCfgHandlerName).
+		Append(LoadSnapshotConfigValidationHandler)
+	m.Handlers.FcInit = modifyHandlersForLoadSnapshot(m.Handlers.FcInit)
+}
+
 func modifyHandlersForLoadSnapshot(l HandlerList) HandlerList {
 	for _, h := range loadSnapshotRemoveHandlerList {
 		l = l.Remove(h.Name)
 	}
-	l = l.Append(LoadSnapshotHandler)
+	l = l.Remove(LoadSnapshotHandler.Name).Append(LoadSnapshotHandler)
 	return l
 }
 
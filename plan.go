@@ -0,0 +1,209 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+)
+
+// Plan describes what Start would do, see Machine.Plan.
+type Plan struct {
+	// Args is the command line of the VMM, or of the jailer, Start would run.
+	Args []string `json:"args"`
+	// Handlers are the names of the Validation and FcInit handlers, in the
+	// order they would run.
+	Handlers []string `json:"handlers"`
+	// Calls are the requests which would be sent to the Firecracker API, in
+	// order.
+	Calls []PlannedCall `json:"calls"`
+	// ConfigFile is the content of the configuration file of a machine
+	// created with WithConfigFile.
+	ConfigFile json.RawMessage `json:"config_file,omitempty"`
+}
+
+// PlannedCall is a request which Start would send to the Firecracker API.
+type PlannedCall struct {
+	// Handler is the name of the handler sending the request, or empty for
+	// the request starting the VM once the handlers completed.
+	Handler string `json:"handler,omitempty"`
+	// Operation is the name of the API operation, such as PutGuestDriveByID.
+	Operation string `json:"operation"`
+	// Body is the JSON body of the request, if any.
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// planResponses returns the responses of the requests with a payload, which
+// the handlers may read, while planning.
+var planResponses = map[string]func() interface{}{
+	"GetFirecrackerVersion": func() interface{} {
+		return &ops.GetFirecrackerVersionOK{Payload: &models.FirecrackerVersion{FirecrackerVersion: String("")}}
+	},
+	"GetMmds": func() interface{} {
+		return &ops.GetMmdsOK{}
+	},
+	"GetMachineConfiguration": func() interface{} {
+		return &ops.GetMachineConfigurationOK{Payload: &models.MachineConfiguration{}}
+	},
+	"DescribeInstance": func() interface{} {
+		return &ops.DescribeInstanceOK{Payload: &models.InstanceInfo{}}
+	},
+	"DescribeBalloonConfig": func() interface{} {
+		return &ops.DescribeBalloonConfigOK{Payload: &models.Balloon{}}
+	},
+	"DescribeBalloonStats": func() interface{} {
+		return &ops.DescribeBalloonStatsOK{Payload: &models.BalloonStats{}}
+	},
+	"GetExportVMConfig": func() interface{} {
+		return &ops.GetExportVMConfigOK{Payload: &models.FullVMConfiguration{}}
+	},
+}
+
+// Plan runs the Validation and FcInit handlers of the machine without
+// starting a VMM, and returns the command line and the API requests Start
+// would run and send. The handlers run one after the other, so that the plan
+// is the same from one call to the next.
+//
+// The handlers acting on the host, which set up the network, start the VMM,
+// create the log files, link files into the jail, write the configuration
+// file or detect the Firecracker version, are not run: Config.Capabilities is
+// used as it is set, if at all. Network interfaces configured with CNI
+// are planned with a placeholder host device, since CNI is not invoked. Other
+// handlers, such as custom ones, are run as they are: those with side effects
+// should not be added to a machine which is planned. The machine itself is
+// not modified, and can be started afterwards.
+func (m *Machine) Plan(ctx context.Context) (*Plan, error) {
+	plan := &Plan{}
+
+	cfg := m.Cfg
+	cfg.Drives = append([]models.Drive(nil), m.Cfg.Drives...)
+	cfg.NetworkInterfaces = append(NetworkInterfaces(nil), m.Cfg.NetworkInterfaces...)
+	cfg.VsockDevices = append([]VsockDevice(nil), m.Cfg.VsockDevices...)
+
+	cmd := &exec.Cmd{}
+	if m.cmd != nil {
+		cmd = &exec.Cmd{Path: m.cmd.Path, Args: append([]string(nil), m.cmd.Args...)}
+	}
+
+	var handler string
+	client := Client{}
+	if m.client != nil {
+		client = *m.client
+	}
+	client.retryPolicy = nil
+	client.interceptors = []Interceptor{
+		func(ctx context.Context, call *APICall, next APIInvoker) error {
+			planned := PlannedCall{Handler: handler, Operation: call.Operation}
+			if call.Request != nil {
+				body, err := json.Marshal(call.Request)
+				if err != nil {
+					return fmt.Errorf("failed to marshal the body of %s: %w", call.Operation, err)
+				}
+				planned.Body = body
+			}
+			plan.Calls = append(plan.Calls, planned)
+
+			if response, ok := planResponses[call.Operation]; ok {
+				call.Response = response()
+			}
+			return nil
+		},
+	}
+
+	pm := &Machine{
+		Cfg:                cfg,
+		logger:             m.logger,
+		client:             &client,
+		cmd:                cmd,
+		configFile:         m.configFile,
+		lifecycleCtx:       context.Background(),
+		exitCh:             make(chan struct{}),
+		shutdownCh:         make(chan struct{}),
+		cleanupCh:          make(chan struct{}),
+		handlerConcurrency: 1,
+	}
+	pm.Handlers = Handlers{
+		Validation: planHandlerList(m.Handlers.Validation, plan, &handler),
+		FcInit:     planHandlerList(m.Handlers.FcInit, plan, &handler),
+	}
+	defer pm.doCleanup()
+
+	if err := pm.Handlers.Run(ctx, pm); err != nil {
+		return nil, err
+	}
+
+	handler = ""
+	if err := pm.startInstance(ctx); err != nil {
+		return nil, err
+	}
+
+	plan.Args = pm.cmd.Args
+	return plan, nil
+}
+
+// planHandlerList returns the handlers of l as they run while planning.
+func planHandlerList(l HandlerList, plan *Plan, current *string) HandlerList {
+	planned := HandlerList{}
+	for _, h := range l.list {
+		switch h.Name {
+		case SetupNetworkHandlerName:
+			h.Fn, h.Undo = planSetupNetwork, nil
+		case StartVMMHandlerName,
+			CreateLogFilesHandlerName,
+			LinkFilesToRootFSHandlerName,
+			DetectCapabilitiesHandlerName,
+			QueryCapabilitiesHandlerName:
+			h.Fn, h.Undo = func(ctx context.Context, m *Machine) error { return nil }, nil
+		case WriteConfigFileHandlerName:
+			h.Fn, h.Undo = func(ctx context.Context, m *Machine) error {
+				data, err := m.renderConfigFile()
+				if err != nil {
+					return err
+				}
+				plan.ConfigFile = data
+				_, argPath := m.configFilePaths()
+				m.addConfigFileArgs(argPath)
+				return nil
+			}, nil
+		}
+
+		name, fn := h.Name, h.Fn
+		h.Fn = func(ctx context.Context, m *Machine) error {
+			plan.Handlers = append(plan.Handlers, name)
+			*current = name
+			return fn(ctx, m)
+		}
+		planned = planned.Append(h)
+	}
+	return planned
+}
+
+// planSetupNetwork stands in for the network interfaces CNI would create.
+func planSetupNetwork(ctx context.Context, m *Machine) error {
+	for i, iface := range m.Cfg.NetworkInterfaces {
+		if iface.CNIConfiguration == nil || iface.StaticConfiguration != nil {
+			continue
+		}
+
+		m.Cfg.NetworkInterfaces[i].StaticConfiguration = &StaticNetworkConfiguration{
+			HostDevName: fmt.Sprintf("<cni:%s>", iface.CNIConfiguration.NetworkName),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+func newPlanTestConfig(t *testing.T) Config {
+	return Config{
+		SocketPath:        filepath.Join(t.TempDir(), "fc.sock"),
+		VMID:              "planned-vm",
+		DisableValidation: true,
+		KernelImagePath:   "/vmlinux",
+		KernelArgs:        "console=ttyS0",
+		MachineCfg: models.MachineConfiguration{
+			VcpuCount:  Int64(1),
+			MemSizeMib: Int64(128),
+		},
+		Drives: NewDrivesBuilder("/rootfs").Build(),
+		NetworkInterfaces: []NetworkInterface{{
+			StaticConfiguration: &StaticNetworkConfiguration{
+				MacAddress:  "AA:FC:00:00:00:01",
+				HostDevName: "tap0",
+			},
+		}},
+	}
+}
+
+func TestPlan(t *testing.T) {
+	cfg := newPlanTestConfig(t)
+	m, err := NewMachine(context.Background(), cfg, WithLogger(fctesting.NewLogEntry(t)))
+	require.NoError(t, err)
+	m.Handlers.FcInit = m.Handlers.FcInit.AppendAfter(CreateBootSourceHandlerName, NewSetMetadataHandler(map[string]string{"foo": "bar"}))
+
+	plan, err := m.Plan(context.Background())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"firecracker", "--api-sock", cfg.SocketPath, "--id", "planned-vm", "--no-seccomp"}, plan.Args)
+	assert.Contains(t, plan.Handlers, StartVMMHandlerName)
+
+	var operations []string
+	for _, call := range plan.Calls {
+		operations = append(operations, call.Handler+" "+call.Operation)
+	}
+	assert.Equal(t, []string{
+		CreateMachineHandlerName + " PutMachineConfiguration",
+		CreateMachineHandlerName + " GetMachineConfiguration",
+		CreateBootSourceHandlerName + " PutGuestBootSource",
+		SetMetadataHandlerName + " PutMmds",
+		AttachDrivesHandlerName + " PutGuestDriveByID",
+		CreateNetworkInterfacesHandlerName + " PutGuestNetworkInterfaceByID",
+		" CreateSyncAction",
+	}, operations)
+
+	assert.JSONEq(t, `{"foo":"bar"}`, string(plan.Calls[3].Body))
+	assert.JSONEq(t, `{
+		"drive_id": "root_drive",
+		"is_read_only": false,
+		"is_root_device": true,
+		"path_on_host": "/rootfs"
+	}`, string(plan.Calls[4].Body))
+
+	// the machine was left untouched
+	assert.Equal(t, StateCreated, m.State())
+	_, err = os.Stat(cfg.SocketPath)
+	assert.True(t, os.IsNotExist(err), "no VMM must be started")
+}
+
+func TestPlanConfigFile(t *testing.T) {
+	cfg := newPlanTestConfig(t)
+	path := filepath.Join(t.TempDir(), "vm.json")
+	m, err := NewMachine(context.Background(), cfg, WithLogger(fctesting.NewLogEntry(t)), WithConfigFile(path, WithNoAPI()))
+	require.NoError(t, err)
+	args := append([]string(nil), m.cmd.Args...)
+
+	plan, err := m.Plan(context.Background())
+	require.NoError(t, err)
+
+	assert.Empty(t, plan.Calls)
+	assert.Equal(t, append(args, "--config-file", path, "--no-api"), plan.Args)
+
+	var vmCfg models.FullVMConfiguration
+	require.NoError(t, json.Unmarshal(plan.ConfigFile, &vmCfg))
+	assert.Equal(t, "/vmlinux", StringValue(vmCfg.BootSource.KernelImagePath))
+
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err), "the configuration file must not be written")
+	assert.Equal(t, args, m.cmd.Args)
+}
+
+func TestPlanCapabilityDetection(t *testing.T) {
+	dir := t.TempDir()
+	cfg := newPlanTestConfig(t)
+	cfg.DisableValidation = false
+	cfg.KernelImagePath = filepath.Join(dir, "vmlinux")
+	cfg.Drives = NewDrivesBuilder(filepath.Join(dir, "rootfs")).Build()
+	for _, path := range []string{cfg.KernelImagePath, StringValue(cfg.Drives[0].PathOnHost)} {
+		require.NoError(t, os.WriteFile(path, nil, 0600))
+	}
+	cfg.Capabilities = CapabilitiesForVersion(FirecrackerVersion{Major: 1, Minor: 0})
+	cmd := VMCommandBuilder{}.WithBin(filepath.Join(dir, "firecracker")).Build(context.Background())
+	m, err := NewMachine(context.Background(), cfg,
+		WithLogger(fctesting.NewLogEntry(t)),
+		WithProcessRunner(cmd),
+		WithCapabilityDetection(VersionFromBinary),
+	)
+	require.NoError(t, err)
+
+	// the binary does not exist, so it must not be run
+	plan, err := m.Plan(context.Background())
+	require.NoError(t, err)
+	assert.Contains(t, plan.Handlers, DetectCapabilitiesHandlerName)
+	assert.Equal(t, cfg.Capabilities, m.Cfg.Capabilities)
+}
+
+func TestPlanCNI(t *testing.T) {
+	cfg := newPlanTestConfig(t)
+	cfg.NetworkInterfaces = []NetworkInterface{{
+		CNIConfiguration: &CNIConfiguration{NetworkName: "fcnet", IfName: "veth0"},
+	}}
+	m, err := NewMachine(context.Background(), cfg, WithLogger(fctesting.NewLogEntry(t)))
+	require.NoError(t, err)
+
+	plan, err := m.Plan(context.Background())
+	require.NoError(t, err)
+
+	var iface models.NetworkInterface
+	for _, call := range plan.Calls {
+		if call.Operation == "PutGuestNetworkInterfaceByID" {
+			require.NoError(t, json.Unmarshal(call.Body, &iface))
+		}
+	}
+	assert.Equal(t, "<cni:fcnet>", StringValue(iface.HostDevName))
+	assert.Nil(t, m.Cfg.NetworkInterfaces[0].StaticConfiguration)
+}
@@ -0,0 +1,561 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package pool keeps a number of Firecracker microVMs booted, or restored from
+// a snapshot, and paused so that they can be handed out without paying for a
+// cold boot.
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+	"github.com/sirupsen/logrus"
+
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+)
+
+const (
+	// socketName is the name of the API socket in the directory of a VM.
+	socketName = "firecracker.sock"
+
+	defaultFirecrackerBinary = "firecracker"
+	defaultRetryInterval     = time.Second
+	defaultStopTimeout       = 5 * time.Second
+)
+
+// ErrClosed is returned by Acquire once the Pool has been closed.
+var ErrClosed = errors.New("pool: closed")
+
+// ErrNotLeased is returned by Release for a Lease which is not held, because it
+// was already released.
+var ErrNotLeased = errors.New("pool: VM is not leased")
+
+// Snapshot describes the golden snapshot VMs are restored from.
+type Snapshot struct {
+	MemFilePath  string
+	SnapshotPath string
+	Opts         []firecracker.WithSnapshotOpt
+}
+
+// Config configures a Pool.
+type Config struct {
+	// Size is the number of warm VMs the Pool keeps ready.
+	Size int
+
+	// Dir is the directory in which every VM gets a directory of its own,
+	// named after its VMID, holding its API and vsock sockets.
+	Dir string
+
+	// Machine is the configuration the VMs are created from. VMID and
+	// SocketPath are set for every VM, and the paths of VsockDevices are
+	// moved into the VM's directory.
+	Machine firecracker.Config
+
+	// Opts are passed to firecracker.NewMachine for every VM.
+	Opts []firecracker.Opt
+
+	// MachineOpts, if set, returns further options for the VM with the given
+	// ID and directory, applied after Opts.
+	MachineOpts func(vmid, dir string) []firecracker.Opt
+
+	// Snapshot, if set, makes the Pool restore VMs from the snapshot instead
+	// of booting them. Firecracker is then run from the VM's directory, so
+	// that the vsock paths recorded in the snapshot, which must be relative,
+	// are unique per VM.
+	Snapshot *Snapshot
+
+	// FirecrackerBinary is the Firecracker binary used to restore snapshots.
+	// Defaults to "firecracker".
+	FirecrackerBinary string
+
+	// RetryInterval is how long the Pool waits before creating a VM again
+	// after a failure. Defaults to one second.
+	RetryInterval time.Duration
+
+	// StopTimeout is how long a released VM is given to exit after SIGTERM
+	// before it is killed. Defaults to five seconds.
+	StopTimeout time.Duration
+
+	// Logger is used to report failures to create VMs.
+	Logger *logrus.Entry
+}
+
+// Stats describes the usage of a Pool.
+type Stats struct {
+	// Warm is the number of VMs ready to be acquired.
+	Warm int
+	// Leased is the number of VMs acquired and not yet released.
+	Leased int
+	// Created is the number of VMs successfully created.
+	Created uint64
+	// CreateFailures is the number of VMs that failed to be created.
+	CreateFailures uint64
+	// Acquired is the number of successful calls to Acquire.
+	Acquired uint64
+	// Released is the number of calls to Release.
+	Released uint64
+	// Discarded is the number of warm VMs destroyed instead of being handed
+	// out, because their VMM exited or they could not be resumed.
+	Discarded uint64
+	// AcquireWait is the total time spent in Acquire waiting for a warm VM.
+	AcquireWait time.Duration
+	// CreateTime is the total time spent creating VMs, including failures.
+	CreateTime time.Duration
+}
+
+// Lease is a VM handed out by Acquire.
+type Lease struct {
+	// Machine is the leased microVM. It is running when Acquire returns.
+	Machine *firecracker.Machine
+	// VMID is the ID of the VM, which is never reused by the Pool.
+	VMID string
+	// VsockPaths are the host paths of the vsock sockets of the VM, in the
+	// order of Config.Machine.VsockDevices.
+	VsockPaths []string
+
+	dir string
+}
+
+// Pool keeps Config.Size VMs warm and hands them out. It is safe for
+// concurrent use.
+type Pool struct {
+	cfg    Config
+	logger *logrus.Entry
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// refill wakes up the goroutine creating VMs
+	refill chan struct{}
+	// ready notifies waiting Acquire calls of a new warm VM
+	ready chan struct{}
+
+	mu     sync.Mutex
+	warm   []*Lease
+	leased map[*Lease]struct{}
+	stats  Stats
+	closed bool
+}
+
+// New returns a Pool and starts filling it in the background.
+func New(cfg Config) (*Pool, error) {
+	if cfg.Size < 1 {
+		return nil, fmt.Errorf("pool size must be at least 1, got %d", cfg.Size)
+	}
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("pool directory must be set")
+	}
+	if cfg.Snapshot != nil {
+		for _, dev := range cfg.Machine.VsockDevices {
+			if filepath.IsAbs(dev.Path) {
+				return nil, fmt.Errorf("vsock path %q of %s must be relative to be unique per restored VM", dev.Path, dev.ID)
+			}
+		}
+	}
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create pool directory %q: %w", cfg.Dir, err)
+	}
+
+	if cfg.FirecrackerBinary == "" {
+		cfg.FirecrackerBinary = defaultFirecrackerBinary
+	}
+	if cfg.RetryInterval == 0 {
+		cfg.RetryInterval = defaultRetryInterval
+	}
+	if cfg.StopTimeout == 0 {
+		cfg.StopTimeout = defaultStopTimeout
+	}
+
+	logger := cfg.Logger
+	if logger == nil {
+		noop := logrus.New()
+		noop.Out = io.Discard
+		logger = logrus.NewEntry(noop)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		cfg:    cfg,
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
+		done:   make(chan struct{}),
+		refill: make(chan struct{}, 1),
+		ready:  make(chan struct{}),
+		leased: make(map[*Lease]struct{}),
+	}
+
+	go p.fill()
+	return p, nil
+}
+
+// Acquire hands out a warm VM, waiting for one to become available if there
+// is none. The metadata, if not nil, is set as the MMDS content of the VM
+// before it is resumed.
+//
+// Warm VMs whose VMM exited, or which cannot be resumed, are destroyed and
+// replaced, and the next warm VM is tried instead.
+func (p *Pool) Acquire(ctx context.Context, metadata interface{}) (*Lease, error) {
+	start := time.Now()
+
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrClosed
+		}
+
+		if len(p.warm) > 0 {
+			lease := p.warm[0]
+			p.warm = p.warm[1:]
+			p.stats.AcquireWait += time.Since(start)
+			p.mu.Unlock()
+
+			p.wakeFill()
+
+			if !alive(lease) {
+				p.discard(lease, fmt.Errorf("VMM of VM %q exited while warm", lease.VMID))
+				continue
+			}
+
+			if err := p.activate(ctx, lease, metadata); err != nil {
+				var metadataErr *metadataError
+				if ctx.Err() != nil || (errors.As(err, &metadataErr) && alive(lease)) {
+					// the VM is fine, the request is not
+					p.destroy(lease)
+					return nil, err
+				}
+				p.discard(lease, err)
+				continue
+			}
+
+			p.mu.Lock()
+			p.leased[lease] = struct{}{}
+			p.stats.Acquired++
+			p.mu.Unlock()
+			return lease, nil
+		}
+
+		ready := p.ready
+		p.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			p.mu.Lock()
+			p.stats.AcquireWait += time.Since(start)
+			p.mu.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// alive returns true if the VMM of a warm VM is still running.
+func alive(lease *Lease) bool {
+	switch lease.Machine.State() {
+	case firecracker.StatePaused, firecracker.StateRunning:
+		return true
+	}
+	return false
+}
+
+// discard destroys a warm VM which cannot be handed out.
+func (p *Pool) discard(lease *Lease, reason error) {
+	p.logger.WithError(reason).WithField("vmid", lease.VMID).Warn("discarding warm VM")
+
+	p.mu.Lock()
+	p.stats.Discarded++
+	p.mu.Unlock()
+
+	if err := p.destroy(lease); err != nil {
+		p.logger.WithError(err).WithField("vmid", lease.VMID).Debug("failed to destroy discarded VM")
+	}
+}
+
+// metadataError is returned by activate when the metadata of the caller is
+// rejected.
+type metadataError struct {
+	vmid string
+	err  error
+}
+
+func (e *metadataError) Error() string {
+	return fmt.Sprintf("failed to set metadata of VM %q: %v", e.vmid, e.err)
+}
+
+func (e *metadataError) Unwrap() error {
+	return e.err
+}
+
+// activate gives the VM its per-lease identity and resumes it.
+func (p *Pool) activate(ctx context.Context, lease *Lease, metadata interface{}) error {
+	if metadata != nil {
+		if err := lease.Machine.SetMetadata(ctx, metadata); err != nil {
+			return &metadataError{vmid: lease.VMID, err: err}
+		}
+	}
+
+	if lease.Machine.State() == firecracker.StatePaused {
+		if err := lease.Machine.ResumeVM(ctx); err != nil {
+			return fmt.Errorf("failed to resume VM %q: %w", lease.VMID, err)
+		}
+	}
+	return nil
+}
+
+// Release stops a leased VM and removes its directory. VMs are never handed
+// out twice, the Pool replaces them with new ones. Releasing a Lease again
+// returns ErrNotLeased.
+func (p *Pool) Release(lease *Lease) error {
+	p.mu.Lock()
+	if _, ok := p.leased[lease]; !ok {
+		p.mu.Unlock()
+		return ErrNotLeased
+	}
+	delete(p.leased, lease)
+	p.stats.Released++
+	p.mu.Unlock()
+
+	return p.destroy(lease)
+}
+
+// Stats returns the usage of the Pool.
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.Warm = len(p.warm)
+	stats.Leased = len(p.leased)
+	return stats
+}
+
+// Close stops filling the Pool and stops the warm VMs. Leased VMs are left
+// running until they are released.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	close(p.ready)
+	p.mu.Unlock()
+
+	p.cancel()
+	<-p.done
+
+	p.mu.Lock()
+	warm := p.warm
+	p.warm = nil
+	p.mu.Unlock()
+
+	var errs *multierror.Error
+	for _, lease := range warm {
+		errs = multierror.Append(errs, p.destroy(lease))
+	}
+	return errs.ErrorOrNil()
+}
+
+func (p *Pool) wakeFill() {
+	select {
+	case p.refill <- struct{}{}:
+	default:
+	}
+}
+
+// fill creates VMs until the Pool has Size warm VMs, and again whenever VMs
+// are acquired.
+func (p *Pool) fill() {
+	defer close(p.done)
+
+	for {
+		p.mu.Lock()
+		missing := p.cfg.Size - len(p.warm)
+		p.mu.Unlock()
+
+		if missing <= 0 {
+			select {
+			case <-p.refill:
+				continue
+			case <-p.ctx.Done():
+				return
+			}
+		}
+
+		start := time.Now()
+		lease, err := p.create(p.ctx)
+
+		p.mu.Lock()
+		p.stats.CreateTime += time.Since(start)
+		if err != nil {
+			p.stats.CreateFailures++
+			p.mu.Unlock()
+
+			if p.ctx.Err() != nil {
+				return
+			}
+			p.logger.WithError(err).Warn("failed to create warm VM")
+
+			select {
+			case <-time.After(p.cfg.RetryInterval):
+			case <-p.ctx.Done():
+				return
+			}
+			continue
+		}
+
+		if p.closed {
+			p.mu.Unlock()
+			p.destroy(lease)
+			return
+		}
+
+		p.stats.Created++
+		p.warm = append(p.warm, lease)
+		close(p.ready)
+		p.ready = make(chan struct{})
+		p.mu.Unlock()
+	}
+}
+
+// create starts a new VM and leaves it paused.
+func (p *Pool) create(ctx context.Context) (*Lease, error) {
+	vmid := uuid.New().String()
+	dir := filepath.Join(p.cfg.Dir, vmid)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create directory of VM %q: %w", vmid, err)
+	}
+
+	cfg, vsockPaths := p.machineConfig(vmid, dir)
+
+	opts := p.machineOpts(cfg, vmid, dir)
+	machine, err := firecracker.NewMachine(ctx, cfg, opts...)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to create VM %q: %w", vmid, err)
+	}
+
+	lease := &Lease{Machine: machine, VMID: vmid, VsockPaths: vsockPaths, dir: dir}
+
+	if err := machine.Start(ctx); err != nil {
+		p.destroy(lease)
+		return nil, fmt.Errorf("failed to start VM %q: %w", vmid, err)
+	}
+
+	if machine.State() == firecracker.StateRunning {
+		if err := machine.PauseVM(ctx); err != nil {
+			p.destroy(lease)
+			return nil, fmt.Errorf("failed to pause VM %q: %w", vmid, err)
+		}
+	}
+
+	return lease, nil
+}
+
+// machineConfig returns the configuration of a new VM and the host paths of
+// its vsock sockets.
+func (p *Pool) machineConfig(vmid, dir string) (firecracker.Config, []string) {
+	cfg := p.cfg.Machine
+	cfg.VMID = vmid
+	cfg.SocketPath = filepath.Join(dir, socketName)
+
+	// the slices are shared with the template and modified while starting
+	cfg.Drives = append(cfg.Drives[:0:0], cfg.Drives...)
+	cfg.NetworkInterfaces = append(cfg.NetworkInterfaces[:0:0], cfg.NetworkInterfaces...)
+	for i, iface := range cfg.NetworkInterfaces {
+		if iface.CNIConfiguration != nil {
+			cniCfg := *iface.CNIConfiguration
+			cfg.NetworkInterfaces[i].CNIConfiguration = &cniCfg
+		}
+		if iface.StaticConfiguration != nil {
+			staticCfg := *iface.StaticConfiguration
+			cfg.NetworkInterfaces[i].StaticConfiguration = &staticCfg
+		}
+	}
+
+	var vsockPaths []string
+	cfg.VsockDevices = append(cfg.VsockDevices[:0:0], cfg.VsockDevices...)
+	for i, dev := range cfg.VsockDevices {
+		path := dev.Path
+		if p.cfg.Snapshot == nil {
+			path = filepath.Join(dir, filepath.Base(dev.Path))
+			cfg.VsockDevices[i].Path = path
+		} else {
+			// resolved by Firecracker relative to its working directory, New
+			// rejects absolute paths
+			path = filepath.Join(dir, path)
+		}
+		vsockPaths = append(vsockPaths, path)
+	}
+
+	return cfg, vsockPaths
+}
+
+// machineOpts returns the options of a new VM.
+func (p *Pool) machineOpts(cfg firecracker.Config, vmid, dir string) []firecracker.Opt {
+	var opts []firecracker.Opt
+
+	if snapshot := p.cfg.Snapshot; snapshot != nil {
+		args := []string{"--id", vmid}
+		if !cfg.Seccomp.Enabled {
+			args = append(args, "--no-seccomp")
+		} else if cfg.Seccomp.Filter != "" {
+			args = append(args, "--seccomp-filter", cfg.Seccomp.Filter)
+		}
+
+		cmd := firecracker.VMCommandBuilder{}.
+			WithBin(p.cfg.FirecrackerBinary).
+			WithSocketPath(cfg.SocketPath).
+			AddArgs(args...).
+			Build(context.Background())
+		cmd.Dir = dir
+
+		opts = append(opts,
+			firecracker.WithProcessRunner(cmd),
+			firecracker.WithSnapshot(snapshot.MemFilePath, snapshot.SnapshotPath, snapshot.Opts...),
+		)
+	}
+
+	opts = append(opts, p.cfg.Opts...)
+	if p.cfg.MachineOpts != nil {
+		opts = append(opts, p.cfg.MachineOpts(vmid, dir)...)
+	}
+	return opts
+}
+
+// destroy stops the VM and removes its directory.
+func (p *Pool) destroy(lease *Lease) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*p.cfg.StopTimeout)
+	defer cancel()
+
+	var errs *multierror.Error
+	if _, err := lease.Machine.ShutdownWithPolicy(ctx, firecracker.ShutdownPolicy{TermTimeout: p.cfg.StopTimeout}); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("failed to stop VM %q: %w", lease.VMID, err))
+	}
+
+	if err := os.RemoveAll(lease.dir); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("failed to remove directory of VM %q: %w", lease.VMID, err))
+	}
+	return errs.ErrorOrNil()
+}
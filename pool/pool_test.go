@@ -0,0 +1,239 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package pool
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	firecracker "github.com/firecracker-microvm/firecracker-go-sdk"
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+// fakeMachineOpts runs sleep in place of firecracker and serves the API calls
+// with a mock client recording the MMDS content of every VM.
+func fakeMachineOpts(t *testing.T, mu *sync.Mutex, metadata map[string]interface{}) func(vmid, dir string) []firecracker.Opt {
+	return func(vmid, dir string) []firecracker.Opt {
+		socketPath := filepath.Join(dir, socketName)
+		listener, err := net.Listen("unix", socketPath)
+		require.NoError(t, err)
+		t.Cleanup(func() { listener.Close() })
+
+		client := &fctesting.MockClient{
+			PutMmdsFn: func(params *ops.PutMmdsParams) (*ops.PutMmdsNoContent, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				metadata[vmid] = params.Body
+				return &ops.PutMmdsNoContent{}, nil
+			},
+		}
+
+		return []firecracker.Opt{
+			firecracker.WithClient(firecracker.NewClient(socketPath, nil, false, firecracker.WithOpsClient(client))),
+			firecracker.WithProcessRunner(exec.Command("sleep", "60")),
+			firecracker.WithLogger(fctesting.NewLogEntry(t)),
+			func(m *firecracker.Machine) {
+				m.Handlers.FcInit = firecracker.HandlerList{}.Append(firecracker.StartVMMHandler)
+			},
+		}
+	}
+}
+
+func TestPool(t *testing.T) {
+	var mu sync.Mutex
+	metadata := map[string]interface{}{}
+
+	dir := t.TempDir()
+	p, err := New(Config{
+		Size: 2,
+		Dir:  dir,
+		Machine: firecracker.Config{
+			DisableValidation: true,
+			VsockDevices:      []firecracker.VsockDevice{{ID: "vsock0", Path: "/template/v.sock", CID: 3}},
+		},
+		MachineOpts: fakeMachineOpts(t, &mu, metadata),
+	})
+	require.NoError(t, err)
+	defer p.Close()
+
+	assert.Eventually(t, func() bool { return p.Stats().Warm == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	ctx := context.Background()
+	first, err := p.Acquire(ctx, map[string]string{"tenant": "a"})
+	require.NoError(t, err)
+	second, err := p.Acquire(ctx, map[string]string{"tenant": "b"})
+	require.NoError(t, err)
+
+	assert.NotEqual(t, first.VMID, second.VMID)
+	assert.Equal(t, firecracker.StateRunning, first.Machine.State())
+	assert.Equal(t, []string{filepath.Join(dir, first.VMID, "v.sock")}, first.VsockPaths)
+	assert.Equal(t, first.VsockPaths[0], first.Machine.Cfg.VsockDevices[0].Path)
+
+	mu.Lock()
+	assert.Equal(t, map[string]string{"tenant": "a"}, metadata[first.VMID])
+	assert.Equal(t, map[string]string{"tenant": "b"}, metadata[second.VMID])
+	mu.Unlock()
+
+	stats := p.Stats()
+	assert.Equal(t, 2, stats.Leased)
+	assert.Equal(t, uint64(2), stats.Acquired)
+
+	require.NoError(t, p.Release(first))
+	assert.Equal(t, firecracker.StateExited, first.Machine.State())
+	_, err = os.Stat(filepath.Join(dir, first.VMID))
+	assert.True(t, os.IsNotExist(err), "expected the VM directory to be removed, got %v", err)
+
+	// the pool is replenished in the background
+	assert.Eventually(t, func() bool { return p.Stats().Warm == 2 }, 5*time.Second, 10*time.Millisecond)
+	stats = p.Stats()
+	assert.Equal(t, 1, stats.Leased)
+	assert.Equal(t, uint64(1), stats.Released)
+	assert.Equal(t, uint64(4), stats.Created)
+
+	require.NoError(t, p.Close())
+	assert.Equal(t, 0, p.Stats().Warm)
+	_, err = p.Acquire(ctx, nil)
+	assert.Equal(t, ErrClosed, err)
+
+	require.NoError(t, p.Release(second))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// a lease is only released once
+	assert.Equal(t, ErrNotLeased, p.Release(second))
+	assert.Equal(t, uint64(2), p.Stats().Released)
+}
+
+func TestPoolSnapshotAbsoluteVsockPath(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "pool")
+	_, err := New(Config{
+		Size: 1,
+		Dir:  dir,
+		Machine: firecracker.Config{
+			VsockDevices: []firecracker.VsockDevice{{ID: "vsock0", Path: "/run/v.sock", CID: 3}},
+		},
+		Snapshot: &Snapshot{SnapshotPath: "/snapshots/vm.snap", MemFilePath: "/snapshots/vm.mem"},
+	})
+	assert.ErrorContains(t, err, `vsock path "/run/v.sock" of vsock0 must be relative`)
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err), "expected the pool directory not to be created, got %v", err)
+}
+
+func TestPoolAcquireWaits(t *testing.T) {
+	p, err := New(Config{
+		Size:          1,
+		Dir:           t.TempDir(),
+		Machine:       firecracker.Config{DisableValidation: true},
+		RetryInterval: 10 * time.Millisecond,
+		// every VM fails to start
+		Opts: []firecracker.Opt{
+			firecracker.WithLogger(fctesting.NewLogEntry(t)),
+			func(m *firecracker.Machine) {
+				m.Handlers.FcInit = firecracker.HandlerList{}.Append(firecracker.Handler{
+					Name: "fcinit.Fail",
+					Fn: func(ctx context.Context, m *firecracker.Machine) error {
+						return assert.AnError
+					},
+				})
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer p.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = p.Acquire(ctx, nil)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	stats := p.Stats()
+	assert.NotZero(t, stats.CreateFailures)
+	assert.NotZero(t, stats.AcquireWait)
+}
+
+func TestPoolDiscardsDeadVMs(t *testing.T) {
+	var mu sync.Mutex
+	metadata := map[string]interface{}{}
+	fakeOpts := fakeMachineOpts(t, &mu, metadata)
+
+	// the resume of the first VM created fails
+	var created int32
+	machineOpts := func(vmid, dir string) []firecracker.Opt {
+		opts := fakeOpts(vmid, dir)
+		if atomic.AddInt32(&created, 1) != 1 {
+			return opts
+		}
+		client := &fctesting.MockClient{
+			PatchVMFn: func(params *ops.PatchVMParams) (*ops.PatchVMNoContent, error) {
+				if *params.Body.State == models.VMStateResumed {
+					return nil, assert.AnError
+				}
+				return &ops.PatchVMNoContent{}, nil
+			},
+		}
+		return append(opts, firecracker.WithClient(firecracker.NewClient(filepath.Join(dir, socketName), nil, false, firecracker.WithOpsClient(client))))
+	}
+
+	dir := t.TempDir()
+	p, err := New(Config{
+		Size:        3,
+		Dir:         dir,
+		Machine:     firecracker.Config{DisableValidation: true},
+		MachineOpts: machineOpts,
+	})
+	require.NoError(t, err)
+	defer p.Close()
+
+	assert.Eventually(t, func() bool { return p.Stats().Warm == 3 }, 5*time.Second, 10*time.Millisecond)
+
+	// the VMM of the second warm VM crashes
+	p.mu.Lock()
+	unresumable, crashed := p.warm[0], p.warm[1]
+	p.mu.Unlock()
+	pid, err := crashed.Machine.PID()
+	require.NoError(t, err)
+	require.NoError(t, syscall.Kill(pid, syscall.SIGKILL))
+	assert.Eventually(t, func() bool { return crashed.Machine.State().Terminal() }, 5*time.Second, 10*time.Millisecond)
+
+	lease, err := p.Acquire(context.Background(), nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, unresumable.VMID, lease.VMID)
+	assert.NotEqual(t, crashed.VMID, lease.VMID)
+	assert.Equal(t, firecracker.StateRunning, lease.Machine.State())
+
+	stats := p.Stats()
+	assert.Equal(t, uint64(2), stats.Discarded)
+	assert.Equal(t, uint64(1), stats.Acquired)
+	assert.Equal(t, 1, stats.Leased)
+	for _, discarded := range []*Lease{unresumable, crashed} {
+		_, err = os.Stat(filepath.Join(dir, discarded.VMID))
+		assert.True(t, os.IsNotExist(err), "expected the directory of the discarded VM to be removed, got %v", err)
+	}
+
+	require.NoError(t, p.Release(lease))
+}
@@ -0,0 +1,274 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+// fakeProcessTest runs machines with the fake firecracker and jailer.
+type fakeProcessTest struct {
+	t           *testing.T
+	dir         string
+	events      string
+	firecracker string
+	jailer      string
+}
+
+func newFakeProcessTest(t *testing.T, behavior fctesting.FakeBehavior) *fakeProcessTest {
+	firecracker, jailer := fctesting.BuildFakeBinaries(t)
+	dir := t.TempDir()
+	behavior.EventsPath = filepath.Join(dir, "events.jsonl")
+	fctesting.SetFakeBehavior(t, behavior)
+
+	return &fakeProcessTest{
+		t:           t,
+		dir:         dir,
+		events:      behavior.EventsPath,
+		firecracker: firecracker,
+		jailer:      jailer,
+	}
+}
+
+func (p *fakeProcessTest) config() Config {
+	kernelPath := filepath.Join(p.dir, "vmlinux")
+	require.NoError(p.t, os.WriteFile(kernelPath, nil, 0600))
+
+	return Config{
+		SocketPath:        filepath.Join(p.dir, "fc.sock"),
+		VMID:              "fake-vm",
+		DisableValidation: true,
+		KernelImagePath:   kernelPath,
+		MachineCfg: models.MachineConfiguration{
+			VcpuCount:  Int64(1),
+			MemSizeMib: Int64(128),
+		},
+	}
+}
+
+// newMachine returns a machine running the fake firecracker with the command
+// line built by the SDK.
+func (p *fakeProcessTest) newMachine(cfg Config) *Machine {
+	cmd := configureBuilder(VMCommandBuilder{}.WithBin(p.firecracker), cfg).Build(context.Background())
+	m, err := NewMachine(context.Background(), cfg, WithProcessRunner(cmd), WithLogger(fctesting.NewLogEntry(p.t)))
+	require.NoError(p.t, err)
+	p.t.Cleanup(func() { m.StopVMM() })
+	return m
+}
+
+func (p *fakeProcessTest) readEvents() []fctesting.FakeEvent {
+	events, err := fctesting.ReadFakeEvents(p.events)
+	require.NoError(p.t, err)
+	return events
+}
+
+// waitForEvent waits for an event of the process for which match returns
+// true.
+func (p *fakeProcessTest) waitForEvent(process string, match func(fctesting.FakeEvent) bool) fctesting.FakeEvent {
+	var found fctesting.FakeEvent
+	require.Eventually(p.t, func() bool {
+		for _, event := range p.readEvents() {
+			if event.Process == process && match(event) {
+				found = event
+				return true
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond, "expected a %s event", process)
+	return found
+}
+
+func waitForExit(t *testing.T, m *Machine) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := m.Wait(ctx)
+	require.NotEqual(t, context.DeadlineExceeded, err, "expected the VMM to exit")
+	return err
+}
+
+func TestFakeFirecrackerStartStop(t *testing.T) {
+	p := newFakeProcessTest(t, fctesting.FakeBehavior{})
+	cfg := p.config()
+	cfg.BootTimer = true
+	m := p.newMachine(cfg)
+
+	require.NoError(t, m.Start(context.Background()))
+	assert.Equal(t, StateRunning, m.State())
+
+	start := p.waitForEvent("firecracker", func(e fctesting.FakeEvent) bool { return e.Type == fctesting.FakeEventStart })
+	assert.Equal(t, []string{"--api-sock", cfg.SocketPath, "--id", "fake-vm", "--no-seccomp", "--boot-timer"}, start.Args)
+	pid, err := m.PID()
+	require.NoError(t, err)
+	assert.Equal(t, pid, start.PID)
+
+	require.NoError(t, m.StopVMM())
+	p.waitForEvent("firecracker", func(e fctesting.FakeEvent) bool { return e.Signal == syscall.SIGTERM })
+
+	waitForExit(t, m)
+	status := m.ExitStatus()
+	assert.True(t, status.Exited)
+	assert.True(t, status.SDKInitiated)
+	assert.Equal(t, syscall.SIGTERM, status.Signal)
+	assert.Equal(t, StateExited, m.State())
+	_, err = os.Stat(cfg.SocketPath)
+	assert.True(t, os.IsNotExist(err), "expected the socket to be removed, received %v", err)
+}
+
+func TestFakeFirecrackerForwardSignals(t *testing.T) {
+	p := newFakeProcessTest(t, fctesting.FakeBehavior{
+		Firecracker: fctesting.FakeProcessBehavior{IgnoreSignals: []syscall.Signal{syscall.SIGUSR1}},
+	})
+	cfg := p.config()
+	cfg.ForwardSignals = []os.Signal{syscall.SIGUSR1}
+	m := p.newMachine(cfg)
+	require.NoError(t, m.Start(context.Background()))
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	p.waitForEvent("firecracker", func(e fctesting.FakeEvent) bool { return e.Signal == syscall.SIGUSR1 })
+	assert.Equal(t, StateRunning, m.State())
+}
+
+func TestFakeFirecrackerUnexpectedExit(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		exit     fctesting.FakeExit
+		code     int
+		seccomp  bool
+		expected syscall.Signal
+	}{
+		{
+			name: "exit code",
+			exit: fctesting.FakeExit{After: 500 * time.Millisecond, Code: 3},
+			code: 3,
+		},
+		{
+			name:     "seccomp violation",
+			exit:     fctesting.FakeExit{After: 500 * time.Millisecond, Signal: syscall.SIGSYS},
+			code:     -1,
+			seccomp:  true,
+			expected: syscall.SIGSYS,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newFakeProcessTest(t, fctesting.FakeBehavior{
+				Firecracker: fctesting.FakeProcessBehavior{Exit: &tc.exit},
+			})
+			m := p.newMachine(p.config())
+			require.NoError(t, m.Start(context.Background()))
+
+			assert.Error(t, waitForExit(t, m))
+			assert.Equal(t, StateFailed, m.State())
+			status := m.ExitStatus()
+			assert.False(t, status.SDKInitiated)
+			assert.Equal(t, tc.code, status.ExitCode)
+			assert.Equal(t, tc.expected, status.Signal)
+			assert.Equal(t, tc.seccomp, status.SeccompViolation())
+		})
+	}
+}
+
+func TestFakeFirecrackerHang(t *testing.T) {
+	t.Setenv(firecrackerInitTimeoutEnv, "1")
+	p := newFakeProcessTest(t, fctesting.FakeBehavior{
+		Firecracker: fctesting.FakeProcessBehavior{Hang: true},
+	})
+	m := p.newMachine(p.config())
+
+	err := m.Start(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "did not create API socket")
+
+	// the VMM is killed once Start failed
+	require.Eventually(t, func() bool { return m.ExitStatus().Exited }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, syscall.SIGKILL, m.ExitStatus().Signal)
+}
+
+func (p *fakeProcessTest) jailedConfig(daemonize bool) Config {
+	cfg := p.config()
+	cfg.SocketPath = "/api.sock"
+	cfg.JailerCfg = &JailerConfig{
+		ID:             "fake-vm",
+		UID:            Int(os.Getuid()),
+		GID:            Int(os.Getgid()),
+		NumaNode:       Int(0),
+		ExecFile:       p.firecracker,
+		JailerBinary:   p.jailer,
+		ChrootBaseDir:  p.dir,
+		ChrootStrategy: NewNaiveChrootStrategy(cfg.KernelImagePath),
+		CgroupArgs:     []string{"cpu.shares=10"},
+		Daemonize:      daemonize,
+	}
+	return cfg
+}
+
+func TestFakeJailer(t *testing.T) {
+	p := newFakeProcessTest(t, fctesting.FakeBehavior{})
+	m, err := NewMachine(context.Background(), p.jailedConfig(false), WithLogger(fctesting.NewLogEntry(t)))
+	require.NoError(t, err)
+	t.Cleanup(func() { m.StopVMM() })
+
+	require.NoError(t, m.Start(context.Background()))
+	root := filepath.Join(p.dir, "firecracker", "fake-vm", "root")
+	assert.Equal(t, filepath.Join(root, "api.sock"), m.Cfg.SocketPath)
+	assert.FileExists(t, filepath.Join(root, "vmlinux"), "expected the kernel to be linked into the chroot")
+
+	jailer := p.waitForEvent("jailer", func(e fctesting.FakeEvent) bool { return e.Type == fctesting.FakeEventStart })
+	assert.Contains(t, strings.Join(jailer.Args, " "), "--id fake-vm --uid")
+	assert.Contains(t, strings.Join(jailer.Args, " "), "--cgroup cpu.shares=10")
+	firecracker := p.waitForEvent("firecracker", func(e fctesting.FakeEvent) bool { return e.Type == fctesting.FakeEventStart })
+	assert.Equal(t, jailer.PID, firecracker.PID, "expected the jailer to exec firecracker")
+	assert.Contains(t, strings.Join(firecracker.Args, " "), "--api-sock /api.sock")
+
+	require.NoError(t, m.StopVMM())
+	p.waitForEvent("firecracker", func(e fctesting.FakeEvent) bool { return e.Signal == syscall.SIGTERM })
+	waitForExit(t, m)
+}
+
+func TestFakeJailerDaemonize(t *testing.T) {
+	if runtime.GOARCH == "arm64" {
+		t.Skip("the daemonized VMM can only be stopped through the guest on x86_64")
+	}
+
+	p := newFakeProcessTest(t, fctesting.FakeBehavior{})
+	m, err := NewMachine(context.Background(), p.jailedConfig(true), WithLogger(fctesting.NewLogEntry(t)))
+	require.NoError(t, err)
+
+	require.NoError(t, m.Start(context.Background()))
+	firecracker := p.waitForEvent("firecracker", func(e fctesting.FakeEvent) bool { return e.Type == fctesting.FakeEventStart })
+	t.Cleanup(func() { syscall.Kill(firecracker.PID, syscall.SIGKILL) })
+	jailer := p.waitForEvent("jailer", func(e fctesting.FakeEvent) bool { return e.Type == fctesting.FakeEventStart })
+	assert.NotEqual(t, jailer.PID, firecracker.PID, "expected the daemonized jailer to fork")
+
+	// the jailer exited, but the machine runs until it is shut down
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, StateRunning, m.State())
+
+	require.NoError(t, m.Shutdown(context.Background()))
+	p.waitForEvent("firecracker", func(e fctesting.FakeEvent) bool { return e.Type == fctesting.FakeEventExit })
+	assert.NoError(t, waitForExit(t, m))
+}
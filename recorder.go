@@ -0,0 +1,119 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// APIRecord is an attempt of a request to the Firecracker API, as written by
+// WithAPIRecorder.
+type APIRecord struct {
+	// Operation is the name of the API operation, such as PutGuestDriveByID.
+	Operation string `json:"operation"`
+	// Attempt is the number of the attempt, starting at 1.
+	Attempt int `json:"attempt"`
+	// Body is the body of the request, if any.
+	Body json.RawMessage `json:"body,omitempty"`
+	// StatusCode is the HTTP status of the response, or 0 if no response was
+	// received.
+	StatusCode int `json:"status_code,omitempty"`
+	// Response is the body of a successful response, if any.
+	Response json.RawMessage `json:"response,omitempty"`
+	// FaultMessage is the error message returned by Firecracker.
+	FaultMessage string `json:"fault_message,omitempty"`
+	// Error is the error of a request which did not receive a response.
+	Error string `json:"error,omitempty"`
+	// Unavailable is true if the request failed with ErrVMMUnavailable.
+	Unavailable bool `json:"unavailable,omitempty"`
+	// Time is when the request was sent.
+	Time time.Time `json:"time"`
+	// Latency is the time spent waiting for the response, in nanoseconds.
+	Latency time.Duration `json:"latency"`
+}
+
+// WithAPIRecorder writes every attempt of every request of the Client to w,
+// as an APIRecord in a line of JSON. The recording can be replayed by
+// fctesting.NewReplayClient.
+//
+// The recorder is an Interceptor: it records the results of the interceptors
+// added after it, and not those added before it. Errors writing to w are
+// ignored.
+func WithAPIRecorder(w io.Writer) ClientOpt {
+	var mu sync.Mutex
+	return WithInterceptors(func(ctx context.Context, call *APICall, next APIInvoker) error {
+		start := time.Now()
+		err := next(ctx, call)
+
+		record := APIRecord{
+			Operation: call.Operation,
+			Attempt:   call.Attempt,
+			Time:      start,
+			Latency:   call.Latency,
+		}
+		if call.Request != nil {
+			record.Body, _ = json.Marshal(call.Request)
+		}
+
+		var apiErr *APIError
+		switch {
+		case err == nil:
+			record.StatusCode = responseStatusCode(call.Response)
+			record.Response = responsePayload(call.Response)
+		case errors.As(err, &apiErr) && apiErr.StatusCode != 0:
+			record.StatusCode = apiErr.StatusCode
+			record.FaultMessage = apiErr.FaultMessage
+		default:
+			record.Error = err.Error()
+			record.Unavailable = errors.Is(err, ErrVMMUnavailable) || isUnavailable(err)
+		}
+
+		data, marshalErr := json.Marshal(record)
+		if marshalErr == nil {
+			mu.Lock()
+			w.Write(append(data, '\n'))
+			mu.Unlock()
+		}
+		return err
+	})
+}
+
+// responsePayload returns the payload of a response of the generated client
+// as JSON, or nil if it has none.
+func responsePayload(resp interface{}) json.RawMessage {
+	v := reflect.ValueOf(resp)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+
+	payload := v.Elem().FieldByName("Payload")
+	if !payload.IsValid() {
+		return nil
+	}
+	if k := payload.Kind(); (k == reflect.Ptr || k == reflect.Interface) && payload.IsNil() {
+		return nil
+	}
+
+	data, err := json.Marshal(payload.Interface())
+	if err != nil {
+		return nil
+	}
+	return data
+}
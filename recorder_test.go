@@ -0,0 +1,106 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+func TestAPIRecorderReplay(t *testing.T) {
+	dir := t.TempDir()
+	server := fctesting.NewFakeServer(filepath.Join(dir, "fc.sock"))
+	require.NoError(t, server.Start())
+	defer server.Close()
+
+	cfg := Config{
+		SocketPath:        server.SocketPath,
+		DisableValidation: true,
+		KernelImagePath:   "/vmlinux",
+		Drives:            NewDrivesBuilder("/rootfs").AddDrive("/data", true).Build(),
+		MachineCfg: models.MachineConfiguration{
+			VcpuCount:  Int64(2),
+			MemSizeMib: Int64(256),
+		},
+	}
+
+	recordingPath := filepath.Join(dir, "recording.jsonl")
+	recording, err := os.Create(recordingPath)
+	require.NoError(t, err)
+	defer recording.Close()
+
+	m, err := NewMachine(context.Background(), cfg,
+		WithClient(NewClient(server.SocketPath, nil, false, WithAPIRecorder(recording))),
+		WithProcessRunner(exec.Command("sleep", "60")),
+		WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+	require.NoError(t, m.Start(context.Background()))
+	defer m.StopVMM()
+	server.InjectFault("PatchVM", fctesting.Fault{FaultMessage: "injected"})
+	recordedErr := m.PauseVM(context.Background())
+	require.Error(t, recordedErr)
+
+	var records []APIRecord
+	f, err := os.Open(recordingPath)
+	require.NoError(t, err)
+	defer f.Close()
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var record APIRecord
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+
+	var operations []string
+	for _, record := range records {
+		operations = append(operations, record.Operation)
+		assert.False(t, record.Time.IsZero())
+		assert.Positive(t, record.Latency)
+	}
+	assert.Subset(t, operations, []string{"PutMachineConfiguration", "PutGuestBootSource", "PutGuestDriveByID", "CreateSyncAction", "PatchVM"})
+	last := records[len(records)-1]
+	assert.Equal(t, "PatchVM", last.Operation)
+	assert.Equal(t, 400, last.StatusCode)
+	assert.Equal(t, "injected", last.FaultMessage)
+	assert.JSONEq(t, `{"state":"Paused"}`, string(last.Body))
+
+	// replay the recording
+	replay := fctesting.NewReplayClient(t, recordingPath)
+	m, err = NewMachine(context.Background(), cfg,
+		WithClient(NewClient("/nonexistent", nil, false, WithOpsClient(replay))),
+		WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+	m.Handlers.FcInit = m.Handlers.FcInit.Remove(StartVMMHandlerName)
+
+	require.NoError(t, m.Start(context.Background()))
+	err = m.PauseVM(context.Background())
+	assert.Equal(t, recordedErr.Error(), err.Error())
+	assert.True(t, errors.Is(err, ErrInvalidArgument), "expected the replayed error to be classified, received %v", err)
+	// the request sent to wait for the socket of the VMM, which the replayed
+	// machine does not start
+	assert.Equal(t, 1, replay.Remaining())
+}
@@ -0,0 +1,185 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"syscall"
+	"time"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+)
+
+const (
+	defaultRetryMaxAttempts    = 4
+	defaultRetryInitialBackoff = 25 * time.Millisecond
+	defaultRetryMaxBackoff     = time.Second
+	defaultRetryJitter         = 0.2
+)
+
+// RetryPolicy describes how the Client retries API requests failing with a
+// transient error, such as a refused connection on a busy host. Only the
+// operations which are safe to send twice are retried: the GET requests, and
+// the PUT and PATCH requests which overwrite the configuration of the VM.
+// CreateSyncAction(InstanceStart), CreateSnapshot, LoadSnapshot, PutLogger
+// and PutMetrics are never retried. Errors returned by Firecracker are not
+// retried either.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a request is sent at most, including
+	// the first time. Defaults to 4.
+	MaxAttempts int
+
+	// InitialBackoff is the time waited before the first retry. It doubles
+	// with every retry. Defaults to 25ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff bounds the time waited between two attempts. Defaults to 1s.
+	MaxBackoff time.Duration
+
+	// Jitter randomly shortens or lengthens each backoff by up to this
+	// fraction, so that concurrent clients do not retry in lockstep.
+	// Defaults to 0.2.
+	Jitter float64
+
+	// Timeouts overrides the timeout of a single attempt of the given
+	// operations, such as PutGuestDriveByID. A zero timeout leaves the
+	// attempts bounded only by the context.
+	Timeouts map[string]time.Duration
+
+	// OnRetry is called before waiting to send a request again.
+	OnRetry func(RetryAttempt)
+}
+
+// RetryAttempt describes a failed attempt that is going to be retried.
+type RetryAttempt struct {
+	// Operation is the name of the API operation, such as PutGuestDriveByID.
+	Operation string
+	// Attempt is the number of the failed attempt, starting at 1.
+	Attempt int
+	// Err is the error of the failed attempt.
+	Err error
+	// Backoff is the time waited before the next attempt.
+	Backoff time.Duration
+}
+
+// WithRetryPolicy makes the Client retry the requests failing with transient
+// errors according to the policy. The zero fields of the policy are set to
+// their defaults.
+func WithRetryPolicy(policy RetryPolicy) ClientOpt {
+	if policy.MaxAttempts == 0 {
+		policy.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if policy.InitialBackoff == 0 {
+		policy.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if policy.MaxBackoff == 0 {
+		policy.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if policy.Jitter == 0 {
+		policy.Jitter = defaultRetryJitter
+	}
+
+	return func(c *Client) {
+		c.retryPolicy = &policy
+	}
+}
+
+// idempotentOperations lists the operations which may be sent again when it
+// is unknown whether Firecracker received them.
+var idempotentOperations = map[string]bool{
+	"GetFirecrackerVersion":          true,
+	"GetMmds":                        true,
+	"GetMachineConfiguration":        true,
+	"GetExportVMConfig":              true,
+	"DescribeInstance":               true,
+	"DescribeBalloonConfig":          true,
+	"DescribeBalloonStats":           true,
+	"PutMachineConfiguration":        true,
+	"PutGuestBootSource":             true,
+	"PutGuestNetworkInterfaceByID":   true,
+	"PutGuestDriveByID":              true,
+	"PutGuestVsock":                  true,
+	"PutMmds":                        true,
+	"PutMmdsConfig":                  true,
+	"PutBalloon":                     true,
+	"PatchMmds":                      true,
+	"PatchVM":                        true,
+	"PatchGuestDriveByID":            true,
+	"PatchGuestNetworkInterfaceByID": true,
+	"PatchBalloon":                   true,
+	"PatchBalloonStatsInterval":      true,
+}
+
+// isIdempotent reports whether the request may safely be sent twice.
+func isIdempotent(operation string, body interface{}) bool {
+	if operation == "CreateSyncAction" {
+		// flushing the metrics twice is harmless, starting the instance is not
+		info, ok := body.(*models.InstanceActionInfo)
+		return ok && StringValue(info.ActionType) == models.InstanceActionInfoActionTypeFlushMetrics
+	}
+	return idempotentOperations[operation]
+}
+
+// isTransient reports whether a request failed for a reason unrelated to the
+// request itself, such that sending it again may succeed.
+func isTransient(err error) bool {
+	for _, target := range []error{
+		syscall.ECONNREFUSED,
+		syscall.ECONNRESET,
+		syscall.EAGAIN,
+		syscall.EPIPE,
+		io.EOF,
+		io.ErrUnexpectedEOF,
+		context.DeadlineExceeded,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// timeout returns the timeout of the operation, if the policy overrides it.
+func (p *RetryPolicy) timeout(operation string) (time.Duration, bool) {
+	if p == nil {
+		return 0, false
+	}
+	t, ok := p.Timeouts[operation]
+	return t, ok
+}
+
+// shouldRetry reports whether the failed attempt of the request is retried.
+func (p *RetryPolicy) shouldRetry(ctx context.Context, operation string, body interface{}, attempt int, err error) bool {
+	if p == nil || attempt >= p.MaxAttempts || ctx.Err() != nil {
+		return false
+	}
+	return isIdempotent(operation, body) && isTransient(err)
+}
+
+// backoff returns the time to wait after the given failed attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < attempt && backoff < p.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.MaxBackoff {
+		backoff = p.MaxBackoff
+	}
+
+	jitter := 1 + p.Jitter*(2*rand.Float64()-1)
+	return time.Duration(float64(backoff) * jitter)
+}
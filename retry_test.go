@@ -0,0 +1,163 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+var errConnRefused = &net.OpError{Op: "dial", Net: "unix", Err: syscall.ECONNREFUSED}
+
+func TestRetryPolicyRetriesTransientErrors(t *testing.T) {
+	var calls int
+	var retries []RetryAttempt
+	client := NewClient("/path/to/socket", nil, false,
+		WithOpsClient(&fctesting.MockClient{
+			PutGuestDriveByIDFn: func(params *ops.PutGuestDriveByIDParams) (*ops.PutGuestDriveByIDNoContent, error) {
+				calls++
+				if calls < 3 {
+					return nil, errConnRefused
+				}
+				return &ops.PutGuestDriveByIDNoContent{}, nil
+			},
+		}),
+		WithRetryPolicy(RetryPolicy{
+			InitialBackoff: time.Millisecond,
+			OnRetry: func(attempt RetryAttempt) {
+				retries = append(retries, attempt)
+			},
+		}),
+	)
+
+	drive := NewDrivesBuilder("/rootfs").Build()[0]
+	_, err := client.PutGuestDriveByID(context.Background(), "root_drive", &drive)
+	require.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	require.Len(t, retries, 2)
+	for i, attempt := range retries {
+		assert.Equal(t, "PutGuestDriveByID", attempt.Operation)
+		assert.Equal(t, i+1, attempt.Attempt)
+		assert.True(t, errors.Is(attempt.Err, ErrVMMUnavailable))
+	}
+}
+
+func TestRetryPolicyGivesUp(t *testing.T) {
+	cases := []struct {
+		name   string
+		policy []ClientOpt
+		info   *models.InstanceActionInfo
+		err    error
+		calls  int
+	}{
+		{
+			name:  "no policy",
+			info:  &models.InstanceActionInfo{ActionType: String(models.InstanceActionInfoActionTypeFlushMetrics)},
+			err:   errConnRefused,
+			calls: 1,
+		},
+		{
+			name:   "not idempotent",
+			policy: []ClientOpt{WithRetryPolicy(RetryPolicy{InitialBackoff: time.Millisecond})},
+			info:   &models.InstanceActionInfo{ActionType: String(models.InstanceActionInfoActionTypeInstanceStart)},
+			err:    errConnRefused,
+			calls:  1,
+		},
+		{
+			name:   "firecracker error",
+			policy: []ClientOpt{WithRetryPolicy(RetryPolicy{InitialBackoff: time.Millisecond})},
+			info:   &models.InstanceActionInfo{ActionType: String(models.InstanceActionInfoActionTypeFlushMetrics)},
+			err:    &ops.CreateSyncActionBadRequest{Payload: &models.Error{FaultMessage: "Metrics not initialized."}},
+			calls:  1,
+		},
+		{
+			name:   "attempts exhausted",
+			policy: []ClientOpt{WithRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond})},
+			info:   &models.InstanceActionInfo{ActionType: String(models.InstanceActionInfoActionTypeFlushMetrics)},
+			err:    errConnRefused,
+			calls:  3,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var calls int
+			opts := append([]ClientOpt{WithOpsClient(&fctesting.MockClient{
+				CreateSyncActionFn: func(params *ops.CreateSyncActionParams) (*ops.CreateSyncActionNoContent, error) {
+					calls++
+					return nil, c.err
+				},
+			})}, c.policy...)
+			client := NewClient("/path/to/socket", nil, false, opts...)
+
+			_, err := client.CreateSyncAction(context.Background(), c.info)
+			assert.True(t, errors.Is(err, c.err), "unexpected error %v", err)
+			assert.Equal(t, c.calls, calls)
+		})
+	}
+}
+
+func TestRetryPolicyTimeouts(t *testing.T) {
+	var calls int
+	client := NewClient("/path/to/socket", nil, false,
+		WithOpsClient(&fctesting.MockClient{
+			GetMmdsFn: func(params *ops.GetMmdsParams) (*ops.GetMmdsOK, error) {
+				calls++
+				<-params.Context.Done()
+				return nil, params.Context.Err()
+			},
+		}),
+		WithRetryPolicy(RetryPolicy{
+			MaxAttempts:    2,
+			InitialBackoff: time.Millisecond,
+			Timeouts:       map[string]time.Duration{"GetMmds": 10 * time.Millisecond},
+		}),
+	)
+
+	_, err := client.GetMmds(context.Background())
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "unexpected error %v", err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{
+		InitialBackoff: 10 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+		Jitter:         0.2,
+	}
+
+	for attempt, expected := range map[int]time.Duration{
+		1: 10 * time.Millisecond,
+		2: 20 * time.Millisecond,
+		3: 40 * time.Millisecond,
+		4: 50 * time.Millisecond,
+		9: 50 * time.Millisecond,
+	} {
+		backoff := policy.backoff(attempt)
+		assert.GreaterOrEqual(t, backoff, time.Duration(float64(expected)*0.8), "attempt %d", attempt)
+		assert.LessOrEqual(t, backoff, time.Duration(float64(expected)*1.2), "attempt %d", attempt)
+	}
+}
@@ -0,0 +1,176 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// defaultTermTimeout is how long StopVMM waits for the VMM to exit after
+// SIGTERM before killing it.
+const defaultTermTimeout = 10 * time.Second
+
+// ShutdownStage identifies the step of ShutdownWithPolicy that ended the VMM.
+type ShutdownStage int
+
+const (
+	// ShutdownStageNone means that the VMM was not running, or, in ExitInfo,
+	// that the SDK did not stop it.
+	ShutdownStageNone ShutdownStage = iota
+	// ShutdownStageGuest means that the guest shut down after CtrlAltDel.
+	ShutdownStageGuest
+	// ShutdownStageTerm means that the VMM exited after SIGTERM.
+	ShutdownStageTerm
+	// ShutdownStageKill means that the VMM was killed with SIGKILL.
+	ShutdownStageKill
+)
+
+func (s ShutdownStage) String() string {
+	switch s {
+	case ShutdownStageNone:
+		return "none"
+	case ShutdownStageGuest:
+		return "guest"
+	case ShutdownStageTerm:
+		return "SIGTERM"
+	case ShutdownStageKill:
+		return "SIGKILL"
+	default:
+		return "unknown"
+	}
+}
+
+// ShutdownPolicy configures how ShutdownWithPolicy escalates when the VM does
+// not stop in time. A zero timeout skips the corresponding stage.
+type ShutdownPolicy struct {
+	// GraceTimeout is how long to wait for the guest to shut down after
+	// sending CtrlAltDel. The guest stage is always skipped on arm64, which
+	// does not support CtrlAltDel.
+	GraceTimeout time.Duration
+	// TermTimeout is how long to wait for the VMM to exit after SIGTERM
+	// before sending SIGKILL.
+	TermTimeout time.Duration
+}
+
+// ShutdownWithPolicy stops the VM, escalating from a guest-initiated shutdown
+// to SIGTERM and finally SIGKILL whenever a stage does not end the VMM within
+// its timeout. It returns once the VMM has exited and its resources have been
+// cleaned up, reporting which stage ended it.
+//
+// If ctx is done before the VMM exits, the remaining stages are skipped and the
+// VMM is killed. ctx.Err() is returned if the VMM has not exited by then.
+func (m *Machine) ShutdownWithPolicy(ctx context.Context, policy ShutdownPolicy) (stage ShutdownStage, err error) {
+	m.logger.Debug("Called machine.ShutdownWithPolicy()")
+	ctx, span := m.startSpan(ctx, "firecracker.ShutdownWithPolicy")
+	defer func() {
+		span.SetAttributes(attribute.String("firecracker.shutdown_stage", stage.String()))
+		endSpan(span, err)
+	}()
+
+	if m.vmmProcess() == nil || m.vmmExited() {
+		return ShutdownStageNone, nil
+	}
+
+	m.shutdownOnce.Do(func() { close(m.shutdownCh) })
+	m.setState(StateStopping, nil)
+
+	if policy.GraceTimeout > 0 && runtime.GOARCH != "arm64" {
+		m.markShutdownStage(ShutdownStageGuest)
+		if err := m.sendCtrlAltDel(ctx); err != nil {
+			m.logger.Warnf("guest shutdown failed, sending SIGTERM: %v", err)
+		} else if m.waitVMMExit(ctx, policy.GraceTimeout) {
+			return ShutdownStageGuest, nil
+		} else {
+			m.logger.Warnf("guest did not shut down within %s, sending SIGTERM", policy.GraceTimeout)
+		}
+	}
+
+	return m.terminateVMM(ctx, policy.TermTimeout)
+}
+
+// terminateVMM sends SIGTERM to the VMM and, unless it exits within the
+// timeout, SIGKILL. It returns once the VMM has exited and the cleanup has
+// run.
+func (m *Machine) terminateVMM(ctx context.Context, termTimeout time.Duration) (ShutdownStage, error) {
+	if termTimeout > 0 && ctx.Err() == nil {
+		m.markShutdownStage(ShutdownStageTerm)
+		if err := m.signalVMM(syscall.SIGTERM); err != nil {
+			return ShutdownStageTerm, err
+		}
+		if m.waitVMMExit(ctx, termTimeout) {
+			return ShutdownStageTerm, nil
+		}
+		m.logger.Warnf("firecracker did not exit within %s of SIGTERM, sending SIGKILL", termTimeout)
+	}
+
+	m.markShutdownStage(ShutdownStageKill)
+	if err := m.signalVMM(syscall.SIGKILL); err != nil {
+		return ShutdownStageKill, err
+	}
+
+	select {
+	case <-m.cleanupCh:
+		return ShutdownStageKill, nil
+	case <-ctx.Done():
+		return ShutdownStageKill, ctx.Err()
+	}
+}
+
+// signalVMM sends the signal to the VMM, ignoring a VMM that already exited.
+func (m *Machine) signalVMM(sig os.Signal) error {
+	process := m.vmmProcess()
+	if process == nil {
+		return nil
+	}
+
+	m.logger.Debugf("sending %s to firecracker", sig)
+	if err := process.Signal(sig); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to send %s to firecracker: %w", sig, err)
+	}
+	return nil
+}
+
+// waitVMMExit waits up to the timeout for the VMM to exit and the cleanup to
+// run. It returns false if the timeout expired or ctx is done first.
+func (m *Machine) waitVMMExit(ctx context.Context, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-m.cleanupCh:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// vmmExited returns true once the VMM has exited and the cleanup has run.
+func (m *Machine) vmmExited() bool {
+	select {
+	case <-m.cleanupCh:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"net"
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+// startShutdownTestMachine starts a Machine running the given command in place
+// of firecracker.
+func startShutdownTestMachine(t *testing.T, mockClient *fctesting.MockClient, name string, args ...string) *Machine {
+	t.Helper()
+
+	socketPath, cleanup := makeSocketPath(t)
+	t.Cleanup(cleanup)
+
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	m, err := NewMachine(
+		context.Background(),
+		Config{SocketPath: socketPath, DisableValidation: true},
+		WithClient(NewClient(socketPath, nil, false, WithOpsClient(mockClient))),
+		WithProcessRunner(exec.Command(name, args...)),
+		WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+	m.Handlers.FcInit = HandlerList{}.Append(StartVMMHandler)
+
+	require.NoError(t, m.Start(context.Background()))
+	return m
+}
+
+func TestShutdownWithPolicyGuest(t *testing.T) {
+	if runtime.GOARCH == "arm64" {
+		t.Skip("CtrlAltDel is not supported on arm64")
+	}
+
+	var m *Machine
+	mockClient := &fctesting.MockClient{
+		CreateSyncActionFn: func(params *ops.CreateSyncActionParams) (*ops.CreateSyncActionNoContent, error) {
+			// the guest reacts to CtrlAltDel by shutting down
+			if StringValue(params.Info.ActionType) == models.InstanceActionInfoActionTypeSendCtrlAltDel {
+				m.cmd.Process.Kill()
+			}
+			return &ops.CreateSyncActionNoContent{}, nil
+		},
+	}
+	m = startShutdownTestMachine(t, mockClient, "sleep", "60")
+
+	stage, err := m.ShutdownWithPolicy(context.Background(), ShutdownPolicy{
+		GraceTimeout: 5 * time.Second,
+		TermTimeout:  5 * time.Second,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ShutdownStageGuest, stage)
+	assert.Equal(t, StateExited, m.State())
+}
+
+func TestShutdownWithPolicyTerm(t *testing.T) {
+	m := startShutdownTestMachine(t, &fctesting.MockClient{}, "sleep", "60")
+
+	stage, err := m.ShutdownWithPolicy(context.Background(), ShutdownPolicy{TermTimeout: 5 * time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, ShutdownStageTerm, stage)
+	assert.Equal(t, StateExited, m.State())
+
+	// the VMM is gone, there is nothing left to do
+	stage, err = m.ShutdownWithPolicy(context.Background(), ShutdownPolicy{TermTimeout: 5 * time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, ShutdownStageNone, stage)
+}
+
+func TestShutdownWithPolicyKill(t *testing.T) {
+	mockClient := &fctesting.MockClient{
+		CreateSyncActionFn: func(params *ops.CreateSyncActionParams) (*ops.CreateSyncActionNoContent, error) {
+			return &ops.CreateSyncActionNoContent{}, nil
+		},
+	}
+	// a stuck guest that also ignores SIGTERM
+	m := startShutdownTestMachine(t, mockClient, "sh", "-c", `trap "" TERM; while :; do sleep 0.1; done`)
+
+	start := time.Now()
+	stage, err := m.ShutdownWithPolicy(context.Background(), ShutdownPolicy{
+		GraceTimeout: 100 * time.Millisecond,
+		TermTimeout:  100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ShutdownStageKill, stage)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, StateExited, m.State())
+}
+
+func TestShutdownWithPolicyContextDone(t *testing.T) {
+	m := startShutdownTestMachine(t, &fctesting.MockClient{}, "sh", "-c", `trap "" TERM; while :; do sleep 0.1; done`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// the context expires long before the TermTimeout
+	stage, err := m.ShutdownWithPolicy(ctx, ShutdownPolicy{TermTimeout: time.Minute})
+	assert.Equal(t, ShutdownStageKill, stage)
+	if err != nil {
+		assert.Equal(t, context.DeadlineExceeded, err)
+	}
+	require.Error(t, m.Wait(context.Background()))
+}
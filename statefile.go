@@ -0,0 +1,406 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containernetworking/cni/libcni"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/hashicorp/go-multierror"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// MachineStateRecordVersion is the version of the state record written by
+// WithStateDir. LoadMachineState refuses records with a newer version.
+const MachineStateRecordVersion = 1
+
+// ErrMachineRunning is returned by MachineStateRecord.Cleanup when the VMM
+// described by the record still appears to be running.
+var ErrMachineRunning = errors.New("firecracker: machine is still running")
+
+// MachineStateRecord is the persisted form of the runtime state of a Machine,
+// as written by WithStateDir. It holds everything needed to either re-attach
+// to the VMM or to release the host resources it was using.
+type MachineStateRecord struct {
+	// Version is the version of the record format.
+	Version int `json:"version"`
+	// VMID is the ID of the Machine.
+	VMID string `json:"vmid"`
+	// State is the lifecycle state of the Machine when the record was written.
+	State MachineState `json:"state"`
+	// PID is the PID of the VMM process, or 0 if it has not been started.
+	PID int `json:"pid,omitempty"`
+	// SocketPath is the path of the Firecracker API socket on the host.
+	SocketPath string `json:"socket_path"`
+	// LogFifo is the path of the log FIFO created by the SDK, if any.
+	LogFifo string `json:"log_fifo,omitempty"`
+	// MetricsFifo is the path of the metrics FIFO created by the SDK, if any.
+	MetricsFifo string `json:"metrics_fifo,omitempty"`
+	// JailerChrootDir is the directory of the jail built by the jailer, if
+	// the VMM was jailed.
+	JailerChrootDir string `json:"jailer_chroot_dir,omitempty"`
+	// NetNS is the path of the network namespace the VMM runs in, if any.
+	NetNS string `json:"netns,omitempty"`
+	// NetNSCreated is true if the network namespace was created by the SDK
+	// and must be removed with the Machine.
+	NetNSCreated bool `json:"netns_created,omitempty"`
+	// CNI describes the CNI network the Machine was attached to, if any.
+	CNI *CNIStateRecord `json:"cni,omitempty"`
+	// UpdatedAt is when the record was written.
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// path is where the record was loaded from.
+	path string
+}
+
+// CNIStateRecord holds the parameters needed to delete a CNI network that was
+// set up for a Machine.
+type CNIStateRecord struct {
+	NetworkName string `json:"network_name,omitempty"`
+	// NetworkConfig is the raw network configuration list, if it was provided
+	// directly instead of being loaded from ConfDir.
+	NetworkConfig json.RawMessage `json:"network_config,omitempty"`
+	IfName        string          `json:"ifname"`
+	Args          [][2]string     `json:"args,omitempty"`
+	BinPath       []string        `json:"bin_path"`
+	ConfDir       string          `json:"conf_dir"`
+	CacheDir      string          `json:"cache_dir"`
+	ContainerID   string          `json:"container_id"`
+	TapName       string          `json:"tap_name,omitempty"`
+}
+
+// WithStateDir makes the Machine write a MachineStateRecord to
+// <dir>/<VMID>.json whenever it transitions to another state, as well as once
+// its network has been set up and its VMM has been started. The record is
+// removed once the VMM has exited and its resources were cleaned up; records
+// of Machines that failed are kept so that their resources can be released
+// with LoadMachineState.
+func WithStateDir(dir string) Opt {
+	return func(m *Machine) {
+		m.stateDir = dir
+	}
+}
+
+// LoadMachineState reads a record written by a Machine configured with
+// WithStateDir.
+func LoadMachineState(path string) (*MachineStateRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read machine state %q: %w", path, err)
+	}
+
+	var record MachineStateRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to parse machine state %q: %w", path, err)
+	}
+
+	if record.Version > MachineStateRecordVersion {
+		return nil, fmt.Errorf("machine state %q has unsupported version %d", path, record.Version)
+	}
+
+	record.path = path
+	return &record, nil
+}
+
+// Attach re-attaches to the VMM described by the record, see AttachMachine.
+// Once the VMM exits, the resources recorded in the record are cleaned up as
+// with Cleanup. Pass WithStateDir to keep the record up to date.
+func (r *MachineStateRecord) Attach(ctx context.Context, opts ...Opt) (*Machine, error) {
+	if r.PID == 0 {
+		return nil, fmt.Errorf("machine %q has no recorded VMM process", r.VMID)
+	}
+
+	opts = append([]Opt{withStateRecord(r)}, opts...)
+	return AttachMachine(ctx, r.SocketPath, r.PID, opts...)
+}
+
+// Cleanup releases the resources described by the record: the CNI network
+// and its tap device, the network namespace, the FIFOs, the API socket and the
+// jailer directory. The record itself is removed if all of them were
+// released. ErrMachineRunning is returned if the VMM is still running.
+func (r *MachineStateRecord) Cleanup(ctx context.Context) error {
+	if r.running() {
+		return fmt.Errorf("machine %q with pid %d: %w", r.VMID, r.PID, ErrMachineRunning)
+	}
+
+	var err *multierror.Error
+	funcs := r.cleanupFuncs(ctx)
+	for i := range funcs {
+		err = multierror.Append(err, funcs[len(funcs)-1-i]())
+	}
+
+	if err.ErrorOrNil() == nil && r.path != "" {
+		if rmErr := os.Remove(r.path); rmErr != nil && !os.IsNotExist(rmErr) {
+			err = multierror.Append(err, rmErr)
+		}
+	}
+
+	return err.ErrorOrNil()
+}
+
+// running returns true if the recorded VMM process still exists. As PIDs are
+// reused, for example after a reboot, the API socket must exist as well.
+func (r *MachineStateRecord) running() bool {
+	if r.PID == 0 {
+		return false
+	}
+	if err := unix.Kill(r.PID, 0); err != nil && err != unix.EPERM {
+		return false
+	}
+	_, err := os.Stat(r.SocketPath)
+	return err == nil
+}
+
+// cleanupFuncs returns the functions releasing the recorded resources in the
+// order the resources were created, so that they must be run in reverse.
+func (r *MachineStateRecord) cleanupFuncs(ctx context.Context) []func() error {
+	var funcs []func() error
+
+	if dir := r.JailerChrootDir; dir != "" {
+		funcs = append(funcs, func() error {
+			if err := os.RemoveAll(dir); err != nil {
+				return fmt.Errorf("failed to remove jailer directory %q: %w", dir, err)
+			}
+			return nil
+		})
+	}
+
+	if netNSPath := r.NetNS; netNSPath != "" && r.NetNSCreated {
+		funcs = append(funcs, func() error {
+			if err := unix.Unmount(netNSPath, unix.MNT_DETACH); err != nil && err != unix.EINVAL && err != unix.ENOENT {
+				return fmt.Errorf("failed to unmount netns at %q: %w", netNSPath, err)
+			}
+			if err := os.Remove(netNSPath); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove netns path %q: %w", netNSPath, err)
+			}
+			return nil
+		})
+	}
+
+	if cni := r.CNI; cni != nil {
+		if cni.TapName != "" && r.NetNS != "" {
+			funcs = append(funcs, func() error {
+				return deleteTap(r.NetNS, cni.TapName)
+			})
+		}
+		funcs = append(funcs, func() error {
+			return cni.delNetwork(ctx, r.NetNS)
+		})
+	}
+
+	for _, path := range []string{r.LogFifo, r.MetricsFifo, r.SocketPath} {
+		if path == "" {
+			continue
+		}
+
+		path := path
+		funcs = append(funcs, func() error {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			return nil
+		})
+	}
+
+	return funcs
+}
+
+// delNetwork deletes the recorded CNI network, releasing its IPAM allocations.
+func (c *CNIStateRecord) delNetwork(ctx context.Context, netNSPath string) error {
+	var (
+		networkConf *libcni.NetworkConfigList
+		err         error
+	)
+	if len(c.NetworkConfig) > 0 {
+		networkConf, err = libcni.ConfListFromBytes(c.NetworkConfig)
+	} else {
+		networkConf, err = libcni.LoadConfList(c.ConfDir, c.NetworkName)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load CNI configuration for network %q: %w", c.NetworkName, err)
+	}
+
+	// Plugins are expected to tolerate a netns that no longer exists, which
+	// is the case after a reboot.
+	if ns.IsNSorErr(netNSPath) != nil {
+		netNSPath = ""
+	}
+
+	cniPlugin := libcni.NewCNIConfigWithCacheDir(c.BinPath, c.CacheDir, nil)
+	err = cniPlugin.DelNetworkList(ctx, networkConf, &libcni.RuntimeConf{
+		ContainerID: c.ContainerID,
+		NetNS:       netNSPath,
+		IfName:      c.IfName,
+		Args:        c.Args,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete CNI network list %q: %w", networkConf.Name, err)
+	}
+	return nil
+}
+
+// deleteTap deletes the tap device from the network namespace, if both still
+// exist.
+func deleteTap(netNSPath, tapName string) error {
+	if ns.IsNSorErr(netNSPath) != nil {
+		return nil
+	}
+
+	return ns.WithNetNSPath(netNSPath, func(_ ns.NetNS) error {
+		link, err := netlink.LinkByName(tapName)
+		if err != nil {
+			var notFound netlink.LinkNotFoundError
+			if errors.As(err, &notFound) {
+				return nil
+			}
+			return fmt.Errorf("failed to find tap device %q: %w", tapName, err)
+		}
+		if err := netlink.LinkDel(link); err != nil {
+			return fmt.Errorf("failed to delete tap device %q: %w", tapName, err)
+		}
+		return nil
+	})
+}
+
+// stateRecordPath returns the path of the Machine's state record.
+func (m *Machine) stateRecordPath() string {
+	return filepath.Join(m.stateDir, m.Cfg.VMID+".json")
+}
+
+// persistState writes the state record of the Machine in its current state.
+func (m *Machine) persistState() {
+	m.stateMu.Lock()
+	defer m.stateMu.Unlock()
+
+	m.writeStateRecord(m.state)
+}
+
+// writeStateRecord writes the state record of the Machine in the given state,
+// or removes it once the Machine has exited. The caller must hold stateMu.
+func (m *Machine) writeStateRecord(state MachineState) {
+	if m.stateDir == "" {
+		return
+	}
+
+	path := m.stateRecordPath()
+	if state == StateExited {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			m.logger.Warnf("failed to remove machine state %q: %v", path, err)
+		}
+		return
+	}
+
+	data, err := json.MarshalIndent(m.stateRecord(state), "", "  ")
+	if err == nil {
+		err = writeFileAtomic(path, data)
+	}
+	if err != nil {
+		m.logger.Warnf("failed to write machine state %q: %v", path, err)
+	}
+}
+
+// stateRecord builds the state record of the Machine in the given state.
+func (m *Machine) stateRecord(state MachineState) *MachineStateRecord {
+	record := &MachineStateRecord{
+		Version:     MachineStateRecordVersion,
+		VMID:        m.Cfg.VMID,
+		State:       state,
+		SocketPath:  m.Cfg.SocketPath,
+		LogFifo:     m.Cfg.LogFifo,
+		MetricsFifo: m.Cfg.MetricsFifo,
+		NetNS:       m.Cfg.NetNS,
+		UpdatedAt:   time.Now(),
+	}
+
+	if process := m.vmmProcess(); process != nil {
+		record.PID = process.Pid
+	}
+
+	if jailerCfg := m.Cfg.JailerCfg; jailerCfg != nil {
+		baseDir := jailerCfg.ChrootBaseDir
+		if baseDir == "" {
+			baseDir = defaultJailerPath
+		}
+		record.JailerChrootDir = filepath.Join(baseDir, filepath.Base(jailerCfg.ExecFile), jailerCfg.ID)
+	}
+
+	if iface := m.Cfg.NetworkInterfaces.cniInterface(); iface != nil {
+		// the defaults are only applied once the network is set up
+		cniConf := *iface.CNIConfiguration
+		cniConf.containerID = m.Cfg.VMID
+		cniConf.setDefaults()
+
+		record.NetNSCreated = m.Cfg.NetNS == m.defaultNetNSPath()
+		record.CNI = &CNIStateRecord{
+			NetworkName: cniConf.NetworkName,
+			IfName:      cniConf.IfName,
+			Args:        cniConf.Args,
+			BinPath:     cniConf.BinPath,
+			ConfDir:     cniConf.ConfDir,
+			CacheDir:    cniConf.CacheDir,
+			ContainerID: cniConf.containerID,
+		}
+		if cniConf.NetworkConfig != nil {
+			record.CNI.NetworkConfig = cniConf.NetworkConfig.Bytes
+		}
+		if iface.StaticConfiguration != nil {
+			record.CNI.TapName = iface.StaticConfiguration.HostDevName
+		}
+	}
+
+	// Machines re-attached from a record keep the facts the VMM can't report.
+	if recovered := m.recoveredState; recovered != nil {
+		record.JailerChrootDir = recovered.JailerChrootDir
+		record.NetNS = recovered.NetNS
+		record.NetNSCreated = recovered.NetNSCreated
+		record.CNI = recovered.CNI
+	}
+
+	return record
+}
+
+// withStateRecord makes AttachMachine take the resources to clean up from the
+// record.
+func withStateRecord(record *MachineStateRecord) Opt {
+	return func(m *Machine) {
+		m.recoveredState = record
+	}
+}
+
+// writeFileAtomic writes the file through a rename so that readers never see
+// a partially written record.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
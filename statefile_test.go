@@ -0,0 +1,193 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+func writeStateRecord(t *testing.T, path string, record MachineStateRecord) {
+	t.Helper()
+
+	data, err := json.Marshal(record)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0600))
+}
+
+func TestWithStateDir(t *testing.T) {
+	socketPath, cleanup := makeSocketPath(t)
+	defer cleanup()
+
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	stateDir := filepath.Dir(socketPath)
+	ctx := context.Background()
+	m, err := NewMachine(
+		ctx,
+		Config{SocketPath: socketPath, DisableValidation: true, VMID: "state-vm"},
+		WithClient(NewClient(socketPath, nil, false, WithOpsClient(&fctesting.MockClient{}))),
+		WithProcessRunner(exec.Command("sleep", "60")),
+		WithLogger(fctesting.NewLogEntry(t)),
+		WithStateDir(stateDir),
+	)
+	require.NoError(t, err)
+	m.Handlers.FcInit = HandlerList{}.Append(StartVMMHandler)
+
+	require.NoError(t, m.Start(ctx))
+
+	recordPath := filepath.Join(stateDir, "state-vm.json")
+	record, err := LoadMachineState(recordPath)
+	require.NoError(t, err)
+	assert.Equal(t, MachineStateRecordVersion, record.Version)
+	assert.Equal(t, "state-vm", record.VMID)
+	assert.Equal(t, StateRunning, record.State)
+	assert.Equal(t, m.cmd.Process.Pid, record.PID)
+	assert.Equal(t, socketPath, record.SocketPath)
+	assert.True(t, errors.Is(record.Cleanup(ctx), ErrMachineRunning))
+
+	require.NoError(t, m.PauseVM(ctx))
+	record, err = LoadMachineState(recordPath)
+	require.NoError(t, err)
+	assert.Equal(t, StatePaused, record.State)
+
+	require.NoError(t, m.StopVMM())
+	m.Wait(ctx)
+
+	_, err = os.Stat(recordPath)
+	assert.True(t, os.IsNotExist(err), "expected the state record to be removed, got %v", err)
+}
+
+func TestLoadMachineStateUnsupportedVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vm.json")
+	writeStateRecord(t, path, MachineStateRecord{Version: MachineStateRecordVersion + 1, VMID: "vm"})
+
+	_, err := LoadMachineState(path)
+	assert.Error(t, err)
+}
+
+func TestMachineStateRecordCleanup(t *testing.T) {
+	dir := t.TempDir()
+
+	socketPath := filepath.Join(dir, "fc.sock")
+	require.NoError(t, os.WriteFile(socketPath, nil, 0600))
+	logFifo := filepath.Join(dir, "log.fifo")
+	require.NoError(t, syscall.Mkfifo(logFifo, 0700))
+	chrootDir := filepath.Join(dir, "jailer", "firecracker", "vm")
+	require.NoError(t, os.MkdirAll(filepath.Join(chrootDir, rootfsFolderName), 0700))
+
+	// the process is gone, e.g. after a reboot
+	cmd := exec.Command("true")
+	require.NoError(t, cmd.Run())
+
+	recordPath := filepath.Join(dir, "vm.json")
+	writeStateRecord(t, recordPath, MachineStateRecord{
+		Version:         MachineStateRecordVersion,
+		VMID:            "vm",
+		State:           StateRunning,
+		PID:             cmd.Process.Pid,
+		SocketPath:      socketPath,
+		LogFifo:         logFifo,
+		JailerChrootDir: chrootDir,
+	})
+
+	record, err := LoadMachineState(recordPath)
+	require.NoError(t, err)
+	require.NoError(t, record.Cleanup(context.Background()))
+
+	for _, path := range []string{socketPath, logFifo, chrootDir, recordPath} {
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err), "expected %q to be removed, got %v", path, err)
+	}
+}
+
+func TestMachineStateRecordAttach(t *testing.T) {
+	socketPath, cleanup := makeSocketPath(t)
+	defer cleanup()
+
+	listener, err := net.Listen("unix", socketPath)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	dir := filepath.Dir(socketPath)
+	metricsFifo := filepath.Join(dir, "metrics.fifo")
+	require.NoError(t, syscall.Mkfifo(metricsFifo, 0700))
+
+	cmd := exec.Command("sleep", "60")
+	require.NoError(t, cmd.Start())
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	defer cmd.Process.Kill()
+
+	recordPath := filepath.Join(dir, "vm.json")
+	writeStateRecord(t, recordPath, MachineStateRecord{
+		Version:     MachineStateRecordVersion,
+		VMID:        "vm",
+		State:       StateRunning,
+		PID:         cmd.Process.Pid,
+		SocketPath:  socketPath,
+		MetricsFifo: metricsFifo,
+	})
+
+	mockClient := fctesting.MockClient{
+		DescribeInstanceFn: func(params *ops.DescribeInstanceParams) (*ops.DescribeInstanceOK, error) {
+			return &ops.DescribeInstanceOK{Payload: &models.InstanceInfo{
+				ID:    String("vm"),
+				State: String(models.InstanceInfoStateRunning),
+			}}, nil
+		},
+		GetExportVMConfigFn: func(params *ops.GetExportVMConfigParams) (*ops.GetExportVMConfigOK, error) {
+			return &ops.GetExportVMConfigOK{Payload: &models.FullVMConfiguration{}}, nil
+		},
+	}
+
+	record, err := LoadMachineState(recordPath)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	m, err := record.Attach(ctx,
+		WithClient(NewClient(socketPath, nil, false, WithOpsClient(&mockClient))),
+		WithLogger(fctesting.NewLogEntry(t)),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, StateRunning, m.State())
+
+	require.NoError(t, m.StopVMM())
+	<-exited
+	require.NoError(t, m.Wait(ctx))
+
+	for _, path := range []string{socketPath, metricsFifo, recordPath} {
+		_, err := os.Stat(path)
+		assert.True(t, os.IsNotExist(err), "expected %q to be removed, got %v", path, err)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+)
+
+// tracerName is the instrumentation scope of the spans of the SDK.
+const tracerName = "github.com/firecracker-microvm/firecracker-go-sdk"
+
+// Attributes of the spans of the SDK.
+const (
+	vmIDAttribute       = attribute.Key("firecracker.vmid")
+	operationAttribute  = attribute.Key("firecracker.operation")
+	attemptAttribute    = attribute.Key("firecracker.attempt")
+	driveIDAttribute    = attribute.Key("firecracker.drive_id")
+	ifaceIDAttribute    = attribute.Key("firecracker.iface_id")
+	statusCodeAttribute = attribute.Key("http.response.status_code")
+)
+
+// WithTracerProvider traces the machine with OpenTelemetry. Start is a span,
+// with a child span for every handler it runs, named after the handler, and
+// a grandchild span for every request sent to the Firecracker API. Pausing,
+// resuming, shutting down the VM and creating or loading snapshots are traced
+// as well. By default, nothing is traced.
+func WithTracerProvider(provider trace.TracerProvider) Opt {
+	return func(m *Machine) {
+		m.tracer = provider.Tracer(tracerName, trace.WithInstrumentationVersion(Version))
+	}
+}
+
+// vmIDKey is the context key of the ID of the VM the API requests are sent
+// for.
+type vmIDKey struct{}
+
+// startSpan starts a span of the machine. The spans of the API requests sent
+// with the returned context are its children.
+func (m *Machine) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := m.tracer
+	if tracer == nil {
+		tracer = noop.NewTracerProvider().Tracer(tracerName)
+	}
+
+	ctx = context.WithValue(ctx, vmIDKey{}, m.Cfg.VMID)
+	attrs = append(attrs, vmIDAttribute.String(m.Cfg.VMID))
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err, if any, and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startAPISpan starts the span of an attempt of an API request. Requests are
+// only traced when ctx carries a span, which is the case for those sent by a
+// traced Machine.
+func startAPISpan(ctx context.Context, call *APICall, params requestParams) (context.Context, trace.Span) {
+	parent := trace.SpanFromContext(ctx)
+	if !parent.SpanContext().IsValid() {
+		return ctx, parent
+	}
+
+	attrs := []attribute.KeyValue{
+		operationAttribute.String(call.Operation),
+		attemptAttribute.Int(call.Attempt),
+	}
+	if vmID, ok := ctx.Value(vmIDKey{}).(string); ok {
+		attrs = append(attrs, vmIDAttribute.String(vmID))
+	}
+
+	switch p := params.(type) {
+	case *ops.PutGuestDriveByIDParams:
+		attrs = append(attrs, driveIDAttribute.String(p.DriveID))
+	case *ops.PatchGuestDriveByIDParams:
+		attrs = append(attrs, driveIDAttribute.String(p.DriveID))
+	case *ops.PutGuestNetworkInterfaceByIDParams:
+		attrs = append(attrs, ifaceIDAttribute.String(p.IfaceID))
+	case *ops.PatchGuestNetworkInterfaceByIDParams:
+		attrs = append(attrs, ifaceIDAttribute.String(p.IfaceID))
+	}
+
+	tracer := parent.TracerProvider().Tracer(tracerName, trace.WithInstrumentationVersion(Version))
+	return tracer.Start(ctx, "firecracker.api."+call.Operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// endAPISpan records the outcome of an API request and ends its span.
+func endAPISpan(span trace.Span, call *APICall, err error) {
+	if !span.IsRecording() {
+		return
+	}
+
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode != 0:
+		span.SetAttributes(statusCodeAttribute.Int(apiErr.StatusCode))
+	case err == nil && call.Response != nil:
+		if code := responseStatusCode(call.Response); code != 0 {
+			span.SetAttributes(statusCodeAttribute.Int(code))
+		}
+	}
+	endSpan(span, err)
+}
@@ -0,0 +1,108 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+	ops "github.com/firecracker-microvm/firecracker-go-sdk/client/operations"
+	"github.com/firecracker-microvm/firecracker-go-sdk/fctesting"
+)
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestWithTracerProvider(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	client := NewClient("/path/to/socket", nil, false, WithOpsClient(&fctesting.MockClient{
+		PatchVMFn: func(params *ops.PatchVMParams) (*ops.PatchVMNoContent, error) {
+			return nil, &ops.PatchVMBadRequest{Payload: &models.Error{FaultMessage: "Invalid state"}}
+		},
+	}))
+	m := newLifecycleTestMachine(t, WithClient(client), WithTracerProvider(provider))
+	m.Cfg.VMID = "traced-vm"
+	m.Handlers.FcInit = m.Handlers.FcInit.Append(Handler{
+		Name: "test.AttachDrive",
+		Fn: func(ctx context.Context, m *Machine) error {
+			drive := NewDrivesBuilder("/rootfs").Build()[0]
+			_, err := m.client.PutGuestDriveByID(ctx, "root_drive", &drive)
+			return err
+		},
+	})
+
+	require.NoError(t, m.Start(context.Background()))
+	defer m.Close()
+	assert.Error(t, m.PauseVM(context.Background()))
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	start := spans["firecracker.Start"]
+	require.NotNil(t, start)
+	assert.False(t, start.Parent().IsValid())
+	assert.Equal(t, "traced-vm", spanAttributes(start)[vmIDAttribute].AsString())
+
+	handler := spans["test.AttachDrive"]
+	require.NotNil(t, handler)
+	assert.Equal(t, start.SpanContext().SpanID(), handler.Parent().SpanID())
+	require.NotNil(t, spans[StartVMMHandlerName])
+	assert.Equal(t, start.SpanContext().SpanID(), spans[StartVMMHandlerName].Parent().SpanID())
+
+	api := spans["firecracker.api.PutGuestDriveByID"]
+	require.NotNil(t, api)
+	assert.Equal(t, handler.SpanContext().SpanID(), api.Parent().SpanID())
+	attrs := spanAttributes(api)
+	assert.Equal(t, "root_drive", attrs[driveIDAttribute].AsString())
+	assert.Equal(t, "traced-vm", attrs[vmIDAttribute].AsString())
+	assert.Equal(t, int64(1), attrs[attemptAttribute].AsInt64())
+	assert.Equal(t, int64(204), attrs[statusCodeAttribute].AsInt64())
+
+	pause := spans["firecracker.PauseVM"]
+	require.NotNil(t, pause)
+	assert.Equal(t, codes.Error, pause.Status().Code)
+	patch := spans["firecracker.api.PatchVM"]
+	require.NotNil(t, patch)
+	assert.Equal(t, pause.SpanContext().SpanID(), patch.Parent().SpanID())
+	assert.Equal(t, codes.Error, patch.Status().Code)
+	assert.Equal(t, int64(400), spanAttributes(patch)[statusCodeAttribute].AsInt64())
+}
+
+func TestTracingDisabledByDefault(t *testing.T) {
+	m := newLifecycleTestMachine(t)
+	ctx, span := m.startSpan(context.Background(), "firecracker.Start")
+	assert.False(t, span.IsRecording())
+
+	call := &APICall{Operation: "GetMachineConfiguration", Attempt: 1}
+	_, apiSpan := startAPISpan(ctx, call, ops.NewGetMachineConfigurationParams())
+	assert.False(t, apiSpan.IsRecording())
+	assert.False(t, apiSpan.SpanContext().IsValid(), "API calls are only traced below a span of the machine")
+}
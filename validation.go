@@ -0,0 +1,344 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+)
+
+const (
+	// maxVcpuCount is the highest number of vCPUs Firecracker supports.
+	maxVcpuCount = 32
+	// maxJailerIDLength is the longest ID the jailer accepts.
+	maxJailerIDLength = 64
+)
+
+// FieldError describes a problem with a field of a Config.
+type FieldError struct {
+	// Field is the path of the field, such as Drives[2].DriveID.
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors lists every problem found while validating a Config.
+type ValidationErrors []*FieldError
+
+func (e ValidationErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d invalid fields: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Field returns the error of the field with the given path, or nil if the
+// field is valid.
+func (e ValidationErrors) Field(field string) *FieldError {
+	for _, err := range e {
+		if err.Field == field {
+			return err
+		}
+	}
+	return nil
+}
+
+// validator collects the problems found in a Config.
+type validator struct {
+	errs ValidationErrors
+}
+
+func (v *validator) add(field string, err error) {
+	v.errs = append(v.errs, &FieldError{Field: field, Err: err})
+}
+
+func (v *validator) addf(field, format string, args ...interface{}) {
+	v.add(field, fmt.Errorf(format, args...))
+}
+
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// validateFiles checks that the files the VMM reads exist and that its
+// socket does not.
+func (cfg *Config) validateFiles(v *validator) {
+	if _, err := os.Stat(cfg.KernelImagePath); err != nil {
+		v.addf("KernelImagePath", "failed to stat kernel image path, %q: %v", cfg.KernelImagePath, err)
+	}
+
+	if cfg.InitrdPath != "" {
+		if _, err := os.Stat(cfg.InitrdPath); err != nil {
+			v.addf("InitrdPath", "failed to stat initrd image path, %q: %v", cfg.InitrdPath, err)
+		}
+	}
+
+	for i, drive := range cfg.Drives {
+		if BoolValue(drive.IsRootDevice) {
+			rootPath := StringValue(drive.PathOnHost)
+			if _, err := os.Stat(rootPath); err != nil {
+				v.addf(fmt.Sprintf("Drives[%d].PathOnHost", i), "failed to stat host drive path, %q: %v", rootPath, err)
+			}
+
+			break
+		}
+	}
+
+	if _, err := os.Stat(cfg.SocketPath); err == nil {
+		v.addf("SocketPath", "socket %s already exists", cfg.SocketPath)
+	}
+}
+
+// validateDevices checks the consistency of the VM definition.
+func (cfg *Config) validateDevices(v *validator) {
+	cfg.validateMachineCfg(v)
+	cfg.validateDrives(v)
+
+	for i, iface := range cfg.NetworkInterfaces {
+		field := fmt.Sprintf("NetworkInterfaces[%d]", i)
+		if static := iface.StaticConfiguration; static != nil && static.MacAddress != "" {
+			if _, err := net.ParseMAC(static.MacAddress); err != nil {
+				v.addf(field+".StaticConfiguration.MacAddress", "invalid MAC address %q", static.MacAddress)
+			}
+		}
+		validateRateLimiter(v, field+".InRateLimiter", iface.InRateLimiter)
+		validateRateLimiter(v, field+".OutRateLimiter", iface.OutRateLimiter)
+	}
+
+	if len(cfg.VsockDevices) > 1 {
+		v.addf("VsockDevices", "Firecracker supports a single vsock device, got %d", len(cfg.VsockDevices))
+	}
+	for i, dev := range cfg.VsockDevices {
+		// CIDs 0 to 2 are reserved for the hypervisor and the host
+		if dev.CID < 3 {
+			v.addf(fmt.Sprintf("VsockDevices[%d].CID", i), "guest CID must be at least 3, got %d", dev.CID)
+		}
+	}
+
+	if cfg.MmdsAddress != nil {
+		if cfg.MmdsAddress.To4() == nil || !cfg.MmdsAddress.IsLinkLocalUnicast() {
+			v.addf("MmdsAddress", "%s is not an IPv4 link-local address (169.254.0.0/16)", cfg.MmdsAddress)
+		}
+	}
+
+	cfg.validateKernelArgs(v)
+
+	if cfg.JailerCfg != nil {
+		validateJailerID(v, cfg.JailerCfg.ID)
+	}
+
+	cfg.validateCapabilities(v)
+}
+
+func (cfg *Config) validateMachineCfg(v *validator) {
+	vcpus := Int64Value(cfg.MachineCfg.VcpuCount)
+	switch {
+	case vcpus < 1:
+		v.addf("MachineCfg.VcpuCount", "machine needs a nonzero VcpuCount")
+	case vcpus > maxVcpuCount:
+		v.addf("MachineCfg.VcpuCount", "at most %d vCPUs are supported, got %d", maxVcpuCount, vcpus)
+	case BoolValue(cfg.MachineCfg.Smt) && vcpus > 1 && vcpus%2 != 0:
+		v.addf("MachineCfg.VcpuCount", "must be 1 or an even number when SMT is enabled, got %d", vcpus)
+	}
+
+	if Int64Value(cfg.MachineCfg.MemSizeMib) < 1 {
+		v.addf("MachineCfg.MemSizeMib", "machine needs a nonzero amount of memory")
+	}
+}
+
+func (cfg *Config) validateDrives(v *validator) {
+	ids := map[string]int{}
+	rootDrive := -1
+	for i, drive := range cfg.Drives {
+		field := fmt.Sprintf("Drives[%d]", i)
+
+		id := StringValue(drive.DriveID)
+		if id == "" {
+			v.addf(field+".DriveID", "required")
+		} else if first, ok := ids[id]; ok {
+			v.addf(field+".DriveID", "duplicate drive ID %q, already used by Drives[%d]", id, first)
+		} else {
+			ids[id] = i
+		}
+
+		if BoolValue(drive.IsRootDevice) {
+			if rootDrive >= 0 {
+				v.addf(field+".IsRootDevice", "only one root device is supported, Drives[%d] is one already", rootDrive)
+			} else {
+				rootDrive = i
+			}
+		}
+
+		validateRateLimiter(v, field+".RateLimiter", drive.RateLimiter)
+	}
+}
+
+// validateKernelArgs reports the kernel arguments which conflict with the ones
+// Firecracker sets for the root device. Firecracker always attaches the root
+// device first, as /dev/vda, unless it is identified by its partition UUID.
+func (cfg *Config) validateKernelArgs(v *validator) {
+	args := parseKernelArgs(cfg.KernelArgs)
+	for i, drive := range cfg.Drives {
+		if !BoolValue(drive.IsRootDevice) {
+			continue
+		}
+
+		want := "/dev/vda"
+		if drive.Partuuid != "" {
+			want = "PARTUUID=" + drive.Partuuid
+		}
+		if root, ok := args["root"]; ok && StringValue(root) != want {
+			v.addf("KernelArgs", "root=%s conflicts with the root device Drives[%d], Firecracker sets root=%s", StringValue(root), i, want)
+		}
+
+		_, ro := args["ro"]
+		_, rw := args["rw"]
+		if readOnly := BoolValue(drive.IsReadOnly); (ro && !readOnly) || (rw && readOnly) {
+			v.addf("KernelArgs", "ro and rw conflict with Drives[%d].IsReadOnly, Firecracker sets them", i)
+		}
+		break
+	}
+}
+
+func validateRateLimiter(v *validator, field string, limiter *models.RateLimiter) {
+	if limiter == nil {
+		return
+	}
+	validateTokenBucket(v, field+".Bandwidth", limiter.Bandwidth)
+	validateTokenBucket(v, field+".Ops", limiter.Ops)
+}
+
+func validateTokenBucket(v *validator, field string, bucket *models.TokenBucket) {
+	// An empty bucket, as built by NewRateLimiter for an unused limit, leaves
+	// the limit disabled.
+	if bucket == nil || (bucket.Size == nil && bucket.RefillTime == nil && bucket.OneTimeBurst == nil) {
+		return
+	}
+
+	switch {
+	case bucket.Size == nil:
+		v.addf(field+".Size", "required")
+	case *bucket.Size < 0:
+		v.addf(field+".Size", "must not be negative, got %d", *bucket.Size)
+	}
+
+	switch {
+	case bucket.RefillTime == nil:
+		v.addf(field+".RefillTime", "required")
+	case *bucket.RefillTime < 0:
+		v.addf(field+".RefillTime", "must not be negative, got %d", *bucket.RefillTime)
+	}
+
+	if Int64Value(bucket.OneTimeBurst) < 0 {
+		v.addf(field+".OneTimeBurst", "must not be negative, got %d", *bucket.OneTimeBurst)
+	}
+
+	// Firecracker silently disables a bucket with a zero size or refill time.
+	size, refill := Int64Value(bucket.Size), Int64Value(bucket.RefillTime)
+	if (size == 0) != (refill == 0) {
+		v.addf(field, "the bucket is disabled unless both Size and RefillTime are nonzero")
+	}
+}
+
+// validateJailerID checks the ID against the rules of the jailer.
+func validateJailerID(v *validator, id string) {
+	if len(id) > maxJailerIDLength {
+		v.addf("JailerCfg.ID", "must be at most %d characters long, got %d", maxJailerIDLength, len(id))
+	}
+
+	for _, c := range id {
+		if c != '-' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') {
+			v.addf("JailerCfg.ID", "may only contain alphanumeric characters and hyphens, got %q", id)
+			return
+		}
+	}
+}
+
+// validateJailerCfg checks the fields the jailer requires.
+func (cfg *Config) validateJailerCfg(v *validator) {
+	hasRoot := cfg.InitrdPath != ""
+	for _, drive := range cfg.Drives {
+		if BoolValue(drive.IsRootDevice) {
+			hasRoot = true
+			break
+		}
+	}
+
+	if !hasRoot {
+		v.addf("Drives", "A root drive must be present in the drive list")
+	}
+
+	jailerCfg := cfg.JailerCfg
+	if jailerCfg.ChrootStrategy == nil {
+		v.addf("JailerCfg.ChrootStrategy", "ChrootStrategy cannot be nil")
+	}
+
+	if len(jailerCfg.ExecFile) == 0 {
+		v.addf("JailerCfg.ExecFile", "exec file must be specified when using jailer mode")
+	}
+
+	if len(jailerCfg.ID) == 0 {
+		v.addf("JailerCfg.ID", "id must be specified when using jailer mode")
+	}
+
+	if jailerCfg.GID == nil {
+		v.addf("JailerCfg.GID", "GID must be specified when using jailer mode")
+	}
+
+	if jailerCfg.UID == nil {
+		v.addf("JailerCfg.UID", "UID must be specified when using jailer mode")
+	}
+
+	if jailerCfg.NumaNode == nil {
+		v.addf("JailerCfg.NumaNode", "NumaNode must be specified when using jailer mode")
+	}
+}
+
+// ValidateJailer is like Validate for a VM started with the jailer: the
+// files are not checked, as they are only linked into the chroot once the
+// machine starts, but the fields the jailer requires are. It returns
+// ValidationErrors listing every problem found.
+func (cfg *Config) ValidateJailer() error {
+	if cfg.DisableValidation {
+		return nil
+	}
+	if cfg.JailerCfg == nil {
+		return errors.New("JailerCfg is not set")
+	}
+
+	var v validator
+	cfg.validateJailerCfg(&v)
+	cfg.validateDevices(&v)
+	return v.err()
+}
@@ -0,0 +1,195 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+)
+
+func validTestConfig(t *testing.T) Config {
+	dir := t.TempDir()
+	kernel := filepath.Join(dir, "vmlinux")
+	rootfs := filepath.Join(dir, "rootfs.ext4")
+	require.NoError(t, os.WriteFile(kernel, nil, 0644))
+	require.NoError(t, os.WriteFile(rootfs, nil, 0644))
+
+	return Config{
+		SocketPath:      filepath.Join(dir, "fc.sock"),
+		KernelImagePath: kernel,
+		KernelArgs:      "console=ttyS0 reboot=k",
+		Drives:          NewDrivesBuilder(rootfs).AddDrive(rootfs, true).Build(),
+		MachineCfg: models.MachineConfiguration{
+			VcpuCount:  Int64(2),
+			MemSizeMib: Int64(256),
+			Smt:        Bool(true),
+		},
+		NetworkInterfaces: NetworkInterfaces{{
+			StaticConfiguration: &StaticNetworkConfiguration{MacAddress: "02:00:00:00:00:01", HostDevName: "tap0"},
+			InRateLimiter:       NewRateLimiter(TokenBucketBuilder{}.WithBucketSize(1024).WithRefillDuration(time.Second).Build(), models.TokenBucket{}),
+		}},
+		VsockDevices: []VsockDevice{{Path: "v.sock", CID: 3}},
+		MmdsAddress:  net.IPv4(169, 254, 169, 254),
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := validTestConfig(t)
+	require.NoError(t, cfg.Validate())
+
+	// the arguments Firecracker sets for the root device may be repeated
+	cfg.KernelArgs += " root=/dev/vda rw"
+	require.NoError(t, cfg.Validate())
+	cfg.Drives[len(cfg.Drives)-1].Partuuid = "4f68bce3-e8cd-4db1-96e7-fbcaf984b709-01"
+	cfg.KernelArgs = "console=ttyS0 root=PARTUUID=4f68bce3-e8cd-4db1-96e7-fbcaf984b709-01"
+	require.NoError(t, cfg.Validate())
+
+	cases := []struct {
+		name   string
+		modify func(cfg *Config)
+		fields []string
+	}{
+		{
+			name: "missing files",
+			modify: func(cfg *Config) {
+				cfg.KernelImagePath = "/does/not/exist"
+				cfg.Drives = NewDrivesBuilder("/does/not/exist").Build()
+			},
+			fields: []string{"KernelImagePath", "Drives[0].PathOnHost"},
+		},
+		{
+			name: "drives",
+			modify: func(cfg *Config) {
+				cfg.Drives = append(cfg.Drives,
+					models.Drive{DriveID: String("0"), PathOnHost: String("/data"), IsRootDevice: Bool(false)},
+					models.Drive{DriveID: String("second_root"), PathOnHost: cfg.Drives[1].PathOnHost, IsRootDevice: Bool(true)},
+					models.Drive{PathOnHost: String("/data")},
+				)
+			},
+			fields: []string{"Drives[2].DriveID", "Drives[3].IsRootDevice", "Drives[4].DriveID"},
+		},
+		{
+			name: "vcpus with SMT",
+			modify: func(cfg *Config) {
+				cfg.MachineCfg.VcpuCount = Int64(3)
+			},
+			fields: []string{"MachineCfg.VcpuCount"},
+		},
+		{
+			name: "too many vcpus",
+			modify: func(cfg *Config) {
+				cfg.MachineCfg.VcpuCount = Int64(34)
+				cfg.MachineCfg.MemSizeMib = nil
+			},
+			fields: []string{"MachineCfg.VcpuCount", "MachineCfg.MemSizeMib"},
+		},
+		{
+			name: "network interfaces",
+			modify: func(cfg *Config) {
+				cfg.NetworkInterfaces[0].StaticConfiguration.MacAddress = "02:00:00:00:00"
+				cfg.NetworkInterfaces[0].InRateLimiter = &models.RateLimiter{
+					Bandwidth: &models.TokenBucket{Size: Int64(-1), RefillTime: Int64(10)},
+					Ops:       &models.TokenBucket{Size: Int64(100), RefillTime: Int64(0)},
+				}
+			},
+			fields: []string{
+				"NetworkInterfaces[0].StaticConfiguration.MacAddress",
+				"NetworkInterfaces[0].InRateLimiter.Bandwidth.Size",
+				"NetworkInterfaces[0].InRateLimiter.Ops",
+			},
+		},
+		{
+			name: "vsock",
+			modify: func(cfg *Config) {
+				cfg.VsockDevices = append(cfg.VsockDevices, VsockDevice{Path: "w.sock", CID: 2})
+			},
+			fields: []string{"VsockDevices", "VsockDevices[1].CID"},
+		},
+		{
+			name: "mmds address",
+			modify: func(cfg *Config) {
+				cfg.MmdsAddress = net.IPv4(10, 0, 0, 1)
+			},
+			fields: []string{"MmdsAddress"},
+		},
+		{
+			name: "kernel args",
+			modify: func(cfg *Config) {
+				cfg.KernelArgs += " root=/dev/vdb ro"
+			},
+			fields: []string{"KernelArgs", "KernelArgs"},
+		},
+		{
+			name: "jailer id",
+			modify: func(cfg *Config) {
+				cfg.JailerCfg = &JailerConfig{ID: strings.Repeat("a", 65) + "_"}
+			},
+			fields: []string{"JailerCfg.ID", "JailerCfg.ID"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			cfg := validTestConfig(t)
+			c.modify(&cfg)
+
+			err := cfg.Validate()
+			var errs ValidationErrors
+			require.True(t, errors.As(err, &errs), "unexpected error %v", err)
+
+			var fields []string
+			for _, e := range errs {
+				fields = append(fields, e.Field)
+			}
+			assert.Equal(t, c.fields, fields)
+			assert.NotNil(t, errs.Field(c.fields[0]))
+		})
+	}
+}
+
+func TestValidateJailer(t *testing.T) {
+	cfg := validTestConfig(t)
+	cfg.KernelImagePath = "/only/in/the/chroot"
+	cfg.JailerCfg = &JailerConfig{
+		ID:             "vm-1",
+		UID:            Int(123),
+		GID:            Int(100),
+		NumaNode:       Int(0),
+		ExecFile:       "/usr/bin/firecracker",
+		ChrootStrategy: NewNaiveChrootStrategy(cfg.KernelImagePath),
+	}
+	require.NoError(t, cfg.ValidateJailer())
+
+	cfg.JailerCfg.ExecFile = ""
+	cfg.JailerCfg.UID = nil
+	cfg.MachineCfg.VcpuCount = Int64(0)
+
+	var errs ValidationErrors
+	require.True(t, errors.As(cfg.ValidateJailer(), &errs))
+	assert.Len(t, errs, 3)
+	assert.NotNil(t, errs.Field("JailerCfg.ExecFile"))
+	assert.NotNil(t, errs.Field("JailerCfg.UID"))
+	assert.NotNil(t, errs.Field("MachineCfg.VcpuCount"))
+	assert.Contains(t, errs.Error(), "3 invalid fields")
+}
@@ -0,0 +1,219 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+)
+
+// ConfigFromFullVMConfiguration converts a VM configuration, such as the one
+// returned by Client.GetExportVMConfig, into a Config.
+//
+// Only the parts of the Config describing the VM itself are set. Network
+// interfaces are configured statically, in the order of the exported
+// configuration, and the logger and metrics are written to LogPath and
+// MetricsPath.
+func ConfigFromFullVMConfiguration(vmCfg *models.FullVMConfiguration) Config {
+	var cfg Config
+	if vmCfg == nil {
+		return cfg
+	}
+
+	if vmCfg.MachineConfig != nil {
+		cfg.MachineCfg = *vmCfg.MachineConfig
+	}
+
+	if bootSource := vmCfg.BootSource; bootSource != nil {
+		cfg.KernelImagePath = StringValue(bootSource.KernelImagePath)
+		cfg.InitrdPath = bootSource.InitrdPath
+		cfg.KernelArgs = bootSource.BootArgs
+	}
+
+	for _, drive := range vmCfg.Drives {
+		if drive != nil {
+			cfg.Drives = append(cfg.Drives, *drive)
+		}
+	}
+
+	mmdsIfaces := map[string]bool{}
+	if mmdsCfg := vmCfg.MmdsConfig; mmdsCfg != nil {
+		for _, id := range mmdsCfg.NetworkInterfaces {
+			mmdsIfaces[id] = true
+		}
+		if addr := StringValue(mmdsCfg.IPV4Address); addr != "" {
+			cfg.MmdsAddress = net.ParseIP(addr)
+		}
+		cfg.MmdsVersion = MMDSVersion(StringValue(mmdsCfg.Version))
+	}
+
+	for _, iface := range vmCfg.NetworkInterfaces {
+		if iface == nil {
+			continue
+		}
+		cfg.NetworkInterfaces = append(cfg.NetworkInterfaces, NetworkInterface{
+			StaticConfiguration: &StaticNetworkConfiguration{
+				MacAddress:  iface.GuestMac,
+				HostDevName: StringValue(iface.HostDevName),
+			},
+			AllowMMDS:      mmdsIfaces[StringValue(iface.IfaceID)],
+			InRateLimiter:  iface.RxRateLimiter,
+			OutRateLimiter: iface.TxRateLimiter,
+		})
+	}
+
+	if vsock := vmCfg.Vsock; vsock != nil {
+		cfg.VsockDevices = []VsockDevice{{
+			ID:   vsock.VsockID,
+			Path: StringValue(vsock.UdsPath),
+			CID:  uint32(Int64Value(vsock.GuestCid)),
+		}}
+	}
+
+	if vmCfg.Balloon != nil {
+		balloon := *vmCfg.Balloon
+		cfg.Balloon = &balloon
+	}
+
+	if logger := vmCfg.Logger; logger != nil {
+		cfg.LogPath = StringValue(logger.LogPath)
+		cfg.LogLevel = StringValue(logger.Level)
+	}
+
+	if metrics := vmCfg.Metrics; metrics != nil {
+		cfg.MetricsPath = StringValue(metrics.MetricsPath)
+	}
+
+	return cfg
+}
+
+// ToFullVMConfiguration converts the Config into a VM configuration, the
+// document Firecracker reads from --config-file and returns from
+// Client.GetExportVMConfig. It mirrors the API calls of the default FcInit
+// handlers: network interfaces are numbered from 1 in the order of the
+// Config, and FIFOs take precedence over LogPath and MetricsPath.
+//
+// An error is returned if a network interface has no static configuration,
+// as is the case for CNI interfaces before the network is set up, or if more
+// than one vsock device is configured.
+func (cfg *Config) ToFullVMConfiguration() (*models.FullVMConfiguration, error) {
+	vmCfg := &models.FullVMConfiguration{
+		Drives:            []*models.Drive{},
+		NetworkInterfaces: []*models.NetworkInterface{},
+	}
+
+	if cfg.MachineCfg != (models.MachineConfiguration{}) {
+		machineCfg := cfg.MachineCfg
+		vmCfg.MachineConfig = &machineCfg
+	}
+
+	if cfg.KernelImagePath != "" || cfg.InitrdPath != "" || cfg.KernelArgs != "" {
+		vmCfg.BootSource = &models.BootSource{
+			KernelImagePath: String(cfg.KernelImagePath),
+			InitrdPath:      cfg.InitrdPath,
+			BootArgs:        cfg.KernelArgs,
+		}
+	}
+
+	for i := range cfg.Drives {
+		drive := cfg.Drives[i]
+		vmCfg.Drives = append(vmCfg.Drives, &drive)
+	}
+
+	mmdsCfg := &models.MmdsConfig{
+		Version: String(string(MMDSv1)),
+	}
+	if cfg.MmdsVersion == MMDSv1 || cfg.MmdsVersion == MMDSv2 {
+		mmdsCfg.Version = String(string(cfg.MmdsVersion))
+	}
+	if cfg.MmdsAddress != nil {
+		mmdsCfg.IPV4Address = String(cfg.MmdsAddress.String())
+	}
+
+	for i, iface := range cfg.NetworkInterfaces {
+		if iface.StaticConfiguration == nil {
+			return nil, fmt.Errorf("network interface %d has no static configuration", i)
+		}
+
+		ifaceID := strconv.Itoa(i + 1)
+		vmCfg.NetworkInterfaces = append(vmCfg.NetworkInterfaces, &models.NetworkInterface{
+			IfaceID:       String(ifaceID),
+			GuestMac:      iface.StaticConfiguration.MacAddress,
+			HostDevName:   String(iface.StaticConfiguration.HostDevName),
+			RxRateLimiter: iface.InRateLimiter,
+			TxRateLimiter: iface.OutRateLimiter,
+		})
+
+		if iface.AllowMMDS {
+			mmdsCfg.NetworkInterfaces = append(mmdsCfg.NetworkInterfaces, ifaceID)
+		}
+	}
+
+	// MMDS can only be configured along with an interface allowing it.
+	if len(mmdsCfg.NetworkInterfaces) > 0 {
+		vmCfg.MmdsConfig = mmdsCfg
+	}
+
+	switch len(cfg.VsockDevices) {
+	case 0:
+	case 1:
+		dev := cfg.VsockDevices[0]
+		vmCfg.Vsock = &models.Vsock{
+			GuestCid: Int64(int64(dev.CID)),
+			UdsPath:  String(dev.Path),
+			VsockID:  dev.ID,
+		}
+	default:
+		return nil, fmt.Errorf("a VM configuration supports a single vsock device, got %d", len(cfg.VsockDevices))
+	}
+
+	if cfg.Balloon != nil {
+		balloon := *cfg.Balloon
+		vmCfg.Balloon = &balloon
+	}
+
+	logPath := cfg.LogPath
+	if len(cfg.LogFifo) > 0 {
+		logPath = cfg.LogFifo
+	}
+	if len(logPath) > 0 {
+		// Firecracker allows setting a logger without its level.
+		level := String(cfg.LogLevel)
+		if cfg.LogLevel == "" {
+			level = nil
+		}
+
+		vmCfg.Logger = &models.Logger{
+			LogPath:       String(logPath),
+			Level:         level,
+			ShowLevel:     Bool(true),
+			ShowLogOrigin: Bool(false),
+		}
+	}
+
+	metricsPath := cfg.MetricsPath
+	if len(cfg.MetricsFifo) > 0 {
+		metricsPath = cfg.MetricsFifo
+	}
+	if len(metricsPath) > 0 {
+		vmCfg.Metrics = &models.Metrics{
+			MetricsPath: String(metricsPath),
+		}
+	}
+
+	return vmCfg, nil
+}
@@ -0,0 +1,207 @@
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//	http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package firecracker
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	models "github.com/firecracker-microvm/firecracker-go-sdk/client/models"
+)
+
+func TestConfigFromFullVMConfiguration(t *testing.T) {
+	limiter := NewRateLimiter(
+		TokenBucketBuilder{}.WithBucketSize(1024).WithRefillDuration(1).Build(),
+		TokenBucketBuilder{}.WithBucketSize(10).WithRefillDuration(1).Build(),
+	)
+
+	cfg := ConfigFromFullVMConfiguration(&models.FullVMConfiguration{
+		BootSource: &models.BootSource{
+			KernelImagePath: String("/path/to/kernel"),
+			BootArgs:        "console=ttyS0",
+		},
+		Drives: []*models.Drive{
+			{DriveID: String("root"), PathOnHost: String("/path/to/rootfs"), IsRootDevice: Bool(true), IsReadOnly: Bool(false)},
+		},
+		MachineConfig: &models.MachineConfiguration{VcpuCount: Int64(2), MemSizeMib: Int64(256)},
+		MmdsConfig: &models.MmdsConfig{
+			IPV4Address:       String("169.254.169.250"),
+			NetworkInterfaces: []string{"2"},
+			Version:           String("V2"),
+		},
+		NetworkInterfaces: []*models.NetworkInterface{
+			{IfaceID: String("1"), HostDevName: String("tap0"), GuestMac: "02:00:00:00:00:01", RxRateLimiter: limiter},
+			{IfaceID: String("2"), HostDevName: String("tap1")},
+		},
+		Vsock:   &models.Vsock{GuestCid: Int64(3), UdsPath: String("/path/to/vsock"), VsockID: "vsock0"},
+		Logger:  &models.Logger{LogPath: String("/path/to/log"), Level: String("Debug")},
+		Metrics: &models.Metrics{MetricsPath: String("/path/to/metrics")},
+	})
+
+	assert.Equal(t, "/path/to/kernel", cfg.KernelImagePath)
+	assert.Equal(t, "console=ttyS0", cfg.KernelArgs)
+	assert.Equal(t, int64(2), Int64Value(cfg.MachineCfg.VcpuCount))
+	require.Len(t, cfg.Drives, 1)
+	assert.Equal(t, "root", StringValue(cfg.Drives[0].DriveID))
+
+	require.Len(t, cfg.NetworkInterfaces, 2)
+	assert.Equal(t, "tap0", cfg.NetworkInterfaces[0].StaticConfiguration.HostDevName)
+	assert.Equal(t, "02:00:00:00:00:01", cfg.NetworkInterfaces[0].StaticConfiguration.MacAddress)
+	assert.Equal(t, limiter, cfg.NetworkInterfaces[0].InRateLimiter)
+	assert.False(t, cfg.NetworkInterfaces[0].AllowMMDS)
+	assert.True(t, cfg.NetworkInterfaces[1].AllowMMDS)
+	assert.Equal(t, "169.254.169.250", cfg.MmdsAddress.String())
+	assert.Equal(t, MMDSv2, cfg.MmdsVersion)
+
+	assert.Equal(t, []VsockDevice{{ID: "vsock0", Path: "/path/to/vsock", CID: 3}}, cfg.VsockDevices)
+	assert.Equal(t, "/path/to/log", cfg.LogPath)
+	assert.Equal(t, "Debug", cfg.LogLevel)
+	assert.Equal(t, "/path/to/metrics", cfg.MetricsPath)
+}
+
+func TestToFullVMConfiguration(t *testing.T) {
+	limiter := &models.RateLimiter{
+		Bandwidth: &models.TokenBucket{Size: Int64(1024), RefillTime: Int64(100)},
+	}
+	cfg := Config{
+		KernelImagePath: "/vmlinux",
+		KernelArgs:      "console=ttyS0",
+		LogFifo:         "/tmp/log.fifo",
+		LogLevel:        "Debug",
+		MetricsPath:     "/tmp/metrics",
+		MachineCfg: models.MachineConfiguration{
+			VcpuCount:  Int64(2),
+			MemSizeMib: Int64(256),
+		},
+		Drives: NewDrivesBuilder("/rootfs").Build(),
+		NetworkInterfaces: NetworkInterfaces{
+			{
+				StaticConfiguration: &StaticNetworkConfiguration{MacAddress: "02:00:00:00:00:01", HostDevName: "tap0"},
+				InRateLimiter:       limiter,
+			},
+			{
+				StaticConfiguration: &StaticNetworkConfiguration{MacAddress: "02:00:00:00:00:02", HostDevName: "tap1"},
+				AllowMMDS:           true,
+			},
+		},
+		VsockDevices: []VsockDevice{{ID: "vsock0", Path: "/tmp/v.sock", CID: 3}},
+		MmdsAddress:  net.IPv4(169, 254, 169, 250),
+		MmdsVersion:  MMDSv2,
+	}
+
+	vmCfg, err := cfg.ToFullVMConfiguration()
+	require.NoError(t, err)
+
+	assert.Equal(t, "/vmlinux", StringValue(vmCfg.BootSource.KernelImagePath))
+	assert.Equal(t, "console=ttyS0", vmCfg.BootSource.BootArgs)
+	assert.Equal(t, int64(2), Int64Value(vmCfg.MachineConfig.VcpuCount))
+	require.Len(t, vmCfg.Drives, 1)
+	assert.Equal(t, "/rootfs", StringValue(vmCfg.Drives[0].PathOnHost))
+
+	require.Len(t, vmCfg.NetworkInterfaces, 2)
+	assert.Equal(t, "1", StringValue(vmCfg.NetworkInterfaces[0].IfaceID))
+	assert.Equal(t, "tap0", StringValue(vmCfg.NetworkInterfaces[0].HostDevName))
+	assert.Equal(t, limiter, vmCfg.NetworkInterfaces[0].RxRateLimiter)
+	assert.Equal(t, "2", StringValue(vmCfg.NetworkInterfaces[1].IfaceID))
+
+	assert.Equal(t, &models.MmdsConfig{
+		Version:           String("V2"),
+		IPV4Address:       String("169.254.169.250"),
+		NetworkInterfaces: []string{"2"},
+	}, vmCfg.MmdsConfig)
+	assert.Equal(t, &models.Vsock{GuestCid: Int64(3), UdsPath: String("/tmp/v.sock"), VsockID: "vsock0"}, vmCfg.Vsock)
+	assert.Equal(t, "/tmp/log.fifo", StringValue(vmCfg.Logger.LogPath))
+	assert.Equal(t, "Debug", StringValue(vmCfg.Logger.Level))
+	assert.Equal(t, "/tmp/metrics", StringValue(vmCfg.Metrics.MetricsPath))
+
+	cfg.VsockDevices = append(cfg.VsockDevices, VsockDevice{ID: "vsock1", Path: "/tmp/w.sock", CID: 4})
+	_, err = cfg.ToFullVMConfiguration()
+	assert.Error(t, err)
+}
+
+func TestFullVMConfigurationRoundTrip(t *testing.T) {
+	limiter := NewRateLimiter(
+		TokenBucketBuilder{}.WithBucketSize(1024).WithRefillDuration(100).Build(),
+		TokenBucketBuilder{}.WithBucketSize(10).WithRefillDuration(100).WithInitialSize(5).Build(),
+	)
+
+	drives := NewDrivesBuilder("/path/to/rootfs").
+		AddDrive("/path/to/data", true, WithDriveID("data"), WithRateLimiter(*limiter), WithCacheType(models.DriveCacheTypeWriteback)).
+		Build()
+
+	vmCfg := &models.FullVMConfiguration{
+		BootSource: &models.BootSource{
+			KernelImagePath: String("/path/to/kernel"),
+			InitrdPath:      "/path/to/initrd",
+			BootArgs:        "console=ttyS0",
+		},
+		Drives: []*models.Drive{&drives[0], &drives[1]},
+		MachineConfig: &models.MachineConfiguration{
+			VcpuCount:       Int64(2),
+			MemSizeMib:      Int64(256),
+			Smt:             Bool(false),
+			TrackDirtyPages: Bool(true),
+		},
+		MmdsConfig: &models.MmdsConfig{
+			IPV4Address:       String("169.254.169.250"),
+			NetworkInterfaces: []string{"2"},
+			Version:           String("V2"),
+		},
+		NetworkInterfaces: []*models.NetworkInterface{
+			{IfaceID: String("1"), HostDevName: String("tap0"), GuestMac: "02:00:00:00:00:01", RxRateLimiter: limiter, TxRateLimiter: limiter},
+			{IfaceID: String("2"), HostDevName: String("tap1"), GuestMac: "02:00:00:00:00:02"},
+		},
+		Vsock: &models.Vsock{GuestCid: Int64(3), UdsPath: String("/path/to/vsock"), VsockID: "vsock0"},
+		Balloon: &models.Balloon{
+			AmountMib:             Int64(64),
+			DeflateOnOom:          Bool(true),
+			StatsPollingIntervals: 5,
+		},
+		Logger: &models.Logger{
+			LogPath:       String("/path/to/log"),
+			Level:         String("Debug"),
+			ShowLevel:     Bool(true),
+			ShowLogOrigin: Bool(false),
+		},
+		Metrics: &models.Metrics{MetricsPath: String("/path/to/metrics")},
+	}
+
+	cfg := ConfigFromFullVMConfiguration(vmCfg)
+	roundTripped, err := cfg.ToFullVMConfiguration()
+	require.NoError(t, err)
+	assert.Equal(t, vmCfg, roundTripped)
+
+	// and the other way around
+	assert.Equal(t, cfg, ConfigFromFullVMConfiguration(roundTripped))
+
+	// the conversion copies the top-level structs
+	roundTripped.MachineConfig.CPUTemplate = models.CPUTemplateT2
+	roundTripped.Balloon.StatsPollingIntervals = 10
+	assert.Empty(t, cfg.MachineCfg.CPUTemplate)
+	assert.Equal(t, int64(5), cfg.Balloon.StatsPollingIntervals)
+}
+
+func TestFullVMConfigurationRoundTripEmpty(t *testing.T) {
+	vmCfg, err := (&Config{}).ToFullVMConfiguration()
+	require.NoError(t, err)
+	assert.Equal(t, &models.FullVMConfiguration{
+		Drives:            []*models.Drive{},
+		NetworkInterfaces: []*models.NetworkInterface{},
+	}, vmCfg)
+	assert.Equal(t, Config{}, ConfigFromFullVMConfiguration(vmCfg))
+	assert.Equal(t, Config{}, ConfigFromFullVMConfiguration(nil))
+}